@@ -0,0 +1,48 @@
+// Package barcode validates the retail barcodes products are scanned by.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalid = errors.New("invalid barcode")
+
+// Normalize checks an EAN-13 or UPC-A code and returns it in its 13-digit
+// form. A UPC-A code is an EAN-13 with a leading zero dropped, so both
+// spellings of the same product normalize to the same string and a scanner
+// set to either format finds it.
+func Normalize(code string) (string, error) {
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return "", fmt.Errorf("%w: %q must contain only digits", ErrInvalid, code)
+		}
+	}
+
+	switch len(code) {
+	case 12:
+		code = "0" + code
+	case 13:
+	default:
+		return "", fmt.Errorf("%w: %q must be 12 (UPC-A) or 13 (EAN-13) digits", ErrInvalid, code)
+	}
+
+	if checkDigit(code[:12]) != code[12] {
+		return "", fmt.Errorf("%w: %q has a wrong check digit", ErrInvalid, code)
+	}
+	return code, nil
+}
+
+// checkDigit computes the GTIN check digit: digits are weighted 1 and 3
+// alternately from the left of a 12-digit payload.
+func checkDigit(payload string) byte {
+	sum := 0
+	for i := 0; i < len(payload); i++ {
+		d := int(payload[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -1,9 +1,12 @@
 package database
 
 import (
+	"cashier-api/money"
 	"database/sql"
 	"fmt"
 	"log"
+
+	"github.com/lib/pq"
 )
 
 func Migrate(db *sql.DB) error {
@@ -46,15 +49,41 @@ func Migrate(db *sql.DB) error {
 	CREATE TABLE IF NOT EXISTS transaction_details (
 		id SERIAL PRIMARY KEY,
 		transaction_id INT REFERENCES transaction(id) ON DELETE CASCADE,
-		product_id INT REFERENCES product(id),
+		product_id INT REFERENCES product(id) ON DELETE SET NULL,
 		quantity INT NOT NULL,
-		subtotal INT NOT NULL
+		subtotal INT NOT NULL,
+		unit_price NUMERIC(10, 2) NOT NULL,
+		product_name VARCHAR(100) NOT NULL,
+		category_id INT,
+		category_name VARCHAR(100),
+		sku VARCHAR(64)
 	);`
 	if _, err := db.Exec(createTransactionDetailTable); err != nil {
 		return fmt.Errorf("failed to create transaction details table: %w", err)
 	}
 	log.Println("transaction details table created successfully")
 
+	createTransactionIndexes := `
+	CREATE INDEX IF NOT EXISTS idx_transaction_created_at ON "transaction" (created_at DESC, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_transaction_details_transaction_id ON transaction_details (transaction_id);
+	CREATE INDEX IF NOT EXISTS idx_transaction_details_product_id ON transaction_details (product_id);`
+	if _, err := db.Exec(createTransactionIndexes); err != nil {
+		return fmt.Errorf("failed to create transaction indexes: %w", err)
+	}
+
+	createIdempotencyKeyTable := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key VARCHAR(255) PRIMARY KEY,
+		request_hash CHAR(64) NOT NULL,
+		transaction_id INT REFERENCES transaction(id) ON DELETE CASCADE,
+		response_body JSONB,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL
+	);`
+	if _, err := db.Exec(createIdempotencyKeyTable); err != nil {
+		return fmt.Errorf("failed to create idempotency keys table: %w", err)
+	}
+
 	var totalAmountExists bool
 	checkTotalAmountQuery := `
 	SELECT EXISTS (
@@ -89,12 +118,13 @@ func Migrate(db *sql.DB) error {
 		log.Println("created_at column added successfully")
 	}
 
-	// Make all transaction columns nullable except id, total_amount, created_at
+	// Make all transaction columns nullable except the ones checkout always writes
 	// so checkout can INSERT only (total_amount) without violating NOT NULL on extra columns.
 	rows, err := db.Query(`
 		SELECT column_name FROM information_schema.columns
 		WHERE table_schema = 'public' AND table_name = 'transaction' AND is_nullable = 'NO'
-		AND column_name NOT IN ('id', 'total_amount', 'created_at')
+		AND column_name NOT IN ('id', 'total_amount', 'created_at', 'status', 'currency', 'cash_rounding', 'tax_amount',
+			'tax_inclusive', 'discount_amount', 'change_amount')
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to list transaction columns: %w", err)
@@ -158,7 +188,7 @@ func Migrate(db *sql.DB) error {
 	if err := db.QueryRow(checkPriceTypeQuery).Scan(&priceType); err != nil {
 		log.Printf("Warning: failed to check price column type: %v", err)
 	} else {
-		if priceType == "integer" || priceType == "bigint" || priceType == "smallint" {
+		if priceType == "integer" || priceType == "smallint" {
 			log.Println("Migrating price column from integer to numeric...")
 			alterPriceQuery := `ALTER TABLE product ALTER COLUMN price TYPE NUMERIC(10, 2);`
 			if _, err := db.Exec(alterPriceQuery); err != nil {
@@ -168,6 +198,924 @@ func Migrate(db *sql.DB) error {
 		}
 	}
 
+	transactionStatusColumns := []struct {
+		Name       string
+		Definition string
+	}{
+		{"status", "VARCHAR(20) NOT NULL DEFAULT 'completed'"},
+		{"voided_at", "TIMESTAMP"},
+		{"void_reason", "TEXT"},
+		{"voided_by", "VARCHAR(100)"},
+	}
+	for _, c := range transactionStatusColumns {
+		if err := addColumnIfNotExists(db, "transaction", c.Name, c.Definition); err != nil {
+			return err
+		}
+	}
+
+	createTransactionReturnTable := `
+	CREATE TABLE IF NOT EXISTS transaction_returns (
+		id SERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES transaction(id) ON DELETE CASCADE,
+		refund_amount INT NOT NULL,
+		reason TEXT NOT NULL,
+		performed_by VARCHAR(100) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_transaction_returns_transaction_id ON transaction_returns (transaction_id);
+	CREATE INDEX IF NOT EXISTS idx_transaction_returns_created_at ON transaction_returns (created_at);`
+	if _, err := db.Exec(createTransactionReturnTable); err != nil {
+		return fmt.Errorf("failed to create transaction returns table: %w", err)
+	}
+
+	createTransactionReturnItemTable := `
+	CREATE TABLE IF NOT EXISTS transaction_return_items (
+		id SERIAL PRIMARY KEY,
+		return_id INT NOT NULL REFERENCES transaction_returns(id) ON DELETE CASCADE,
+		detail_id INT NOT NULL REFERENCES transaction_details(id) ON DELETE CASCADE,
+		quantity INT NOT NULL,
+		refund_amount INT NOT NULL,
+		restocked BOOLEAN NOT NULL DEFAULT TRUE
+	);
+	CREATE INDEX IF NOT EXISTS idx_transaction_return_items_detail_id ON transaction_return_items (detail_id);`
+	if _, err := db.Exec(createTransactionReturnItemTable); err != nil {
+		return fmt.Errorf("failed to create transaction return items table: %w", err)
+	}
+
+	// Full refunds recorded before per-line returns existed have no items;
+	// give them one item per detail so returned quantities add up.
+	backfillReturnItems := `
+	INSERT INTO transaction_return_items (return_id, detail_id, quantity, refund_amount, restocked)
+	SELECT r.id, td.id, td.quantity, td.subtotal, TRUE
+	FROM transaction_returns r
+	JOIN transaction_details td ON td.transaction_id = r.transaction_id
+	WHERE NOT EXISTS (SELECT 1 FROM transaction_return_items ri WHERE ri.return_id = r.id);`
+	if _, err := db.Exec(backfillReturnItems); err != nil {
+		return fmt.Errorf("failed to backfill transaction return items: %w", err)
+	}
+
+	detailSnapshotColumns := []struct {
+		Name       string
+		Definition string
+	}{
+		{"unit_price", "NUMERIC(10, 2)"},
+		{"product_name", "VARCHAR(100)"},
+		{"category_id", "INT"},
+		{"category_name", "VARCHAR(100)"},
+		{"sku", "VARCHAR(64)"},
+	}
+	for _, c := range detailSnapshotColumns {
+		if err := addColumnIfNotExists(db, "transaction_details", c.Name, c.Definition); err != nil {
+			return err
+		}
+	}
+
+	// Older details only carry product_id; copy the product as it is now and
+	// derive the unit price from what was actually charged.
+	backfillDetailSnapshots := `
+	UPDATE transaction_details td
+	SET product_name = p.name,
+		unit_price = ROUND(td.subtotal::numeric / NULLIF(td.quantity, 0), 2),
+		category_id = p.category_id,
+		category_name = c.name
+	FROM product p
+	LEFT JOIN category c ON c.id = p.category_id
+	WHERE p.id = td.product_id AND td.product_name IS NULL;
+	UPDATE transaction_details SET product_name = '' WHERE product_name IS NULL;
+	UPDATE transaction_details SET unit_price = 0 WHERE unit_price IS NULL;
+	ALTER TABLE transaction_details ALTER COLUMN product_name SET NOT NULL;
+	ALTER TABLE transaction_details ALTER COLUMN unit_price SET NOT NULL;`
+	if _, err := db.Exec(backfillDetailSnapshots); err != nil {
+		return fmt.Errorf("failed to backfill transaction detail snapshots: %w", err)
+	}
+
+	// Details no longer need the live product row, so deleting a product
+	// detaches its history instead of failing on the foreign key.
+	var productDeleteRule string
+	checkProductFKQuery := `
+	SELECT rc.delete_rule
+	FROM information_schema.referential_constraints rc
+	JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = rc.constraint_name
+	WHERE kcu.table_name = 'transaction_details' AND kcu.column_name = 'product_id';`
+	if err := db.QueryRow(checkProductFKQuery).Scan(&productDeleteRule); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check transaction_details product foreign key: %w", err)
+	}
+	if productDeleteRule != "SET NULL" {
+		log.Println("Changing transaction_details.product_id foreign key to ON DELETE SET NULL...")
+		alterProductFK := `
+		ALTER TABLE transaction_details DROP CONSTRAINT IF EXISTS transaction_details_product_id_fkey;
+		ALTER TABLE transaction_details
+		ADD CONSTRAINT transaction_details_product_id_fkey
+		FOREIGN KEY (product_id)
+		REFERENCES product(id)
+		ON DELETE SET NULL;`
+		if _, err := db.Exec(alterProductFK); err != nil {
+			return fmt.Errorf("failed to alter transaction_details product foreign key: %w", err)
+		}
+		log.Println("transaction_details.product_id foreign key updated successfully")
+	}
+
+	// Amounts are kept as BIGINT minor units so the database never rounds
+	// them. They used to be whole INT units, and prices NUMERIC ones.
+	currency := money.DefaultCurrency()
+	amountColumns := []struct {
+		Table  string
+		Column string
+	}{
+		{"transaction", "total_amount"},
+		{"transaction_details", "subtotal"},
+		{"transaction_details", "unit_price"},
+		{"transaction_returns", "refund_amount"},
+		{"transaction_return_items", "refund_amount"},
+		{"product", "price"},
+	}
+	for _, c := range amountColumns {
+		if err := migrateColumnToMinorUnits(db, c.Table, c.Column, money.Exponent(currency)); err != nil {
+			return err
+		}
+	}
+	if err := addColumnIfNotExists(db, "transaction", "cash_rounding", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Every amount belongs to a row that records its currency, itself or
+	// through its parent.
+	for _, table := range []string{"transaction", "product"} {
+		if err := migrateCurrencyColumn(db, table, currency); err != nil {
+			return err
+		}
+	}
+
+	createTaxTables := `
+	CREATE TABLE IF NOT EXISTS tax_rates (
+		id SERIAL PRIMARY KEY,
+		code VARCHAR(20) NOT NULL UNIQUE,
+		name VARCHAR(100) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS tax_rate_periods (
+		id SERIAL PRIMARY KEY,
+		tax_rate_id INT NOT NULL REFERENCES tax_rates(id) ON DELETE CASCADE,
+		rate_bps INT NOT NULL CHECK (rate_bps >= 0 AND rate_bps <= 10000),
+		effective_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (tax_rate_id, effective_from)
+	);`
+	if _, err := db.Exec(createTaxTables); err != nil {
+		return fmt.Errorf("failed to create tax tables: %w", err)
+	}
+
+	taxColumns := []struct {
+		Table      string
+		Column     string
+		Definition string
+	}{
+		{"category", "tax_rate_id", "INT REFERENCES tax_rates(id) ON DELETE SET NULL"},
+		{"product", "tax_rate_id", "INT REFERENCES tax_rates(id) ON DELETE SET NULL"},
+		{"transaction", "tax_amount", "BIGINT NOT NULL DEFAULT 0"},
+		{"transaction", "tax_inclusive", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"transaction_details", "tax_rate_id", "INT"},
+		{"transaction_details", "tax_code", "VARCHAR(20)"},
+		{"transaction_details", "tax_rate_bps", "INT NOT NULL DEFAULT 0"},
+		{"transaction_details", "tax_amount", "BIGINT NOT NULL DEFAULT 0"},
+		{"transaction_details", "total_amount", "BIGINT"},
+		{"transaction_return_items", "tax_amount", "BIGINT NOT NULL DEFAULT 0"},
+	}
+	for _, c := range taxColumns {
+		if err := addColumnIfNotExists(db, c.Table, c.Column, c.Definition); err != nil {
+			return err
+		}
+	}
+
+	// Lines sold before tax existed were charged exactly their subtotal.
+	backfillLineTotals := `
+	UPDATE transaction_details SET total_amount = subtotal WHERE total_amount IS NULL;
+	ALTER TABLE transaction_details ALTER COLUMN total_amount SET NOT NULL;`
+	if _, err := db.Exec(backfillLineTotals); err != nil {
+		return fmt.Errorf("failed to backfill transaction detail totals: %w", err)
+	}
+
+	createPromotionsTable := `
+	CREATE TABLE IF NOT EXISTS promotions (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		type VARCHAR(20) NOT NULL,
+		level VARCHAR(10) NOT NULL DEFAULT 'line',
+		percent_bps INT NOT NULL DEFAULT 0 CHECK (percent_bps >= 0 AND percent_bps <= 10000),
+		amount BIGINT NOT NULL DEFAULT 0,
+		buy_quantity INT NOT NULL DEFAULT 0,
+		get_quantity INT NOT NULL DEFAULT 0,
+		bundle_price BIGINT NOT NULL DEFAULT 0,
+		min_spend BIGINT NOT NULL DEFAULT 0,
+		product_ids INT[] NOT NULL DEFAULT '{}',
+		category_ids INT[] NOT NULL DEFAULT '{}',
+		priority INT NOT NULL DEFAULT 0,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		starts_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		ends_at TIMESTAMP
+	);`
+	if _, err := db.Exec(createPromotionsTable); err != nil {
+		return fmt.Errorf("failed to create promotions table: %w", err)
+	}
+	if err := migrateCurrencyColumn(db, "promotions", currency); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "transaction", "discount_amount", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "transaction_details", "discount_amount", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// promotion_name is copied so the discount still reads correctly after the
+	// promotion is edited or deleted.
+	createTransactionDiscountsTable := `
+	CREATE TABLE IF NOT EXISTS transaction_discounts (
+		id SERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES "transaction"(id) ON DELETE CASCADE,
+		detail_id INT NOT NULL REFERENCES transaction_details(id) ON DELETE CASCADE,
+		promotion_id INT REFERENCES promotions(id) ON DELETE SET NULL,
+		promotion_name VARCHAR(255) NOT NULL,
+		level VARCHAR(10) NOT NULL,
+		amount BIGINT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_transaction_discounts_transaction_id ON transaction_discounts (transaction_id);`
+	if _, err := db.Exec(createTransactionDiscountsTable); err != nil {
+		return fmt.Errorf("failed to create transaction_discounts table: %w", err)
+	}
+
+	if err := addColumnIfNotExists(db, "transaction", "change_amount", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	createTransactionPaymentsTable := `
+	CREATE TABLE IF NOT EXISTS transaction_payments (
+		id SERIAL PRIMARY KEY,
+		transaction_id INT NOT NULL REFERENCES "transaction"(id) ON DELETE CASCADE,
+		method VARCHAR(20) NOT NULL,
+		amount BIGINT NOT NULL,
+		tendered BIGINT NOT NULL,
+		reference VARCHAR(100)
+	);
+	CREATE INDEX IF NOT EXISTS idx_transaction_payments_transaction_id ON transaction_payments (transaction_id);`
+	if _, err := db.Exec(createTransactionPaymentsTable); err != nil {
+		return fmt.Errorf("failed to create transaction_payments table: %w", err)
+	}
+
+	createShiftTables := `
+	CREATE TABLE IF NOT EXISTS shifts (
+		id SERIAL PRIMARY KEY,
+		register VARCHAR(50) NOT NULL,
+		opened_by VARCHAR(100) NOT NULL,
+		opening_float BIGINT NOT NULL DEFAULT 0,
+		status VARCHAR(10) NOT NULL DEFAULT 'open',
+		opened_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		closed_by VARCHAR(100),
+		closed_at TIMESTAMP,
+		counted_cash BIGINT
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_shifts_open_register ON shifts (register) WHERE status = 'open';
+	CREATE TABLE IF NOT EXISTS cash_movements (
+		id SERIAL PRIMARY KEY,
+		shift_id INT NOT NULL REFERENCES shifts(id),
+		type VARCHAR(10) NOT NULL,
+		amount BIGINT NOT NULL CHECK (amount > 0),
+		reason TEXT NOT NULL,
+		performed_by VARCHAR(100) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(createShiftTables); err != nil {
+		return fmt.Errorf("failed to create shift tables: %w", err)
+	}
+	if err := migrateCurrencyColumn(db, "shifts", currency); err != nil {
+		return err
+	}
+
+	// Sales from before shifts existed keep a NULL shift_id.
+	if err := addColumnIfNotExists(db, "transaction", "shift_id", "INT REFERENCES shifts(id)"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "transaction_returns", "shift_id", "INT REFERENCES shifts(id)"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_transaction_shift_id ON "transaction" (shift_id)`); err != nil {
+		return fmt.Errorf("failed to create transaction shift index: %w", err)
+	}
+
+	createReceiptSequencesTable := `
+	CREATE TABLE IF NOT EXISTS receipt_sequences (
+		store_code VARCHAR(20) NOT NULL,
+		period VARCHAR(8) NOT NULL,
+		last_number INT NOT NULL,
+		PRIMARY KEY (store_code, period)
+	);`
+	if _, err := db.Exec(createReceiptSequencesTable); err != nil {
+		return fmt.Errorf("failed to create receipt_sequences table: %w", err)
+	}
+
+	if err := addColumnIfNotExists(db, "transaction", "receipt_number", "VARCHAR(40) UNIQUE"); err != nil {
+		return err
+	}
+
+	// Cart lines reference live products; a cart naming a deleted product
+	// simply loses that line.
+	createCartTables := `
+	CREATE TABLE IF NOT EXISTS carts (
+		id SERIAL PRIMARY KEY,
+		status VARCHAR(20) NOT NULL DEFAULT 'active',
+		reserve BOOLEAN NOT NULL DEFAULT FALSE,
+		transaction_id INT REFERENCES "transaction"(id),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_carts_live ON carts (expires_at) WHERE status IN ('active', 'held');
+	CREATE TABLE IF NOT EXISTS cart_items (
+		cart_id INT NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+		product_id INT NOT NULL REFERENCES product(id) ON DELETE CASCADE,
+		quantity INT NOT NULL CHECK (quantity > 0),
+		PRIMARY KEY (cart_id, product_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_cart_items_product_id ON cart_items (product_id);`
+	if _, err := db.Exec(createCartTables); err != nil {
+		return fmt.Errorf("failed to create cart tables: %w", err)
+	}
+
+	// The points balance is never stored: it is always the sum of the ledger.
+	createCustomerTables := `
+	CREATE SEQUENCE IF NOT EXISTS customer_member_number_seq;
+	CREATE TABLE IF NOT EXISTS customers (
+		id SERIAL PRIMARY KEY,
+		member_number VARCHAR(20) NOT NULL UNIQUE,
+		name VARCHAR(100) NOT NULL,
+		phone VARCHAR(30),
+		email VARCHAR(255),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_phone ON customers (phone);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_email ON customers (lower(email));
+	CREATE TABLE IF NOT EXISTS loyalty_points (
+		id SERIAL PRIMARY KEY,
+		customer_id INT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+		transaction_id INT REFERENCES "transaction"(id),
+		return_id INT REFERENCES transaction_returns(id),
+		type VARCHAR(20) NOT NULL,
+		points BIGINT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_loyalty_points_customer_id ON loyalty_points (customer_id);
+	CREATE INDEX IF NOT EXISTS idx_loyalty_points_transaction_id ON loyalty_points (transaction_id);`
+	if _, err := db.Exec(createCustomerTables); err != nil {
+		return fmt.Errorf("failed to create customer tables: %w", err)
+	}
+
+	if err := addColumnIfNotExists(db, "transaction", "customer_id", "INT REFERENCES customers(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_transaction_customer_id ON "transaction" (customer_id)`); err != nil {
+		return fmt.Errorf("failed to create transaction customer index: %w", err)
+	}
+
+	// Like loyalty points, a gift card balance is the sum of its ledger.
+	createGiftCardTables := `
+	CREATE TABLE IF NOT EXISTS gift_cards (
+		id SERIAL PRIMARY KEY,
+		code CHAR(16) NOT NULL UNIQUE,
+		kind VARCHAR(10) NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'inactive',
+		initial_value BIGINT NOT NULL CHECK (initial_value >= 0),
+		expires_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		activated_at TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS gift_card_entries (
+		id SERIAL PRIMARY KEY,
+		gift_card_id INT NOT NULL REFERENCES gift_cards(id),
+		transaction_id INT REFERENCES "transaction"(id),
+		return_id INT REFERENCES transaction_returns(id),
+		type VARCHAR(20) NOT NULL,
+		amount BIGINT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_gift_card_entries_gift_card_id ON gift_card_entries (gift_card_id);
+	CREATE INDEX IF NOT EXISTS idx_gift_card_entries_transaction_id ON gift_card_entries (transaction_id);`
+	if _, err := db.Exec(createGiftCardTables); err != nil {
+		return fmt.Errorf("failed to create gift card tables: %w", err)
+	}
+	if err := migrateCurrencyColumn(db, "gift_cards", currency); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "product", "sku", "VARCHAR(64)"); err != nil {
+		return err
+	}
+	// Barcodes are stored in 13-digit form; the primary key makes each one
+	// belong to a single product and serves the scan lookup.
+	createProductCodes := `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_product_sku ON product (sku);
+	CREATE TABLE IF NOT EXISTS product_barcodes (
+		barcode CHAR(13) PRIMARY KEY,
+		product_id INT NOT NULL REFERENCES product(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_product_barcodes_product_id ON product_barcodes (product_id);`
+	if _, err := db.Exec(createProductCodes); err != nil {
+		return fmt.Errorf("failed to create product code tables: %w", err)
+	}
+
+	// A variant is a product row pointing at its parent. The reference
+	// restricts deletes so a parent cannot be removed from under its variants.
+	productVariantColumns := []struct{ column, definition string }{
+		{"parent_id", "INT REFERENCES product(id)"},
+		{"options", "JSONB"},
+		{"option_values", "JSONB"},
+		{"price_override", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	}
+	for _, c := range productVariantColumns {
+		if err := addColumnIfNotExists(db, "product", c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_product_parent_id ON product (parent_id)"); err != nil {
+		return fmt.Errorf("failed to create product parent index: %w", err)
+	}
+	if err := addColumnIfNotExists(db, "transaction_details", "parent_product_id", "INT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "transaction_details", "parent_product_name", "VARCHAR(255)"); err != nil {
+		return err
+	}
+
+	// Quantities used to be whole INT values; three decimals cover grams of
+	// a kilogram and millimetres of a metre.
+	quantityColumns := []struct {
+		Table  string
+		Column string
+	}{
+		{"product", "stock"},
+		{"transaction_details", "quantity"},
+		{"transaction_return_items", "quantity"},
+		{"cart_items", "quantity"},
+	}
+	for _, c := range quantityColumns {
+		if err := migrateColumnToNumeric(db, c.Table, c.Column, "NUMERIC(14, 3)"); err != nil {
+			return err
+		}
+	}
+	if err := addColumnIfNotExists(db, "product", "unit", "VARCHAR(8) NOT NULL DEFAULT 'pcs'"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "product", "quantity_precision", "SMALLINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "transaction_details", "unit", "VARCHAR(8) NOT NULL DEFAULT 'pcs'"); err != nil {
+		return err
+	}
+	createProductPacks := `
+	CREATE TABLE IF NOT EXISTS product_packs (
+		product_id INT NOT NULL REFERENCES product(id) ON DELETE CASCADE,
+		name VARCHAR(50) NOT NULL,
+		size NUMERIC(14, 3) NOT NULL CHECK (size > 0),
+		PRIMARY KEY (product_id, name)
+	);`
+	if _, err := db.Exec(createProductPacks); err != nil {
+		return fmt.Errorf("failed to create product_packs table: %w", err)
+	}
+
+	// A component cannot be deleted while a bundle uses it. Sold bundles
+	// keep a copy of what they were made of, so returns put back the right
+	// components and reports can attribute revenue to them.
+	if err := addColumnIfNotExists(db, "product", "type", "VARCHAR(20) NOT NULL DEFAULT 'standard'"); err != nil {
+		return err
+	}
+	createBundleTables := `
+	CREATE TABLE IF NOT EXISTS product_components (
+		bundle_id INT NOT NULL REFERENCES product(id) ON DELETE CASCADE,
+		component_id INT NOT NULL REFERENCES product(id),
+		quantity NUMERIC(14, 3) NOT NULL CHECK (quantity > 0),
+		PRIMARY KEY (bundle_id, component_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_product_components_component_id ON product_components (component_id);
+	CREATE TABLE IF NOT EXISTS transaction_detail_components (
+		id SERIAL PRIMARY KEY,
+		detail_id INT NOT NULL REFERENCES transaction_details(id) ON DELETE CASCADE,
+		product_id INT REFERENCES product(id) ON DELETE SET NULL,
+		product_name VARCHAR(255) NOT NULL,
+		quantity NUMERIC(14, 3) NOT NULL,
+		unit_price BIGINT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_transaction_detail_components_detail_id ON transaction_detail_components (detail_id);`
+	if _, err := db.Exec(createBundleTables); err != nil {
+		return fmt.Errorf("failed to create bundle tables: %w", err)
+	}
+
+	// product.stock is kept equal to the sum of its movements; the
+	// -reconcile-stock command reports any product where it is not.
+	createStockMovementsTable := `
+	CREATE TABLE IF NOT EXISTS stock_movements (
+		id SERIAL PRIMARY KEY,
+		product_id INT REFERENCES product(id) ON DELETE SET NULL,
+		product_name VARCHAR(100) NOT NULL,
+		type VARCHAR(20) NOT NULL,
+		quantity NUMERIC(14, 3) NOT NULL,
+		stock_after NUMERIC(14, 3) NOT NULL,
+		reason TEXT,
+		performed_by VARCHAR(100),
+		transaction_id INT REFERENCES "transaction"(id),
+		return_id INT REFERENCES transaction_returns(id),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_stock_movements_product_id ON stock_movements (product_id);`
+	if _, err := db.Exec(createStockMovementsTable); err != nil {
+		return fmt.Errorf("failed to create stock_movements table: %w", err)
+	}
+
+	// The ledger outlives its products: deleting one keeps its movements
+	// under the name it had.
+	if err := addColumnIfNotExists(db, "stock_movements", "product_name", "VARCHAR(100)"); err != nil {
+		return err
+	}
+	backfillMovementNames := `
+	UPDATE stock_movements m SET product_name = p.name
+	FROM product p
+	WHERE p.id = m.product_id AND m.product_name IS NULL;
+	UPDATE stock_movements SET product_name = '' WHERE product_name IS NULL;
+	ALTER TABLE stock_movements ALTER COLUMN product_name SET NOT NULL, ALTER COLUMN product_id DROP NOT NULL;`
+	if _, err := db.Exec(backfillMovementNames); err != nil {
+		return fmt.Errorf("failed to backfill stock movement product names: %w", err)
+	}
+	if err := setProductDeleteRule(db, "stock_movements", "SET NULL"); err != nil {
+		return err
+	}
+
+	// Stock that predates the ledger is carried in as an opening balance the
+	// first time the ledger is created.
+	openingBalances := `
+	INSERT INTO stock_movements (product_id, product_name, type, quantity, stock_after, reason)
+	SELECT id, name, 'adjustment', stock, stock, 'opening balance'
+	FROM product
+	WHERE stock <> 0 AND NOT EXISTS (SELECT 1 FROM stock_movements)
+	ORDER BY id;`
+	if _, err := db.Exec(openingBalances); err != nil {
+		return fmt.Errorf("failed to record opening stock balances: %w", err)
+	}
+
+	if err := addColumnIfNotExists(db, "product", "cost_price", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// expected and stock_at_count are product.stock read under the product's
+	// row lock, which every stock movement also takes, when the stocktake
+	// opened and when the count was taken.
+	createStocktakeTables := `
+	CREATE TABLE IF NOT EXISTS stocktakes (
+		id SERIAL PRIMARY KEY,
+		category_id INT REFERENCES category(id) ON DELETE SET NULL,
+		category_name VARCHAR(100),
+		status VARCHAR(10) NOT NULL DEFAULT 'open',
+		note TEXT,
+		opened_by VARCHAR(100) NOT NULL,
+		opened_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		closed_by VARCHAR(100),
+		closed_at TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS stocktake_lines (
+		stocktake_id INT NOT NULL REFERENCES stocktakes(id) ON DELETE CASCADE,
+		product_id INT NOT NULL REFERENCES product(id) ON DELETE CASCADE,
+		product_name VARCHAR(100) NOT NULL,
+		unit VARCHAR(10) NOT NULL,
+		unit_cost BIGINT NOT NULL,
+		expected NUMERIC(14, 3) NOT NULL,
+		PRIMARY KEY (stocktake_id, product_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_stocktake_lines_product_id ON stocktake_lines (product_id);
+	CREATE TABLE IF NOT EXISTS stocktake_counts (
+		stocktake_id INT NOT NULL,
+		product_id INT NOT NULL,
+		counted_by VARCHAR(100) NOT NULL,
+		quantity NUMERIC(14, 3) NOT NULL CHECK (quantity >= 0),
+		stock_at_count NUMERIC(14, 3) NOT NULL,
+		counted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (stocktake_id, product_id, counted_by),
+		FOREIGN KEY (stocktake_id, product_id) REFERENCES stocktake_lines(stocktake_id, product_id) ON DELETE CASCADE
+	);`
+	if _, err := db.Exec(createStocktakeTables); err != nil {
+		return fmt.Errorf("failed to create stocktake tables: %w", err)
+	}
+	if err := migrateCurrencyColumn(db, "stocktakes", currency); err != nil {
+		return err
+	}
+
+	// Counts used to mark how far the ledger had got by the highest
+	// stock_movements ID, which a sale committing out of ID order could slip
+	// under. The stock each mark stood for is carried into stock_at_count.
+	if err := addColumnIfNotExists(db, "stocktake_counts", "stock_at_count", "NUMERIC(14, 3)"); err != nil {
+		return err
+	}
+	var hasMovementMark bool
+	err = db.QueryRow(`
+	SELECT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = 'stocktake_counts' AND column_name = 'movement_mark'
+	);`).Scan(&hasMovementMark)
+	if err != nil {
+		return fmt.Errorf("failed to check stocktake_counts.movement_mark column: %w", err)
+	}
+	if hasMovementMark {
+		log.Println("Replacing stocktake movement marks with stock at count...")
+		replaceMarks := `
+		UPDATE stocktake_counts c
+		SET stock_at_count = l.expected + COALESCE((
+			SELECT SUM(m.quantity) FROM stock_movements m
+			WHERE m.product_id = c.product_id AND m.id > s.opened_mark AND m.id <= c.movement_mark
+		), 0)
+		FROM stocktake_lines l, stocktakes s
+		WHERE l.stocktake_id = c.stocktake_id AND l.product_id = c.product_id AND s.id = c.stocktake_id;
+		ALTER TABLE stocktake_counts DROP COLUMN movement_mark;
+		ALTER TABLE stocktakes DROP COLUMN opened_mark;`
+		if _, err := db.Exec(replaceMarks); err != nil {
+			return fmt.Errorf("failed to replace stocktake movement marks: %w", err)
+		}
+		log.Println("Stocktake movement marks replaced successfully")
+	}
+	if _, err := db.Exec("ALTER TABLE stocktake_counts ALTER COLUMN stock_at_count SET NOT NULL"); err != nil {
+		return fmt.Errorf("failed to require stocktake_counts.stock_at_count: %w", err)
+	}
+
+	// Order and receipt lines keep the product's name, like sale lines, so
+	// they still read correctly once a product is deleted.
+	createPurchasingTables := `
+	CREATE TABLE IF NOT EXISTS suppliers (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		contact_name VARCHAR(100),
+		phone VARCHAR(30),
+		email VARCHAR(255),
+		address TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS purchase_orders (
+		id SERIAL PRIMARY KEY,
+		supplier_id INT NOT NULL REFERENCES suppliers(id),
+		status VARCHAR(20) NOT NULL DEFAULT 'draft',
+		note TEXT,
+		created_by VARCHAR(100) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		sent_at TIMESTAMP,
+		closed_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_purchase_orders_supplier_id ON purchase_orders (supplier_id);
+	CREATE INDEX IF NOT EXISTS idx_purchase_orders_open ON purchase_orders (status) WHERE status IN ('sent', 'partially_received');
+	CREATE TABLE IF NOT EXISTS purchase_order_lines (
+		id SERIAL PRIMARY KEY,
+		purchase_order_id INT NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+		product_id INT REFERENCES product(id) ON DELETE SET NULL,
+		product_name VARCHAR(100) NOT NULL,
+		unit VARCHAR(10) NOT NULL,
+		quantity NUMERIC(14, 3) NOT NULL CHECK (quantity > 0),
+		received NUMERIC(14, 3) NOT NULL DEFAULT 0,
+		unit_cost BIGINT NOT NULL CHECK (unit_cost >= 0),
+		UNIQUE (purchase_order_id, product_id)
+	);
+	CREATE TABLE IF NOT EXISTS goods_receipts (
+		id SERIAL PRIMARY KEY,
+		purchase_order_id INT NOT NULL REFERENCES purchase_orders(id),
+		received_by VARCHAR(100) NOT NULL,
+		note TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_goods_receipts_purchase_order_id ON goods_receipts (purchase_order_id);
+	CREATE TABLE IF NOT EXISTS goods_receipt_lines (
+		id SERIAL PRIMARY KEY,
+		goods_receipt_id INT NOT NULL REFERENCES goods_receipts(id) ON DELETE CASCADE,
+		purchase_order_line_id INT NOT NULL REFERENCES purchase_order_lines(id),
+		product_id INT REFERENCES product(id) ON DELETE SET NULL,
+		product_name VARCHAR(100) NOT NULL,
+		quantity NUMERIC(14, 3) NOT NULL CHECK (quantity > 0),
+		unit_cost BIGINT NOT NULL CHECK (unit_cost >= 0)
+	);
+	CREATE INDEX IF NOT EXISTS idx_goods_receipt_lines_goods_receipt_id ON goods_receipt_lines (goods_receipt_id);`
+	if _, err := db.Exec(createPurchasingTables); err != nil {
+		return fmt.Errorf("failed to create purchasing tables: %w", err)
+	}
+	if err := migrateCurrencyColumn(db, "purchase_orders", currency); err != nil {
+		return err
+	}
+
+	if err := addColumnIfNotExists(db, "stock_movements", "goods_receipt_id", "INT REFERENCES goods_receipts(id)"); err != nil {
+		return err
+	}
+
+	// Movements and sales from before costing are valued at today's cost
+	// price. The columns start out nullable so only those rows are touched.
+	if err := addColumnIfNotExists(db, "stock_movements", "unit_cost", "BIGINT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "stock_movements", "value", "BIGINT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "transaction_details", "cost_amount", "BIGINT"); err != nil {
+		return err
+	}
+	backfillCosts := `
+	UPDATE stock_movements m SET unit_cost = p.cost_price, value = ROUND(m.quantity * p.cost_price)
+	FROM product p
+	WHERE p.id = m.product_id AND m.value IS NULL;
+	ALTER TABLE stock_movements ALTER COLUMN unit_cost SET NOT NULL, ALTER COLUMN value SET NOT NULL;
+	UPDATE transaction_details td SET cost_amount = COALESCE((
+		SELECT ROUND(td.quantity * p.cost_price) FROM product p WHERE p.id = td.product_id
+	), 0)
+	WHERE td.cost_amount IS NULL;
+	ALTER TABLE transaction_details ALTER COLUMN cost_amount SET DEFAULT 0, ALTER COLUMN cost_amount SET NOT NULL;`
+	if _, err := db.Exec(backfillCosts); err != nil {
+		return fmt.Errorf("failed to backfill stock costs: %w", err)
+	}
+
+	// A cost layer is stock that came in together at one cost and is not all
+	// gone yet. A deleted product's layers are closed out and kept.
+	createCostLayersTable := `
+	CREATE TABLE IF NOT EXISTS cost_layers (
+		id SERIAL PRIMARY KEY,
+		product_id INT REFERENCES product(id) ON DELETE SET NULL,
+		unit_cost BIGINT NOT NULL,
+		quantity NUMERIC(14, 3) NOT NULL CHECK (quantity > 0),
+		remaining NUMERIC(14, 3) NOT NULL CHECK (remaining >= 0),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_cost_layers_product_id ON cost_layers (product_id) WHERE remaining > 0;`
+	if _, err := db.Exec(createCostLayersTable); err != nil {
+		return fmt.Errorf("failed to create cost_layers table: %w", err)
+	}
+	if _, err := db.Exec("ALTER TABLE cost_layers ALTER COLUMN product_id DROP NOT NULL"); err != nil {
+		return fmt.Errorf("failed to alter cost_layers.product_id: %w", err)
+	}
+	if err := setProductDeleteRule(db, "cost_layers", "SET NULL"); err != nil {
+		return err
+	}
+
+	// Stock on hand before cost layers is carried in as one layer per
+	// product at its cost price, only when there are no layers yet.
+	_, err = db.Exec(`
+	INSERT INTO cost_layers (product_id, unit_cost, quantity, remaining)
+	SELECT id, cost_price, stock, stock
+	FROM product
+	WHERE stock > 0 AND NOT EXISTS (SELECT 1 FROM cost_layers)
+	ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("failed to backfill cost layers: %w", err)
+	}
+
+	if err := addColumnIfNotExists(db, "product", "reorder_point", "NUMERIC(14, 3) NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "product", "reorder_quantity", "NUMERIC(14, 3) NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(db, "product", "preferred_supplier_id",
+		"INT REFERENCES suppliers(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+
 	log.Println("Database migrations completed")
 	return nil
 }
+
+// migrateColumnToNumeric changes an integer column to the given NUMERIC type.
+// Columns that are already non-integer are left alone, and so are BIGINT
+// ones, which hold amounts in minor units.
+func migrateColumnToNumeric(db *sql.DB, table, column, numericType string) error {
+	var dataType string
+	checkTypeQuery := `
+	SELECT data_type
+	FROM information_schema.columns
+	WHERE table_schema = 'public' AND table_name = $1 AND column_name = $2;`
+	if err := db.QueryRow(checkTypeQuery, table, column).Scan(&dataType); err != nil {
+		return fmt.Errorf("failed to check %s.%s column type: %w", table, column, err)
+	}
+	if dataType != "integer" && dataType != "smallint" {
+		return nil
+	}
+
+	log.Printf("Migrating %s.%s column from integer to numeric...", table, column)
+	alterQuery := fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" TYPE %s`, table, column, numericType)
+	if _, err := db.Exec(alterQuery); err != nil {
+		return fmt.Errorf("failed to alter %s.%s column type: %w", table, column, err)
+	}
+	log.Printf("%s.%s column migrated to numeric successfully", table, column)
+
+	return nil
+}
+
+// migrateColumnToMinorUnits changes an INT or NUMERIC column of amounts in
+// whole currency units to BIGINT minor units of a currency with exp decimal
+// places. BIGINT columns are already in minor units and are left alone.
+func migrateColumnToMinorUnits(db *sql.DB, table, column string, exp int) error {
+	var dataType string
+	checkTypeQuery := `
+	SELECT data_type
+	FROM information_schema.columns
+	WHERE table_schema = 'public' AND table_name = $1 AND column_name = $2;`
+	if err := db.QueryRow(checkTypeQuery, table, column).Scan(&dataType); err != nil {
+		return fmt.Errorf("failed to check %s.%s column type: %w", table, column, err)
+	}
+	if dataType != "integer" && dataType != "smallint" && dataType != "numeric" {
+		return nil
+	}
+
+	log.Printf("Migrating %s.%s column to minor units...", table, column)
+	factor := 1
+	for i := 0; i < exp; i++ {
+		factor *= 10
+	}
+	alterQuery := fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" TYPE BIGINT USING ROUND("%s"::numeric * %d)`,
+		table, column, column, factor)
+	if _, err := db.Exec(alterQuery); err != nil {
+		return fmt.Errorf("failed to alter %s.%s column type: %w", table, column, err)
+	}
+	log.Printf("%s.%s column migrated to minor units successfully", table, column)
+
+	return nil
+}
+
+// migrateCurrencyColumn gives table a currency column, filled in with
+// currency for the rows already there. Amounts are read back in the
+// configured currency, so rows recorded in any other one are an error.
+func migrateCurrencyColumn(db *sql.DB, table, currency string) error {
+	if err := addColumnIfNotExists(db, table, "currency", "CHAR(3) NOT NULL DEFAULT "+pq.QuoteLiteral(currency)); err != nil {
+		return err
+	}
+
+	var other string
+	checkQuery := fmt.Sprintf(`SELECT currency FROM "%s" WHERE currency <> $1 LIMIT 1`, table)
+	err := db.QueryRow(checkQuery, currency).Scan(&other)
+	if err == nil {
+		return fmt.Errorf("%s holds amounts in %s but the configured currency is %s", table, other, currency)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check %s currency: %w", table, err)
+	}
+
+	setDefault := fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN currency SET DEFAULT %s`, table, pq.QuoteLiteral(currency))
+	if _, err := db.Exec(setDefault); err != nil {
+		return fmt.Errorf("failed to set %s currency default: %w", table, err)
+	}
+
+	return nil
+}
+
+// addColumnIfNotExists adds column to table with the given definition unless
+// the column is already there.
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	checkQuery := `
+	SELECT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = $1 AND column_name = $2
+	);`
+	if err := db.QueryRow(checkQuery, table, column).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check %s.%s column: %w", table, column, err)
+	}
+	if exists {
+		return nil
+	}
+
+	log.Printf("Adding %s column to %s table...", column, table)
+	alterQuery := fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s" %s`, table, column, definition)
+	if _, err := db.Exec(alterQuery); err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
+	}
+	log.Printf("%s.%s column added successfully", table, column)
+
+	return nil
+}
+
+// setProductDeleteRule recreates table's product_id foreign key with rule as
+// its ON DELETE action when it has a different one.
+func setProductDeleteRule(db *sql.DB, table, rule string) error {
+	var deleteRule string
+	checkQuery := `
+	SELECT rc.delete_rule
+	FROM information_schema.referential_constraints rc
+	JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = rc.constraint_name
+	WHERE kcu.table_name = $1 AND kcu.column_name = 'product_id';`
+	if err := db.QueryRow(checkQuery, table).Scan(&deleteRule); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check %s product foreign key: %w", table, err)
+	}
+	if deleteRule == rule {
+		return nil
+	}
+
+	log.Printf("Changing %s.product_id foreign key to ON DELETE %s...", table, rule)
+	alterQuery := fmt.Sprintf(`
+	ALTER TABLE "%[1]s" DROP CONSTRAINT IF EXISTS %[1]s_product_id_fkey;
+	ALTER TABLE "%[1]s"
+	ADD CONSTRAINT %[1]s_product_id_fkey
+	FOREIGN KEY (product_id)
+	REFERENCES product(id)
+	ON DELETE %[2]s;`, table, rule)
+	if _, err := db.Exec(alterQuery); err != nil {
+		return fmt.Errorf("failed to alter %s product foreign key: %w", table, err)
+	}
+	log.Printf("%s.product_id foreign key updated successfully", table)
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"cashier-api/money"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emptyDB creates a database of its own next to the one in TEST_DB_CONN and
+// drops it when the test ends; tests that need one are skipped without it.
+func emptyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn := os.Getenv("TEST_DB_CONN")
+	if conn == "" {
+		t.Skip("TEST_DB_CONN is not set")
+	}
+	admin, err := InitDB(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := fmt.Sprintf("cashier_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// TEST_DB_CONN is either a URL or key=value pairs, where the last
+	// dbname wins.
+	if u, err := url.Parse(conn); err == nil && strings.HasPrefix(u.Scheme, "postgres") {
+		u.Path = "/" + name
+		conn = u.String()
+	} else {
+		conn += " dbname=" + name
+	}
+	db, err := InitDB(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateConvertsWholeAmountsToTheConfiguredCurrency(t *testing.T) {
+	db := emptyDB(t)
+	money.SetDefaultCurrency("USD")
+	t.Cleanup(func() { money.SetDefaultCurrency("IDR") })
+
+	// The schema and rows of a database from before amounts were exact.
+	legacy := `
+	CREATE TABLE category (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		description TEXT
+	);
+	CREATE TABLE product (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		price INT NOT NULL,
+		stock INT NOT NULL,
+		category_id INT REFERENCES category(id) ON DELETE SET NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE transaction (
+		id SERIAL PRIMARY KEY,
+		total_amount INT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE transaction_details (
+		id SERIAL PRIMARY KEY,
+		transaction_id INT REFERENCES transaction(id) ON DELETE CASCADE,
+		product_id INT REFERENCES product(id),
+		quantity INT NOT NULL,
+		subtotal INT NOT NULL
+	);
+	INSERT INTO product (name, price, stock) VALUES ('Coffee', 3, 10);
+	INSERT INTO "transaction" (total_amount) VALUES (6);
+	INSERT INTO transaction_details (transaction_id, product_id, quantity, subtotal) VALUES (1, 1, 2, 6);`
+	if _, err := db.Exec(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second run finds everything migrated and must leave it as it is.
+	for run := 1; run <= 2; run++ {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+
+		var price, total, subtotal, unitPrice int64
+		var productCurrency, transactionCurrency string
+		err := db.QueryRow(`
+			SELECT p.price, p.currency, t.total_amount, t.currency, td.subtotal, td.unit_price
+			FROM transaction_details td
+			JOIN product p ON p.id = td.product_id
+			JOIN "transaction" t ON t.id = td.transaction_id`).
+			Scan(&price, &productCurrency, &total, &transactionCurrency, &subtotal, &unitPrice)
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if price != 300 || unitPrice != 300 || subtotal != 600 || total != 600 {
+			t.Errorf("run %d: price %d, unit price %d, subtotal %d, total %d cents; want 300, 300, 600 and 600",
+				run, price, unitPrice, subtotal, total)
+		}
+		if productCurrency != "USD" || transactionCurrency != "USD" {
+			t.Errorf("run %d: product in %s and transaction in %s, want USD", run, productCurrency, transactionCurrency)
+		}
+	}
+
+	// Once amounts are recorded in USD, starting up in another currency
+	// would read them back wrong.
+	money.SetDefaultCurrency("IDR")
+	if err := Migrate(db); err == nil {
+		t.Error("Migrate with IDR configured over USD amounts succeeded, want an error")
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"cashier-api/money"
 	"database/sql"
 	"fmt"
 	"log"
@@ -42,12 +43,12 @@ func Seed(db *sql.DB) error {
 	if err == nil {
 		products := []struct {
 			Name       string
-			Price      float64
+			Price      money.Money
 			Stock      int
 			CategoryID int
 		}{
-			{"Smartphone", 699.99, 50, electronicsID},
-			{"Laptop", 1299.99, 20, electronicsID},
+			{"Smartphone", money.MustParse("699.99"), 50, electronicsID},
+			{"Laptop", money.MustParse("1299.99"), 20, electronicsID},
 		}
 
 		for _, p := range products {
@@ -59,7 +60,14 @@ func Seed(db *sql.DB) error {
 			}
 
 			if !exists {
-				_, err := db.Exec("INSERT INTO product (name, price, stock, category_id) VALUES ($1, $2, $3, $4)",
+				_, err := db.Exec(`
+					WITH seeded AS (
+						INSERT INTO product (name, price, stock, category_id) VALUES ($1, $2, $3, $4)
+						RETURNING id, name, stock
+					)
+					INSERT INTO stock_movements
+						(product_id, product_name, type, quantity, stock_after, unit_cost, value, reason)
+					SELECT id, name, 'adjustment', stock, stock, 0, 0, 'opening stock' FROM seeded`,
 					p.Name, p.Price, p.Stock, p.CategoryID)
 				if err != nil {
 					return fmt.Errorf("failed to seed product %s: %w", p.Name, err)
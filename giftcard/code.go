@@ -0,0 +1,63 @@
+// Package giftcard generates and checks gift card and voucher codes.
+package giftcard
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// CodeLength is the number of digits in a code, check digit included.
+const CodeLength = 16
+
+// NewCode returns a random code whose last digit is a Luhn check digit, so a
+// mistyped digit or swapped pair is caught before the database is asked.
+func NewCode() (string, error) {
+	digits := make([]byte, CodeLength)
+	ten := big.NewInt(10)
+	for i := 0; i < CodeLength-1; i++ {
+		n, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + n.Int64())
+	}
+	// The first digit is never zero so codes survive spreadsheets that
+	// strip leading zeros.
+	if digits[0] == '0' {
+		digits[0] = '1'
+	}
+	digits[CodeLength-1] = checkDigit(digits[:CodeLength-1])
+	return string(digits), nil
+}
+
+// Valid reports whether code has the right length, only digits, and a
+// matching check digit.
+func Valid(code string) bool {
+	if len(code) != CodeLength {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+	return checkDigit([]byte(code[:CodeLength-1])) == code[CodeLength-1]
+}
+
+// checkDigit computes the Luhn check digit for payload.
+func checkDigit(payload []byte) byte {
+	sum := 0
+	double := true
+	for i := len(payload) - 1; i >= 0; i-- {
+		d := int(payload[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
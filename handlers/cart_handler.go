@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/quantity"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CartHandler struct {
+	service      services.CartServiceInput
+	transactions *services.TransactionService
+	useLock      bool
+}
+
+func NewCartHandler(service services.CartServiceInput, transactions *services.TransactionService, useLock bool) *CartHandler {
+	return &CartHandler{service: service, transactions: transactions, useLock: useLock}
+}
+
+func (h *CartHandler) HandleCarts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleCartByID serves /api/carts/{id}, /api/carts/{id}/items[/{product_id}]
+// and the hold, resume and checkout actions.
+func (h *CartHandler) HandleCartByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/carts/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid cart ID")
+		return
+	}
+
+	if rest, ok := strings.CutPrefix(action, "items/"); ok {
+		productID, err := strconv.Atoi(rest)
+		if err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid product ID")
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			h.UpdateItem(w, r, id, productID)
+		case http.MethodDelete:
+			h.RemoveItem(w, r, id, productID)
+		default:
+			utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "items" && r.Method == http.MethodPost:
+		h.AddItem(w, r, id)
+	case action == "hold" && r.Method == http.MethodPost:
+		h.Hold(w, r, id)
+	case action == "resume" && r.Method == http.MethodPost:
+		h.Resume(w, r, id)
+	case action == "checkout" && r.Method == http.MethodPost:
+		h.Checkout(w, r, id)
+	case action == "" || action == "items" || action == "hold" || action == "resume" || action == "checkout":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *CartHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	carts, err := h.service.GetAll(r.URL.Query().Get("status"))
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, carts)
+}
+
+func (h *CartHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	for _, item := range req.Items {
+		if msg := validateCheckoutItem(item); msg != "" {
+			utils.Error(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	cart, err := h.service.Create(req)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, cart)
+}
+
+func (h *CartHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	cart, err := h.service.GetByID(id)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cart)
+}
+
+func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request, id int) {
+	var item models.CheckoutItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if msg := validateCheckoutItem(item); msg != "" {
+		utils.Error(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	cart, err := h.service.AddItem(id, item)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cart)
+}
+
+func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request, id, productID int) {
+	var body struct {
+		Quantity quantity.Quantity `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if body.Quantity < 0 {
+		utils.Error(w, http.StatusBadRequest, "Item quantity must not be negative")
+		return
+	}
+
+	cart, err := h.service.SetItemQuantity(id, productID, body.Quantity)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cart)
+}
+
+func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request, id, productID int) {
+	cart, err := h.service.SetItemQuantity(id, productID, 0)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cart)
+}
+
+func (h *CartHandler) Hold(w http.ResponseWriter, r *http.Request, id int) {
+	cart, err := h.service.Hold(id)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cart)
+}
+
+func (h *CartHandler) Resume(w http.ResponseWriter, r *http.Request, id int) {
+	cart, err := h.service.Resume(id)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cart)
+}
+
+// Checkout runs the cart through the regular checkout, Idempotency-Key
+// included.
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request, id int) {
+	var body models.CartCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req := models.CheckoutRequest{ShiftID: body.ShiftID, CartID: id, CustomerID: body.CustomerID, Payments: body.Payments}
+	if req.ShiftID <= 0 {
+		utils.Error(w, http.StatusBadRequest, "shift_id is required")
+		return
+	}
+	if msg := validateCheckoutRequest(req); msg != "" {
+		utils.Error(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		utils.Error(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return
+	}
+
+	transaction, err := h.transactions.Checkout(req, h.useLock, idempotencyKey)
+	if errors.Is(err, models.ErrCartNotFound) {
+		utils.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeCheckoutError(w, err)
+		return
+	}
+
+	writeCheckoutResponse(w, transaction)
+}
+
+func writeCartError(w http.ResponseWriter, err error) {
+	var stockErr *models.InsufficientStockError
+	switch {
+	case errors.Is(err, models.ErrCartNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrCartNotActive), errors.Is(err, models.ErrCartNotHeld),
+		errors.Is(err, models.ErrCartExpired):
+		utils.Error(w, http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrInvalidCartItem), errors.Is(err, models.ErrUnknownProductCode),
+		errors.Is(err, models.ErrInvalidQuantity):
+		utils.Error(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.As(err, &stockErr):
+		utils.JSON(w, http.StatusConflict, map[string]interface{}{
+			"error": "insufficient stock",
+			"items": stockErr.Items,
+		})
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
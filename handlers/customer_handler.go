@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+type CustomerHandler struct {
+	service      services.CustomerServiceInput
+	transactions *services.TransactionService
+}
+
+func NewCustomerHandler(service services.CustomerServiceInput, transactions *services.TransactionService) *CustomerHandler {
+	return &CustomerHandler{service: service, transactions: transactions}
+}
+
+func (h *CustomerHandler) HandleCustomers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleCustomerByID serves /api/customers/{id} and its transactions and
+// points listings.
+func (h *CustomerHandler) HandleCustomerByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/customers/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid customer ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "" && r.Method == http.MethodPut:
+		h.Update(w, r, id)
+	case action == "" && r.Method == http.MethodDelete:
+		h.Delete(w, r, id)
+	case action == "transactions" && r.Method == http.MethodGet:
+		h.GetTransactions(w, r, id)
+	case action == "points" && r.Method == http.MethodGet:
+		h.GetPoints(w, r, id)
+	case action == "" || action == "transactions" || action == "points":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// GetAll lists customers, narrowed by ?q= to a member number, phone, email or
+// part of a name.
+func (h *CustomerHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	customers, err := h.service.GetAll(r.URL.Query().Get("q"))
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, customers)
+}
+
+func (h *CustomerHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.service.Create(&customer); err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, customer)
+}
+
+func (h *CustomerHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	customer, err := h.service.GetByID(id)
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) Update(w http.ResponseWriter, r *http.Request, id int) {
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	customer.ID = id
+
+	if err := h.service.Update(&customer); err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, customer)
+}
+
+func (h *CustomerHandler) Delete(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.service.Delete(id); err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{"message": "customer deleted"})
+}
+
+// GetTransactions is the customer's purchase history, newest first, paged
+// with the same cursor and limit as /api/transactions.
+func (h *CustomerHandler) GetTransactions(w http.ResponseWriter, r *http.Request, id int) {
+	if _, err := h.service.GetByID(id); err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.TransactionFilter{CustomerID: id, Cursor: query.Get("cursor")}
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	page, err := h.transactions.GetAll(filter)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, page)
+}
+
+func (h *CustomerHandler) GetPoints(w http.ResponseWriter, r *http.Request, id int) {
+	statement, err := h.service.GetPoints(id)
+	if err != nil {
+		writeCustomerError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, statement)
+}
+
+func writeCustomerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrCustomerNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidCustomer):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrDuplicateCustomer):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type GiftCardHandler struct {
+	service services.GiftCardServiceInput
+}
+
+func NewGiftCardHandler(service services.GiftCardServiceInput) *GiftCardHandler {
+	return &GiftCardHandler{service: service}
+}
+
+func (h *GiftCardHandler) HandleGiftCards(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Issue(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleGiftCardByCode serves /api/gift-cards/{code}, which doubles as the
+// balance check, and its activate, top-up and entries actions. Cards are
+// addressed by code rather than ID since the code is what the till scans.
+func (h *GiftCardHandler) HandleGiftCardByCode(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/gift-cards/"), "/")
+	code, action, _ := strings.Cut(rest, "/")
+	if code == "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid gift card code")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByCode(w, r, code)
+	case action == "activate" && r.Method == http.MethodPost:
+		h.Activate(w, r, code)
+	case action == "top-up" && r.Method == http.MethodPost:
+		h.TopUp(w, r, code)
+	case action == "entries" && r.Method == http.MethodGet:
+		h.GetEntries(w, r, code)
+	case action == "" || action == "activate" || action == "top-up" || action == "entries":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *GiftCardHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cards, err := h.service.GetAll(query.Get("kind"), query.Get("status"))
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, cards)
+}
+
+func (h *GiftCardHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	var req models.IssueGiftCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	card, err := h.service.Issue(req)
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, card)
+}
+
+func (h *GiftCardHandler) GetByCode(w http.ResponseWriter, r *http.Request, code string) {
+	card, err := h.service.GetByCode(code)
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, card)
+}
+
+func (h *GiftCardHandler) Activate(w http.ResponseWriter, r *http.Request, code string) {
+	card, err := h.service.Activate(code)
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, card)
+}
+
+func (h *GiftCardHandler) TopUp(w http.ResponseWriter, r *http.Request, code string) {
+	var req models.GiftCardTopUpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	card, err := h.service.TopUp(code, req.Amount)
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, card)
+}
+
+func (h *GiftCardHandler) GetEntries(w http.ResponseWriter, r *http.Request, code string) {
+	entries, err := h.service.GetEntries(code)
+	if err != nil {
+		writeGiftCardError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, entries)
+}
+
+func writeGiftCardError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrGiftCardNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidGiftCard):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrGiftCardNotActive), errors.Is(err, models.ErrGiftCardAlreadyActivated),
+		errors.Is(err, models.ErrGiftCardExpired), errors.Is(err, models.ErrGiftCardNotReloadable):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
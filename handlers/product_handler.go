@@ -5,7 +5,9 @@ import (
 	"cashier-api/services"
 	"cashier-api/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 )
 
 type ProductHandler struct {
@@ -27,16 +29,37 @@ func (h *ProductHandler) HandleProducts(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// HandleProductByID serves /api/products/{id}, the variants listing and
+// generation under it, stock receiving and adjustments, and the stock
+// ledger.
 func (h *ProductHandler) HandleProductByID(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/products/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
 		h.GetByID(w, r)
-	case http.MethodPut:
+	case action == "" && r.Method == http.MethodPut:
 		h.Update(w, r)
-	case http.MethodDelete:
+	case action == "" && r.Method == http.MethodDelete:
 		h.Delete(w, r)
-	default:
+	case action == "variants" && r.Method == http.MethodGet:
+		h.GetVariants(w, r, id)
+	case action == "variants" && r.Method == http.MethodPost:
+		h.GenerateVariants(w, r, id)
+	case action == "stock" && r.Method == http.MethodPost:
+		h.ReceiveStock(w, r, id)
+	case action == "adjustments" && r.Method == http.MethodPost:
+		h.AdjustStock(w, r, id)
+	case action == "movements" && r.Method == http.MethodGet:
+		h.GetMovements(w, r, id)
+	case action == "" || action == "variants" || action == "stock" || action == "adjustments" || action == "movements":
 		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
 	}
 }
 
@@ -45,8 +68,9 @@ func (h *ProductHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	page := query.Get("page")
 	limit := query.Get("limit")
 	name := query.Get("name")
+	grouped, _ := strconv.ParseBool(query.Get("group_variants"))
 
-	products, err := h.service.GetAll(page, limit, name)
+	products, err := h.service.GetAll(page, limit, name, grouped)
 	if err != nil {
 		utils.Error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -65,7 +89,7 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	err = h.service.Create(&product)
 	if err != nil {
-		utils.Error(w, http.StatusInternalServerError, err.Error())
+		writeProductError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -105,7 +129,7 @@ func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 	product.ID = id
 	err = h.service.Update(&product)
 	if err != nil {
-		utils.Error(w, http.StatusBadRequest, err.Error())
+		writeProductError(w, err, http.StatusBadRequest)
 		return
 	}
 
@@ -121,9 +145,173 @@ func (h *ProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	err = h.service.Delete(id)
 	if err != nil {
-		utils.Error(w, http.StatusInternalServerError, err.Error())
+		writeProductError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	utils.JSON(w, http.StatusOK, map[string]string{"message": "product deleted"})
 }
+
+func (h *ProductHandler) GetVariants(w http.ResponseWriter, r *http.Request, id int) {
+	variants, err := h.service.GetVariants(id)
+	if err != nil {
+		writeProductError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, variants)
+}
+
+// GenerateVariants sets the product's option axes and creates any variants
+// missing from them; re-posting with an extra value adds just the new ones.
+func (h *ProductHandler) GenerateVariants(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.GenerateVariantsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	variants, err := h.service.GenerateVariants(id, req)
+	if err != nil {
+		writeProductError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, variants)
+}
+
+// ReceiveStock adds stock counted in the product's unit or in one of its
+// packs.
+func (h *ProductHandler) ReceiveStock(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.ReceiveStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	product, err := h.service.ReceiveStock(id, req)
+	if err != nil {
+		writeProductError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, product)
+}
+
+// AdjustStock writes off, transfers or corrects stock with a reason.
+func (h *ProductHandler) AdjustStock(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	movement, err := h.service.AdjustStock(id, req)
+	if err != nil {
+		writeProductError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, movement)
+}
+
+func (h *ProductHandler) GetMovements(w http.ResponseWriter, r *http.Request, id int) {
+	movements, err := h.service.GetMovements(id)
+	if err != nil {
+		writeProductError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, movements)
+}
+
+// HandleLookup serves GET /api/products/lookup?barcode= or ?sku=, the path a
+// scanner hits for every item.
+func (h *ProductHandler) HandleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	code, sku := query.Get("barcode"), query.Get("sku")
+	if (code == "") == (sku == "") {
+		utils.Error(w, http.StatusBadRequest, "Give exactly one of barcode or sku")
+		return
+	}
+
+	product, err := h.service.Lookup(code, sku)
+	if err != nil {
+		writeProductError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, product)
+}
+
+// HandleLowStock serves GET /api/products/low-stock: products at or below
+// their reorder point, narrowed by ?supplier_id=. Average daily sales are
+// taken over the last ?days= days, 30 by default, and ?cover_days= raises
+// each suggestion to cover that many days of them.
+func (h *ProductHandler) HandleLowStock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	opts, invalid := reorderOptions(r)
+	if invalid != "" {
+		utils.Error(w, http.StatusBadRequest, "Invalid "+invalid)
+		return
+	}
+
+	products, err := h.service.GetLowStock(opts)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, products)
+}
+
+// reorderOptions reads ?days=, ?cover_days= and ?supplier_id=, naming the
+// first one that is not a whole number of zero or more.
+func reorderOptions(r *http.Request) (models.ReorderOptions, string) {
+	var opts models.ReorderOptions
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"days", &opts.SalesWindowDays},
+		{"cover_days", &opts.CoverDays},
+		{"supplier_id", &opts.SupplierID},
+	} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, p.name
+		}
+		*p.value = n
+	}
+	return opts, ""
+}
+
+// writeProductError maps the product errors and falls back to fallback for
+// anything else.
+func writeProductError(w http.ResponseWriter, err error, fallback int) {
+	switch {
+	case errors.Is(err, models.ErrProductNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidProduct), errors.Is(err, models.ErrInvalidQuantity),
+		errors.Is(err, models.ErrInvalidStockAdjustment):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrDuplicateProductCode), errors.Is(err, models.ErrProductHasVariants),
+		errors.Is(err, models.ErrProductIsComponent):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, fallback, err.Error())
+	}
+}
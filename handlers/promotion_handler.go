@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type PromotionHandler struct {
+	service services.PromotionServiceInput
+}
+
+func NewPromotionHandler(service services.PromotionServiceInput) *PromotionHandler {
+	return &PromotionHandler{service: service}
+}
+
+func (h *PromotionHandler) HandlePromotions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *PromotionHandler) HandlePromotionByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r, "/api/promotions/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid promotion ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.GetByID(w, r, id)
+	case http.MethodPut:
+		h.Update(w, r, id)
+	case http.MethodDelete:
+		h.Delete(w, r, id)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *PromotionHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.service.GetAll()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, promotions)
+}
+
+func (h *PromotionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var promotion models.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	err := h.service.Create(&promotion)
+	if errors.Is(err, models.ErrInvalidPromotion) {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, promotion)
+}
+
+func (h *PromotionHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	promotion, err := h.service.GetByID(id)
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, promotion)
+}
+
+func (h *PromotionHandler) Update(w http.ResponseWriter, r *http.Request, id int) {
+	var promotion models.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	promotion.ID = id
+
+	err := h.service.Update(&promotion)
+	if errors.Is(err, models.ErrInvalidPromotion) {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, promotion)
+}
+
+func (h *PromotionHandler) Delete(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.service.Delete(id); err != nil {
+		utils.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{"message": "promotion deleted"})
+}
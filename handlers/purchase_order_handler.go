@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+type PurchaseOrderHandler struct {
+	service services.PurchaseOrderServiceInput
+}
+
+func NewPurchaseOrderHandler(service services.PurchaseOrderServiceInput) *PurchaseOrderHandler {
+	return &PurchaseOrderHandler{service: service}
+}
+
+func (h *PurchaseOrderHandler) HandlePurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandlePurchaseOrderByID serves /api/purchase-orders/{id} and its send,
+// cancel and receipts actions.
+func (h *PurchaseOrderHandler) HandlePurchaseOrderByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/purchase-orders/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid purchase order ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "" && r.Method == http.MethodPut:
+		h.Update(w, r, id)
+	case action == "send" && r.Method == http.MethodPost:
+		h.Send(w, r, id)
+	case action == "cancel" && r.Method == http.MethodPost:
+		h.Cancel(w, r, id)
+	case action == "receipts" && r.Method == http.MethodPost:
+		h.Receive(w, r, id)
+	case action == "" || action == "send" || action == "cancel" || action == "receipts":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// supplierFilter reads the optional ?supplier_id= filter.
+func supplierFilter(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("supplier_id")
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// GetAll lists orders, narrowed by ?status= and ?supplier_id=.
+func (h *PurchaseOrderHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	supplierID, err := supplierFilter(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid supplier_id")
+		return
+	}
+
+	orders, err := h.service.GetAll(r.URL.Query().Get("status"), supplierID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, orders)
+}
+
+func (h *PurchaseOrderHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.PurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	order, err := h.service.Create(req)
+	if err != nil {
+		writePurchaseOrderError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, order)
+}
+
+func (h *PurchaseOrderHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	order, err := h.service.GetByID(id)
+	if err != nil {
+		writePurchaseOrderError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, order)
+}
+
+func (h *PurchaseOrderHandler) Update(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.PurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	order, err := h.service.Update(id, req)
+	if err != nil {
+		writePurchaseOrderError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, order)
+}
+
+func (h *PurchaseOrderHandler) Send(w http.ResponseWriter, r *http.Request, id int) {
+	order, err := h.service.Send(id)
+	if err != nil {
+		writePurchaseOrderError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, order)
+}
+
+func (h *PurchaseOrderHandler) Cancel(w http.ResponseWriter, r *http.Request, id int) {
+	order, err := h.service.Cancel(id)
+	if err != nil {
+		writePurchaseOrderError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, order)
+}
+
+// Receive books a delivery and responds with the goods receipt.
+func (h *PurchaseOrderHandler) Receive(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.GoodsReceiptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	receipt, err := h.service.Receive(id, req)
+	if err != nil {
+		writePurchaseOrderError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, receipt)
+}
+
+// HandleOutstanding serves GET /api/purchase-orders/outstanding: sent orders
+// still awaiting goods, grouped by supplier and narrowed by ?supplier_id=.
+func (h *PurchaseOrderHandler) HandleOutstanding(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	supplierID, err := supplierFilter(r)
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid supplier_id")
+		return
+	}
+
+	outstanding, err := h.service.GetOutstanding(supplierID)
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, outstanding)
+}
+
+// HandleSuggestions serves /api/purchase-orders/suggestions. GET groups what
+// the low products should be reordered in by preferred supplier, taking the
+// same ?days=, ?cover_days= and ?supplier_id= as the low-stock list; POST
+// raises draft orders from them.
+func (h *PurchaseOrderHandler) HandleSuggestions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		opts, invalid := reorderOptions(r)
+		if invalid != "" {
+			utils.Error(w, http.StatusBadRequest, "Invalid "+invalid)
+			return
+		}
+		suggestions, err := h.service.GetSuggestions(opts)
+		if err != nil {
+			utils.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		utils.JSON(w, http.StatusOK, suggestions)
+	case http.MethodPost:
+		var req models.CreateSuggestedOrdersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		orders, err := h.service.CreateSuggested(req)
+		if err != nil {
+			writePurchaseOrderError(w, err)
+			return
+		}
+		utils.JSON(w, http.StatusCreated, orders)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func writePurchaseOrderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrPurchaseOrderNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidPurchaseOrder), errors.Is(err, models.ErrInvalidQuantity):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrPurchaseOrderStatus):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"cashier-api/services"
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
 type ReportHandler struct {
@@ -22,6 +23,10 @@ func (h *ReportHandler) HandleReport(w http.ResponseWriter, r *http.Request) {
 
 	startDate := r.URL.Query().Get("start_date")
 	endDate := r.URL.Query().Get("end_date")
+	if !validDate(startDate) || !validDate(endDate) {
+		http.Error(w, "Dates must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
 
 	var summary interface{}
 	var err error
@@ -56,3 +61,61 @@ func (h *ReportHandler) HandleReportToday(w http.ResponseWriter, r *http.Request
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(summary)
 }
+
+// validDate accepts an empty date, meaning today, or a YYYY-MM-DD one.
+func validDate(date string) bool {
+	if date == "" {
+		return true
+	}
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+// HandleMarginReport serves GET /api/report/margin: gross profit by product
+// and category over ?start_date= to ?end_date=, each defaulting to today.
+func (h *ReportHandler) HandleMarginReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
+	if !validDate(startDate) || !validDate(endDate) {
+		http.Error(w, "Dates must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.GetMarginReport(startDate, endDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleInventoryValuation serves GET /api/report/inventory-valuation: the
+// cost of the stock on hand at the end of ?date=, today by default.
+func (h *ReportHandler) HandleInventoryValuation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if !validDate(date) {
+		http.Error(w, "Dates must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	valuation, err := h.service.GetInventoryValuation(date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(valuation)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type ShiftHandler struct {
+	service       services.ShiftServiceInput
+	reportService *services.ReportService
+}
+
+func NewShiftHandler(service services.ShiftServiceInput, reportService *services.ReportService) *ShiftHandler {
+	return &ShiftHandler{service: service, reportService: reportService}
+}
+
+func (h *ShiftHandler) HandleShifts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Open(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleShiftByID serves /api/shifts/{id} and its close, cash-movements,
+// x-report and z-report actions.
+func (h *ShiftHandler) HandleShiftByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/shifts/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid shift ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "close" && r.Method == http.MethodPost:
+		h.Close(w, r, id)
+	case action == "cash-movements" && r.Method == http.MethodPost:
+		h.AddCashMovement(w, r, id)
+	case action == "x-report" && r.Method == http.MethodGet:
+		h.GetXReport(w, r, id)
+	case action == "z-report" && r.Method == http.MethodGet:
+		h.GetZReport(w, r, id)
+	case action == "" || action == "close" || action == "cash-movements" || action == "x-report" || action == "z-report":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *ShiftHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	shifts, err := h.service.GetAll(r.URL.Query().Get("status"))
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, shifts)
+}
+
+func (h *ShiftHandler) Open(w http.ResponseWriter, r *http.Request) {
+	var req models.OpenShiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Register == "" || req.OpenedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "register and opened_by are required")
+		return
+	}
+	if req.OpeningFloat.IsNegative() {
+		utils.Error(w, http.StatusBadRequest, "opening_float must not be negative")
+		return
+	}
+
+	shift, err := h.service.Open(req)
+	if err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, shift)
+}
+
+func (h *ShiftHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	shift, err := h.service.GetByID(id)
+	if err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, shift)
+}
+
+// Close closes the shift and responds with its Z-report.
+func (h *ShiftHandler) Close(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.CloseShiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.ClosedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "closed_by is required")
+		return
+	}
+	if req.CountedCash == nil {
+		utils.Error(w, http.StatusBadRequest, "counted_cash is required")
+		return
+	}
+	if req.CountedCash.IsNegative() {
+		utils.Error(w, http.StatusBadRequest, "counted_cash must not be negative")
+		return
+	}
+
+	if _, err := h.service.Close(id, req); err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	report, err := h.reportService.GetZReport(id)
+	if err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, report)
+}
+
+func (h *ShiftHandler) AddCashMovement(w http.ResponseWriter, r *http.Request, id int) {
+	var movement models.CashMovement
+	if err := json.NewDecoder(r.Body).Decode(&movement); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if movement.Type != models.CashMovementPayIn && movement.Type != models.CashMovementPayOut {
+		utils.Error(w, http.StatusBadRequest, "type must be pay_in or pay_out")
+		return
+	}
+	if !movement.Amount.IsPositive() {
+		utils.Error(w, http.StatusBadRequest, "amount must be greater than zero")
+		return
+	}
+	if movement.Reason == "" || movement.PerformedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "reason and performed_by are required")
+		return
+	}
+	movement.ShiftID = id
+
+	if err := h.service.AddCashMovement(&movement); err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, movement)
+}
+
+func (h *ShiftHandler) GetXReport(w http.ResponseWriter, r *http.Request, id int) {
+	report, err := h.reportService.GetXReport(id)
+	if err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, report)
+}
+
+func (h *ShiftHandler) GetZReport(w http.ResponseWriter, r *http.Request, id int) {
+	report, err := h.reportService.GetZReport(id)
+	if err != nil {
+		writeShiftError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, report)
+}
+
+func writeShiftError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrShiftNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrShiftClosed), errors.Is(err, models.ErrShiftStillOpen),
+		errors.Is(err, models.ErrShiftAlreadyOpen):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type StocktakeHandler struct {
+	service services.StocktakeServiceInput
+}
+
+func NewStocktakeHandler(service services.StocktakeServiceInput) *StocktakeHandler {
+	return &StocktakeHandler{service: service}
+}
+
+func (h *StocktakeHandler) HandleStocktakes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Open(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleStocktakeByID serves /api/stocktakes/{id} and its counts, post and
+// cancel actions.
+func (h *StocktakeHandler) HandleStocktakeByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/stocktakes/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid stocktake ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "counts" && r.Method == http.MethodPost:
+		h.AddCount(w, r, id)
+	case action == "post" && r.Method == http.MethodPost:
+		h.Post(w, r, id)
+	case action == "cancel" && r.Method == http.MethodPost:
+		h.Cancel(w, r, id)
+	case action == "" || action == "counts" || action == "post" || action == "cancel":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *StocktakeHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	stocktakes, err := h.service.GetAll(r.URL.Query().Get("status"))
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, stocktakes)
+}
+
+// Open starts a stocktake of one category, or of everything when
+// category_id is left out.
+func (h *StocktakeHandler) Open(w http.ResponseWriter, r *http.Request) {
+	var req models.OpenStocktakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.OpenedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "opened_by is required")
+		return
+	}
+
+	stocktake, err := h.service.Open(req)
+	if err != nil {
+		writeStocktakeError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, stocktake)
+}
+
+func (h *StocktakeHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	stocktake, err := h.service.GetByID(id)
+	if err != nil {
+		writeStocktakeError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, stocktake)
+}
+
+// AddCount records a count and responds with the product's line.
+func (h *StocktakeHandler) AddCount(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.StocktakeCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.ProductID == 0 || req.CountedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "product_id and counted_by are required")
+		return
+	}
+	if req.Quantity < 0 {
+		utils.Error(w, http.StatusBadRequest, "quantity must not be negative")
+		return
+	}
+
+	line, err := h.service.AddCount(id, req)
+	if err != nil {
+		writeStocktakeError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, line)
+}
+
+func (h *StocktakeHandler) Post(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.PostStocktakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.PostedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "posted_by is required")
+		return
+	}
+
+	stocktake, err := h.service.Post(id, req)
+	if err != nil {
+		writeStocktakeError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, stocktake)
+}
+
+func (h *StocktakeHandler) Cancel(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.CancelStocktakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.CancelledBy == "" {
+		utils.Error(w, http.StatusBadRequest, "cancelled_by is required")
+		return
+	}
+
+	stocktake, err := h.service.Cancel(id, req)
+	if err != nil {
+		writeStocktakeError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, stocktake)
+}
+
+func writeStocktakeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrStocktakeNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidStocktake), errors.Is(err, models.ErrInvalidQuantity):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrStocktakeClosed), errors.Is(err, models.ErrStocktakeOverlap):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
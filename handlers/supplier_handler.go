@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type SupplierHandler struct {
+	service services.SupplierServiceInput
+}
+
+func NewSupplierHandler(service services.SupplierServiceInput) *SupplierHandler {
+	return &SupplierHandler{service: service}
+}
+
+func (h *SupplierHandler) HandleSuppliers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *SupplierHandler) HandleSupplierByID(w http.ResponseWriter, r *http.Request) {
+	id, err := utils.GetIDFromPath(r, "/api/suppliers/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid supplier ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.GetByID(w, r, id)
+	case http.MethodPut:
+		h.Update(w, r, id)
+	case http.MethodDelete:
+		h.Delete(w, r, id)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// GetAll lists suppliers, narrowed by ?q= to part of a name.
+func (h *SupplierHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := h.service.GetAll(r.URL.Query().Get("q"))
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, suppliers)
+}
+
+func (h *SupplierHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var supplier models.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.service.Create(&supplier); err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, supplier)
+}
+
+func (h *SupplierHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	supplier, err := h.service.GetByID(id)
+	if err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, supplier)
+}
+
+func (h *SupplierHandler) Update(w http.ResponseWriter, r *http.Request, id int) {
+	var supplier models.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	supplier.ID = id
+
+	if err := h.service.Update(&supplier); err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, supplier)
+}
+
+func (h *SupplierHandler) Delete(w http.ResponseWriter, r *http.Request, id int) {
+	if err := h.service.Delete(id); err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, map[string]string{"message": "supplier deleted"})
+}
+
+func writeSupplierError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrSupplierNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidSupplier):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrSupplierInUse):
+		utils.Error(w, http.StatusConflict, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"cashier-api/models"
+	"cashier-api/services"
+	"cashier-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type TaxRateHandler struct {
+	service services.TaxRateServiceInput
+}
+
+func NewTaxRateHandler(service services.TaxRateServiceInput) *TaxRateHandler {
+	return &TaxRateHandler{service: service}
+}
+
+func (h *TaxRateHandler) HandleTaxRates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleTaxRateByID serves /api/tax-rates/{id} and /api/tax-rates/{id}/periods.
+func (h *TaxRateHandler) HandleTaxRateByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/tax-rates/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid tax rate ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "periods" && r.Method == http.MethodPost:
+		h.AddPeriod(w, r, id)
+	case action == "" || action == "periods":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *TaxRateHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.service.GetAll()
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, rates)
+}
+
+func (h *TaxRateHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.TaxRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	rate, err := h.service.Create(req)
+	if err != nil {
+		writeTaxRateError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, rate)
+}
+
+func (h *TaxRateHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	rate, err := h.service.GetByID(id)
+	if err != nil {
+		writeTaxRateError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, rate)
+}
+
+func (h *TaxRateHandler) AddPeriod(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.TaxRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	period, err := h.service.AddPeriod(id, req)
+	if err != nil {
+		writeTaxRateError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, period)
+}
+
+func writeTaxRateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrTaxRateNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidTaxRate):
+		utils.Error(w, http.StatusBadRequest, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -2,17 +2,24 @@ package handlers
 
 import (
 	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/receipt"
 	"cashier-api/services"
+	"cashier-api/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 )
 
 type TransactionHandler struct {
-	service *services.TransactionService
+	service  *services.TransactionService
+	useLock  bool
+	receipts *receipt.Renderer
 }
 
-func NewTransactionHandler(service *services.TransactionService) *TransactionHandler {
-	return &TransactionHandler{service: service}
+func NewTransactionHandler(service *services.TransactionService, useLock bool, receipts *receipt.Renderer) *TransactionHandler {
+	return &TransactionHandler{service: service, useLock: useLock, receipts: receipts}
 }
 
 // multiple item apa aja, quantity nya
@@ -33,12 +40,380 @@ func (h *TransactionHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	transaction, err := h.service.Checkout(req.Items, false)
+	if req.ShiftID <= 0 {
+		http.Error(w, "shift_id is required", http.StatusBadRequest)
+		return
+	}
+	if msg := validateCheckoutRequest(req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := h.service.Checkout(req, h.useLock, idempotencyKey)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCheckoutError(w, err)
 		return
 	}
 
+	writeCheckoutResponse(w, transaction)
+}
+
+func writeCheckoutError(w http.ResponseWriter, err error) {
+	var stockErr *models.InsufficientStockError
+	switch {
+	case errors.Is(err, models.ErrIdempotencyKeyMismatch), errors.Is(err, models.ErrInvalidPayment),
+		errors.Is(err, models.ErrShiftNotFound), errors.Is(err, models.ErrCartNotFound),
+		errors.Is(err, models.ErrCartEmpty), errors.Is(err, models.ErrCustomerNotFound),
+		errors.Is(err, models.ErrInsufficientPoints), errors.Is(err, models.ErrGiftCardNotFound),
+		errors.Is(err, models.ErrInsufficientGiftCardBalance), errors.Is(err, models.ErrUnknownProductCode),
+		errors.Is(err, models.ErrProductHasVariants), errors.Is(err, models.ErrInvalidQuantity):
+		utils.Error(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, models.ErrShiftClosed), errors.Is(err, models.ErrCartNotActive),
+		errors.Is(err, models.ErrCartExpired), errors.Is(err, models.ErrGiftCardNotActive),
+		errors.Is(err, models.ErrGiftCardExpired):
+		utils.Error(w, http.StatusConflict, err.Error())
+	case errors.As(err, &stockErr):
+		utils.JSON(w, http.StatusConflict, map[string]interface{}{
+			"error": "insufficient stock",
+			"items": stockErr.Items,
+		})
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeCheckoutResponse(w http.ResponseWriter, transaction *models.Transaction) {
+	if transaction.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(transaction)
 }
+
+// validateCheckoutRequest returns a message describing what is wrong with the
+// cart, or "" when it can be priced.
+func validateCheckoutRequest(req models.CheckoutRequest) string {
+	if req.CartID != 0 && len(req.Items) > 0 {
+		return "items must be empty when cart_id is given"
+	}
+	if req.CartID == 0 && len(req.Items) == 0 {
+		return "Checkout requires at least one item"
+	}
+	for _, item := range req.Items {
+		if msg := validateCheckoutItem(item); msg != "" {
+			return msg
+		}
+	}
+	for _, payment := range req.Payments {
+		if !models.IsPaymentMethod(payment.Method) {
+			return "Unknown payment method: " + payment.Method
+		}
+		if !payment.Amount.IsPositive() {
+			return "Payment amount must be greater than zero"
+		}
+		if payment.Method == models.PaymentMethodGiftCard && payment.Reference == "" {
+			return "Gift card payments need the card code as reference"
+		}
+	}
+	return ""
+}
+
+// validateCheckoutItem checks that an item names its product exactly once and
+// has a positive quantity.
+func validateCheckoutItem(item models.CheckoutItem) string {
+	named := 0
+	for _, set := range []bool{item.ProductID != 0, item.Barcode != "", item.SKU != ""} {
+		if set {
+			named++
+		}
+	}
+	if named != 1 {
+		return "Each item needs exactly one of product_id, barcode or sku"
+	}
+	if item.Quantity <= 0 {
+		return "Item quantity must be greater than zero"
+	}
+	return ""
+}
+
+// HandlePreview serves POST /api/checkout/preview.
+func (h *TransactionHandler) HandlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req models.CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := validateCheckoutRequest(req); msg != "" {
+		utils.Error(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	preview, err := h.service.Preview(req)
+	if err != nil {
+		writeCheckoutError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, preview)
+}
+
+func (h *TransactionHandler) HandleTransactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetAll(w, r)
+	default:
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (h *TransactionHandler) HandleTransactionByID(w http.ResponseWriter, r *http.Request) {
+	id, action, err := utils.GetIDAndActionFromPath(r, "/api/transactions/")
+	if err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.GetByID(w, r, id)
+	case action == "void" && r.Method == http.MethodPost:
+		h.Void(w, r, id)
+	case action == "refund" && r.Method == http.MethodPost:
+		h.Refund(w, r, id)
+	case action == "returns" && r.Method == http.MethodPost:
+		h.CreateReturn(w, r, id)
+	case action == "receipt" && r.Method == http.MethodGet:
+		h.GetReceipt(w, r, id)
+	case action == "" || action == "void" || action == "refund" || action == "returns" || action == "receipt":
+		utils.Error(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		utils.Error(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *TransactionHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.TransactionFilter{
+		StartDate:     query.Get("start_date"),
+		EndDate:       query.Get("end_date"),
+		ReceiptNumber: query.Get("receipt_number"),
+		Cursor:        query.Get("cursor"),
+	}
+
+	if !validDate(filter.StartDate) || !validDate(filter.EndDate) {
+		utils.Error(w, http.StatusBadRequest, "start_date and end_date must be YYYY-MM-DD")
+		return
+	}
+	// Both are YYYY-MM-DD, so they compare as strings.
+	if filter.StartDate != "" && filter.EndDate != "" && filter.StartDate > filter.EndDate {
+		utils.Error(w, http.StatusBadRequest, "start_date must not be after end_date")
+		return
+	}
+
+	var err error
+	if filter.MinTotal, err = parseOptionalMoney(query.Get("min_total")); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid min_total")
+		return
+	}
+	if filter.MaxTotal, err = parseOptionalMoney(query.Get("max_total")); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid max_total")
+		return
+	}
+	if v := query.Get("product_id"); v != "" {
+		if filter.ProductID, err = strconv.Atoi(v); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid product_id")
+			return
+		}
+	}
+	if v := query.Get("customer_id"); v != "" {
+		if filter.CustomerID, err = strconv.Atoi(v); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid customer_id")
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			utils.Error(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	page, err := h.service.GetAll(filter)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, page)
+}
+
+func (h *TransactionHandler) GetByID(w http.ResponseWriter, r *http.Request, id int) {
+	transaction, err := h.service.GetByID(id)
+	if errors.Is(err, models.ErrTransactionNotFound) {
+		utils.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, transaction)
+}
+
+func (h *TransactionHandler) Void(w http.ResponseWriter, r *http.Request, id int) {
+	req, ok := decodeReversalRequest(w, r)
+	if !ok {
+		return
+	}
+
+	transaction, err := h.service.Void(id, req)
+	if err != nil {
+		writeReversalError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, transaction)
+}
+
+func (h *TransactionHandler) Refund(w http.ResponseWriter, r *http.Request, id int) {
+	req, ok := decodeReversalRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ret, err := h.service.Refund(id, req)
+	if err != nil {
+		writeReversalError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, ret)
+}
+
+func (h *TransactionHandler) CreateReturn(w http.ResponseWriter, r *http.Request, id int) {
+	var req models.ReturnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Reason == "" || req.PerformedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "reason and performed_by are required")
+		return
+	}
+	if len(req.Items) == 0 {
+		utils.Error(w, http.StatusBadRequest, "Return requires at least one item")
+		return
+	}
+	if req.ShiftID != 0 && req.GiftCardCode != "" {
+		utils.Error(w, http.StatusBadRequest, "shift_id and gift_card_code cannot both be given")
+		return
+	}
+
+	ret, err := h.service.CreateReturn(id, req)
+	if err != nil {
+		writeReversalError(w, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, ret)
+}
+
+// GetReceipt renders a receipt as text, escpos or pdf (default text), laid out
+// for an 80mm roll unless width=58 is given.
+func (h *TransactionHandler) GetReceipt(w http.ResponseWriter, r *http.Request, id int) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = receipt.FormatText
+	}
+
+	width := receipt.Width80mm
+	switch query.Get("width") {
+	case "", "80":
+	case "58":
+		width = receipt.Width58mm
+	default:
+		utils.Error(w, http.StatusBadRequest, "width must be 58 or 80")
+		return
+	}
+
+	transaction, err := h.service.GetByID(id)
+	if err != nil {
+		writeReversalError(w, err)
+		return
+	}
+
+	body, contentType, err := h.receipts.Render(transaction, format, width)
+	if errors.Is(err, receipt.ErrUnknownFormat) {
+		utils.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func decodeReversalRequest(w http.ResponseWriter, r *http.Request) (models.ReversalRequest, bool) {
+	var req models.ReversalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.Error(w, http.StatusBadRequest, "Invalid request payload")
+		return req, false
+	}
+	if req.Reason == "" || req.PerformedBy == "" {
+		utils.Error(w, http.StatusBadRequest, "reason and performed_by are required")
+		return req, false
+	}
+	if req.ShiftID != 0 && req.GiftCardCode != "" {
+		utils.Error(w, http.StatusBadRequest, "shift_id and gift_card_code cannot both be given")
+		return req, false
+	}
+	return req, true
+}
+
+func writeReversalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrTransactionNotFound):
+		utils.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, models.ErrTransactionNotVoidable), errors.Is(err, models.ErrTransactionNotRefundable),
+		errors.Is(err, models.ErrShiftClosed), errors.Is(err, models.ErrGiftCardNotActive),
+		errors.Is(err, models.ErrGiftCardExpired), errors.Is(err, models.ErrGiftCardNotReloadable):
+		utils.Error(w, http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrInvalidReturn), errors.Is(err, models.ErrShiftNotFound),
+		errors.Is(err, models.ErrGiftCardNotFound):
+		utils.Error(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		utils.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func parseOptionalMoney(value string) (*money.Money, error) {
+	if value == "" {
+		return nil, nil
+	}
+	m, err := money.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -6,18 +6,64 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"cashier-api/database"
 	"cashier-api/handlers"
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/receipt"
 	"cashier-api/repositories"
 	"cashier-api/services"
+	"cashier-api/tax"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port   string `mapstructure:"PORT"`
-	DBConn string `mapstructure:"DB_CONN"`
+	Port         string `mapstructure:"PORT"`
+	DBConn       string `mapstructure:"DB_CONN"`
+	CheckoutMode string `mapstructure:"CHECKOUT_MODE"`
+	// IdempotencyTTL is how long a checkout Idempotency-Key is remembered.
+	IdempotencyTTL time.Duration `mapstructure:"IDEMPOTENCY_TTL"`
+	// Currency is the ISO 4217 code all amounts are recorded in.
+	Currency string `mapstructure:"CURRENCY"`
+	// RoundingMode is half_up or half_even and applies wherever an amount
+	// has to be split or scaled.
+	RoundingMode string `mapstructure:"ROUNDING_MODE"`
+	// CashRounding is the step the cash part of a sale is rounded to, such
+	// as 100 for Rp100. Empty leaves cash at minor-unit precision.
+	CashRounding string `mapstructure:"CASH_ROUNDING"`
+	// TaxInclusive means shelf prices already contain tax (PPN-inclusive).
+	TaxInclusive bool `mapstructure:"TAX_INCLUSIVE"`
+	// ReceiptHeader and ReceiptFooter are text/template sources printed at
+	// the top and bottom of every receipt. A literal \n starts a new line.
+	ReceiptHeader string `mapstructure:"RECEIPT_HEADER"`
+	ReceiptFooter string `mapstructure:"RECEIPT_FOOTER"`
+	// StoreCode prefixes receipt numbers; ReceiptNumberReset is day, month
+	// or year and sets when the counter starts again at 1.
+	StoreCode          string `mapstructure:"STORE_CODE"`
+	ReceiptNumberReset string `mapstructure:"RECEIPT_NUMBER_RESET"`
+	// CartTTL is how long a parked or open cart lives after it was last
+	// touched.
+	CartTTL time.Duration `mapstructure:"CART_TTL"`
+	// LoyaltyEarnPer is the amount spent per loyalty point earned and
+	// LoyaltyPointValue what a point is worth when redeemed. Leaving either
+	// empty turns earning or redemption off.
+	LoyaltyEarnPer    string `mapstructure:"LOYALTY_EARN_PER"`
+	LoyaltyPointValue string `mapstructure:"LOYALTY_POINT_VALUE"`
+	// ProductLookupTTL is how long a barcode or SKU scan is answered from
+	// memory. Zero turns the cache off.
+	ProductLookupTTL time.Duration `mapstructure:"PRODUCT_LOOKUP_TTL"`
+	// BundleAllocation is list_price, quantity or equal and sets how reports
+	// attribute bundle revenue to the bundle's components.
+	BundleAllocation string `mapstructure:"BUNDLE_ALLOCATION"`
+	// CostingMethod is average or fifo and sets how stock is costed when
+	// it is sold and how receipts move a product's cost price.
+	CostingMethod string `mapstructure:"COSTING_METHOD"`
+	// LowStockWebhookURL receives a POST for every product a checkout takes
+	// down to its reorder point. Empty only logs the alerts.
+	LowStockWebhookURL string `mapstructure:"LOW_STOCK_WEBHOOK_URL"`
 }
 
 func loadConfig() Config {
@@ -30,20 +76,109 @@ func loadConfig() Config {
 	}
 
 	config := Config{
-		Port:   viper.GetString("PORT"),
-		DBConn: viper.GetString("DB_CONN"),
+		Port:               viper.GetString("PORT"),
+		DBConn:             viper.GetString("DB_CONN"),
+		CheckoutMode:       viper.GetString("CHECKOUT_MODE"),
+		IdempotencyTTL:     viper.GetDuration("IDEMPOTENCY_TTL"),
+		Currency:           viper.GetString("CURRENCY"),
+		RoundingMode:       viper.GetString("ROUNDING_MODE"),
+		CashRounding:       viper.GetString("CASH_ROUNDING"),
+		TaxInclusive:       viper.GetBool("TAX_INCLUSIVE"),
+		ReceiptHeader:      strings.ReplaceAll(viper.GetString("RECEIPT_HEADER"), `\n`, "\n"),
+		ReceiptFooter:      strings.ReplaceAll(viper.GetString("RECEIPT_FOOTER"), `\n`, "\n"),
+		StoreCode:          viper.GetString("STORE_CODE"),
+		ReceiptNumberReset: viper.GetString("RECEIPT_NUMBER_RESET"),
+		CartTTL:            viper.GetDuration("CART_TTL"),
+		LoyaltyEarnPer:     viper.GetString("LOYALTY_EARN_PER"),
+		LoyaltyPointValue:  viper.GetString("LOYALTY_POINT_VALUE"),
+		BundleAllocation:   viper.GetString("BUNDLE_ALLOCATION"),
+		CostingMethod:      viper.GetString("COSTING_METHOD"),
+		LowStockWebhookURL: viper.GetString("LOW_STOCK_WEBHOOK_URL"),
+	}
+
+	if viper.IsSet("PRODUCT_LOOKUP_TTL") {
+		config.ProductLookupTTL = viper.GetDuration("PRODUCT_LOOKUP_TTL")
+	} else {
+		config.ProductLookupTTL = 30 * time.Second
+	}
+
+	if config.IdempotencyTTL <= 0 {
+		config.IdempotencyTTL = 24 * time.Hour
+	}
+	if config.CartTTL <= 0 {
+		config.CartTTL = 30 * time.Minute
+	}
+	if config.StoreCode == "" {
+		config.StoreCode = "STR01"
+	}
+	if config.ReceiptFooter == "" {
+		config.ReceiptFooter = "Thank you for shopping with us"
 	}
 
 	return config
 }
 
+// parseCashRounding reads the cash rounding increment in the configured
+// currency and rounds to it with mode.
+func parseCashRounding(config Config, mode money.RoundingMode) (money.Rounding, error) {
+	rounding := money.Rounding{Mode: mode}
+	if config.CashRounding == "" {
+		return rounding, nil
+	}
+	increment, err := money.Parse(config.CashRounding)
+	if err != nil {
+		return rounding, fmt.Errorf("CASH_ROUNDING: %w", err)
+	}
+	if increment.IsNegative() {
+		return rounding, fmt.Errorf("CASH_ROUNDING: %s is negative", config.CashRounding)
+	}
+	rounding.Increment = increment
+	return rounding, nil
+}
+
+// parseLoyaltyRules reads the loyalty amounts in the configured currency.
+func parseLoyaltyRules(config Config) (models.LoyaltyRules, error) {
+	var rules models.LoyaltyRules
+	var err error
+	if config.LoyaltyEarnPer != "" {
+		if rules.EarnPer, err = money.Parse(config.LoyaltyEarnPer); err != nil {
+			return rules, fmt.Errorf("LOYALTY_EARN_PER: %w", err)
+		}
+	}
+	if config.LoyaltyPointValue != "" {
+		if rules.PointValue, err = money.Parse(config.LoyaltyPointValue); err != nil {
+			return rules, fmt.Errorf("LOYALTY_POINT_VALUE: %w", err)
+		}
+	}
+	return rules, nil
+}
+
 func main() {
 	migrateFlag := flag.Bool("migrate", false, "Run database migrations and exit")
 	seedFlag := flag.Bool("seed", false, "Run database seeding and exit")
+	reconcileStockFlag := flag.Bool("reconcile-stock", false,
+		"Report products whose stock does not match their stock movements and exit")
 	flag.Parse()
 
 	config := loadConfig()
 
+	money.SetDefaultCurrency(config.Currency)
+	roundingMode, err := money.ParseRoundingMode(config.RoundingMode)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+	cashRounding, err := parseCashRounding(config, roundingMode)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+	costingMethod, err := models.ParseCostingMethod(config.CostingMethod)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+
 	db, err := database.InitDB(config.DBConn)
 	if err != nil {
 		fmt.Println("Failed to connect database", err)
@@ -74,30 +209,140 @@ func main() {
 		return
 	}
 
-	productRepo := repositories.NewProductRepository(db)
-	productService := services.NewProductService(productRepo)
+	productRepo := repositories.NewProductRepository(db, roundingMode, costingMethod)
+	productService := services.NewProductService(productRepo, config.ProductLookupTTL)
 	productHandler := handlers.NewProductHandler(productService)
 
+	if *reconcileStockFlag {
+		drifts, err := productService.FindStockDrift()
+		if err != nil {
+			fmt.Println("Failed to reconcile stock:", err)
+			os.Exit(1)
+		}
+		for _, d := range drifts {
+			fmt.Printf("Product %d (%s): stock %s, stock movements add up to %s\n",
+				d.ProductID, d.ProductName, d.Stock, d.LedgerStock)
+		}
+		if len(drifts) > 0 {
+			fmt.Printf("%d product(s) out of step with their stock movements\n", len(drifts))
+			os.Exit(1)
+		}
+		fmt.Println("Stock matches the stock movements for every product")
+		return
+	}
+
 	categoryRepo := repositories.NewCategoryRepository(db)
 	categoryService := services.NewCategoryService(categoryRepo)
 	categoryHandler := handlers.NewCategoryHandler(categoryService)
 
-	transactionRepo := repositories.NewTransactionRepository(db)
-	transactionService := services.NewTransactionService(transactionRepo)
-	transactionHandler := handlers.NewTransactionHandler(transactionService)
+	taxEngine := tax.NewStandardEngine(config.TaxInclusive, roundingMode)
+
+	receipts, err := receipt.NewRenderer(config.ReceiptHeader, config.ReceiptFooter)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
 
-	reportRepo := repositories.NewReportRepository(db)
+	loyalty, err := parseLoyaltyRules(config)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+
+	transactionRepo, err := repositories.NewTransactionRepository(db, roundingMode, cashRounding, costingMethod, taxEngine,
+		models.ReceiptNumbering{
+			StoreCode: config.StoreCode,
+			Reset:     config.ReceiptNumberReset,
+		}, loyalty)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+	lowStockAlerts := services.NewLowStockAlerts(config.LowStockWebhookURL, 10*time.Second)
+	transactionService := services.NewTransactionService(transactionRepo, config.IdempotencyTTL, lowStockAlerts)
+	transactionHandler := handlers.NewTransactionHandler(transactionService, config.CheckoutMode != "optimistic", receipts)
+
+	cartRepo := repositories.NewCartRepository(db, config.CartTTL)
+	cartService := services.NewCartService(cartRepo)
+	cartHandler := handlers.NewCartHandler(cartService, transactionService, config.CheckoutMode != "optimistic")
+
+	taxRateRepo := repositories.NewTaxRateRepository(db)
+	taxRateService := services.NewTaxRateService(taxRateRepo)
+	taxRateHandler := handlers.NewTaxRateHandler(taxRateService)
+
+	promotionRepo := repositories.NewPromotionRepository(db)
+	promotionService := services.NewPromotionService(promotionRepo)
+	promotionHandler := handlers.NewPromotionHandler(promotionService)
+
+	bundleAllocation, err := models.ParseBundleAllocation(config.BundleAllocation)
+	if err != nil {
+		fmt.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+
+	reportRepo := repositories.NewReportRepository(db, bundleAllocation)
 	reportService := services.NewReportService(reportRepo)
 	reportHandler := handlers.NewReportHandler(reportService)
 
+	customerRepo := repositories.NewCustomerRepository(db)
+	customerService := services.NewCustomerService(customerRepo)
+	customerHandler := handlers.NewCustomerHandler(customerService, transactionService)
+
+	giftCardRepo := repositories.NewGiftCardRepository(db)
+	giftCardService := services.NewGiftCardService(giftCardRepo)
+	giftCardHandler := handlers.NewGiftCardHandler(giftCardService)
+
+	shiftRepo := repositories.NewShiftRepository(db)
+	shiftService := services.NewShiftService(shiftRepo)
+	shiftHandler := handlers.NewShiftHandler(shiftService, reportService)
+
+	stocktakeRepo := repositories.NewStocktakeRepository(db, roundingMode, costingMethod)
+	stocktakeService := services.NewStocktakeService(stocktakeRepo)
+	stocktakeHandler := handlers.NewStocktakeHandler(stocktakeService)
+
+	supplierRepo := repositories.NewSupplierRepository(db)
+	supplierService := services.NewSupplierService(supplierRepo)
+	supplierHandler := handlers.NewSupplierHandler(supplierService)
+
+	purchaseOrderRepo := repositories.NewPurchaseOrderRepository(db, roundingMode, costingMethod)
+	purchaseOrderService := services.NewPurchaseOrderService(purchaseOrderRepo)
+	purchaseOrderHandler := handlers.NewPurchaseOrderHandler(purchaseOrderService)
+
 	http.HandleFunc("/api/checkout", transactionHandler.HandleCheckout)
+	http.HandleFunc("/api/checkout/preview", transactionHandler.HandlePreview)
+	http.HandleFunc("/api/transactions", transactionHandler.HandleTransactions)
+	http.HandleFunc("/api/transactions/", transactionHandler.HandleTransactionByID)
 	http.HandleFunc("/api/report/today", reportHandler.HandleReportToday)
 	http.HandleFunc("/api/report", reportHandler.HandleReport)
+	http.HandleFunc("/api/report/margin", reportHandler.HandleMarginReport)
+	http.HandleFunc("/api/report/inventory-valuation", reportHandler.HandleInventoryValuation)
 	http.HandleFunc("/api/health", handlers.HealthCheckHandler)
 	http.HandleFunc("/api/products", productHandler.HandleProducts)
 	http.HandleFunc("/api/products/", productHandler.HandleProductByID)
+	http.HandleFunc("/api/products/lookup", productHandler.HandleLookup)
+	http.HandleFunc("/api/products/low-stock", productHandler.HandleLowStock)
 	http.HandleFunc("/api/categories", categoryHandler.HandleCategories)
 	http.HandleFunc("/api/categories/", categoryHandler.HandleCategoryByID)
+	http.HandleFunc("/api/tax-rates", taxRateHandler.HandleTaxRates)
+	http.HandleFunc("/api/tax-rates/", taxRateHandler.HandleTaxRateByID)
+	http.HandleFunc("/api/promotions", promotionHandler.HandlePromotions)
+	http.HandleFunc("/api/promotions/", promotionHandler.HandlePromotionByID)
+	http.HandleFunc("/api/shifts", shiftHandler.HandleShifts)
+	http.HandleFunc("/api/shifts/", shiftHandler.HandleShiftByID)
+	http.HandleFunc("/api/carts", cartHandler.HandleCarts)
+	http.HandleFunc("/api/carts/", cartHandler.HandleCartByID)
+	http.HandleFunc("/api/customers", customerHandler.HandleCustomers)
+	http.HandleFunc("/api/customers/", customerHandler.HandleCustomerByID)
+	http.HandleFunc("/api/gift-cards", giftCardHandler.HandleGiftCards)
+	http.HandleFunc("/api/gift-cards/", giftCardHandler.HandleGiftCardByCode)
+	http.HandleFunc("/api/stocktakes", stocktakeHandler.HandleStocktakes)
+	http.HandleFunc("/api/stocktakes/", stocktakeHandler.HandleStocktakeByID)
+	http.HandleFunc("/api/suppliers", supplierHandler.HandleSuppliers)
+	http.HandleFunc("/api/suppliers/", supplierHandler.HandleSupplierByID)
+	http.HandleFunc("/api/purchase-orders", purchaseOrderHandler.HandlePurchaseOrders)
+	http.HandleFunc("/api/purchase-orders/", purchaseOrderHandler.HandlePurchaseOrderByID)
+	http.HandleFunc("/api/purchase-orders/outstanding", purchaseOrderHandler.HandleOutstanding)
+	http.HandleFunc("/api/purchase-orders/suggestions", purchaseOrderHandler.HandleSuggestions)
 
 	if config.Port == "" {
 		config.Port = "8080"
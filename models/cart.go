@@ -0,0 +1,62 @@
+package models
+
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"errors"
+	"time"
+)
+
+const (
+	CartStatusActive     = "active"
+	CartStatusHeld       = "held"
+	CartStatusCheckedOut = "checked_out"
+	CartStatusExpired    = "expired"
+)
+
+var (
+	ErrCartNotFound  = errors.New("cart not found")
+	ErrCartNotActive = errors.New("cart is not active")
+	ErrCartNotHeld   = errors.New("cart is not on hold")
+	ErrCartExpired   = errors.New("cart has expired")
+	ErrCartEmpty     = errors.New("cart is empty")
+)
+
+// Cart is a sale in progress kept on the server so it can be parked on one
+// till and picked up on another. A cart with Reserve set holds its
+// quantities back from other carts and checkouts until it expires.
+type Cart struct {
+	ID            int        `json:"id"`
+	Status        string     `json:"status"`
+	Reserve       bool       `json:"reserve"`
+	Items         []CartItem `json:"items"`
+	TransactionID int        `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+}
+
+type CartItem struct {
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name"`
+	UnitPrice   money.Money       `json:"unit_price"`
+	Quantity    quantity.Quantity `json:"quantity"`
+	Unit        string            `json:"unit"`
+}
+
+type CreateCartRequest struct {
+	Reserve bool           `json:"reserve"`
+	Items   []CheckoutItem `json:"items"`
+}
+
+// CartCheckoutRequest is the checkout body for a cart; the items come from
+// the cart itself.
+type CartCheckoutRequest struct {
+	ShiftID    int       `json:"shift_id"`
+	CustomerID int       `json:"customer_id,omitempty"`
+	Payments   []Payment `json:"payments,omitempty"`
+}
+
+// ErrInvalidCartItem is returned for lines naming a product that does not
+// exist.
+var ErrInvalidCartItem = errors.New("invalid cart item")
@@ -4,4 +4,7 @@ type Category struct {
 	ID          int    `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// TaxRateID is the tax applied to products in this category unless the
+	// product sets its own.
+	TaxRateID int `json:"tax_rate_id,omitempty"`
 }
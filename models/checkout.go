@@ -1,10 +1,86 @@
 package models
 
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CheckoutItem names its product by exactly one of ProductID, Barcode or SKU.
 type CheckoutItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID int               `json:"product_id,omitempty"`
+	Barcode   string            `json:"barcode,omitempty"`
+	SKU       string            `json:"sku,omitempty"`
+	Quantity  quantity.Quantity `json:"quantity"`
 }
 
+// ErrUnknownProductCode is returned for a checkout item whose barcode or SKU
+// matches no product.
+var ErrUnknownProductCode = errors.New("no product matches the barcode or sku")
+
+// ErrInvalidQuantity is returned for a quantity finer than the product's
+// precision allows, such as half a piece.
+var ErrInvalidQuantity = errors.New("invalid quantity")
+
 type CheckoutRequest struct {
-	Items []CheckoutItem `json:"items"`
+	// ShiftID is the open shift the sale is rung up on.
+	ShiftID int `json:"shift_id"`
+	// CartID checks out a server-side cart instead of Items, which must then
+	// be empty.
+	CartID int `json:"cart_id,omitempty"`
+	// CustomerID is the loyalty member the sale earns points for. Paying
+	// with points requires it.
+	CustomerID int            `json:"customer_id,omitempty"`
+	Items      []CheckoutItem `json:"items"`
+	// Payments may be omitted, in which case the sale is taken as paid in
+	// exact cash.
+	Payments []Payment `json:"payments,omitempty"`
+}
+
+// CheckoutOptions carries the per-request settings that shape how a checkout
+// is recorded.
+type CheckoutOptions struct {
+	UseLock        bool
+	IdempotencyKey string
+	RequestHash    string
+	IdempotencyTTL time.Duration
+}
+
+// CheckoutPreview is a cart priced exactly as checkout would price it, without
+// recording a sale or touching stock.
+type CheckoutPreview struct {
+	Currency       string              `json:"currency"`
+	Subtotal       money.Money         `json:"subtotal"`
+	DiscountAmount money.Money         `json:"discount_amount"`
+	TaxAmount      money.Money         `json:"tax_amount"`
+	TotalAmount    money.Money         `json:"total_amount"`
+	TaxInclusive   bool                `json:"tax_inclusive"`
+	TaxSummary     []TaxSummaryLine    `json:"tax_summary"`
+	Details        []TransactionDetail `json:"details"`
+}
+
+var ErrIdempotencyKeyMismatch = errors.New("idempotency key was already used with a different request")
+
+type StockShortage struct {
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name"`
+	Requested   quantity.Quantity `json:"requested"`
+	Available   quantity.Quantity `json:"available"`
+}
+
+// InsufficientStockError is returned by checkout when one or more items
+// cannot be fulfilled. It lists every short item, not just the first one.
+type InsufficientStockError struct {
+	Items []StockShortage `json:"items"`
+}
+
+func (e *InsufficientStockError) Error() string {
+	parts := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		parts = append(parts, fmt.Sprintf("%s (requested %s, available %s)", item.ProductName, item.Requested, item.Available))
+	}
+	return "insufficient stock: " + strings.Join(parts, ", ")
 }
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"cashier-api/money"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	PointsEntryEarn           = "earn"
+	PointsEntryRedeem         = "redeem"
+	PointsEntryEarnReversal   = "earn_reversal"
+	PointsEntryRedeemReversal = "redeem_reversal"
+)
+
+var (
+	ErrCustomerNotFound   = errors.New("customer not found")
+	ErrInvalidCustomer    = errors.New("invalid customer")
+	ErrDuplicateCustomer  = errors.New("member number, phone or email is already in use")
+	ErrInsufficientPoints = errors.New("insufficient points")
+)
+
+// Customer is a loyalty member. MemberNumber is generated when left empty.
+// PointsBalance is the sum of the customer's points ledger.
+type Customer struct {
+	ID            int       `json:"id"`
+	MemberNumber  string    `json:"member_number"`
+	Name          string    `json:"name"`
+	Phone         string    `json:"phone,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	PointsBalance int64     `json:"points_balance"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PointsEntry is one line of the points ledger. Points is signed: earning and
+// giving back redeemed points add, redeeming and taking back earned points
+// subtract.
+type PointsEntry struct {
+	ID            int       `json:"id"`
+	CustomerID    int       `json:"customer_id"`
+	TransactionID int       `json:"transaction_id,omitempty"`
+	ReturnID      int       `json:"return_id,omitempty"`
+	Type          string    `json:"type"`
+	Points        int64     `json:"points"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PointsStatement is a customer's balance together with the ledger it is
+// worked out from, newest entry first.
+type PointsStatement struct {
+	CustomerID int           `json:"customer_id"`
+	Balance    int64         `json:"balance"`
+	Entries    []PointsEntry `json:"entries"`
+}
+
+// LoyaltyRules sets how points are earned and what they are worth. A sale
+// earns one point for every EarnPer paid with anything but points, rounded
+// down; a point redeemed at the till is worth PointValue. A zero EarnPer
+// turns earning off and a zero PointValue turns redemption off.
+type LoyaltyRules struct {
+	EarnPer    money.Money
+	PointValue money.Money
+}
+
+// Validate rejects negative amounts.
+func (r LoyaltyRules) Validate() error {
+	if r.EarnPer.IsNegative() || r.PointValue.IsNegative() {
+		return errors.New("loyalty earn amount and point value must not be negative")
+	}
+	return nil
+}
+
+// PointsEarned is the number of points earned on amount.
+func (r LoyaltyRules) PointsEarned(amount money.Money) int64 {
+	if !r.EarnPer.IsPositive() || !amount.IsPositive() {
+		return 0
+	}
+	return amount.Minor() / r.EarnPer.Minor()
+}
+
+// PointsFor is the number of points needed to pay amount. It fails when
+// redemption is off or amount is not a whole number of points.
+func (r LoyaltyRules) PointsFor(amount money.Money) (int64, error) {
+	if !r.PointValue.IsPositive() {
+		return 0, fmt.Errorf("%w: points redemption is disabled", ErrInvalidPayment)
+	}
+	if amount.Minor()%r.PointValue.Minor() != 0 {
+		return 0, fmt.Errorf("%w: points payment of %s is not a multiple of the point value %s",
+			ErrInvalidPayment, amount, r.PointValue)
+	}
+	return amount.Minor() / r.PointValue.Minor(), nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"cashier-api/money"
+	"errors"
+	"time"
+)
+
+const (
+	// GiftCardKindCard is a reloadable stored-value card that can be spent
+	// down over several sales.
+	GiftCardKindCard = "card"
+	// GiftCardKindVoucher is spent once; whatever it does not cover on that
+	// sale is forfeited.
+	GiftCardKindVoucher = "voucher"
+
+	GiftCardStatusInactive = "inactive"
+	GiftCardStatusActive   = "active"
+	GiftCardStatusUsed     = "used"
+
+	GiftCardEntryActivate = "activate"
+	GiftCardEntryTopUp    = "top_up"
+	GiftCardEntryRedeem   = "redeem"
+	GiftCardEntryForfeit  = "forfeit"
+	GiftCardEntryRefund   = "refund"
+	GiftCardEntryReversal = "reversal"
+)
+
+var (
+	ErrGiftCardNotFound            = errors.New("gift card not found")
+	ErrGiftCardNotActive           = errors.New("gift card is not active")
+	ErrGiftCardAlreadyActivated    = errors.New("gift card is already activated")
+	ErrGiftCardExpired             = errors.New("gift card has expired")
+	ErrGiftCardNotReloadable       = errors.New("vouchers cannot be topped up or refunded to")
+	ErrInsufficientGiftCardBalance = errors.New("insufficient gift card balance")
+	ErrInvalidGiftCard             = errors.New("invalid gift card")
+)
+
+// GiftCard is a stored-value card or single-use voucher issued by the store.
+// Cards are issued inactive and hold no value until activated. Balance is the
+// sum of the card's ledger.
+type GiftCard struct {
+	ID           int         `json:"id"`
+	Code         string      `json:"code"`
+	Kind         string      `json:"kind"`
+	Status       string      `json:"status"`
+	InitialValue money.Money `json:"initial_value"`
+	Balance      money.Money `json:"balance"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	ActivatedAt  *time.Time  `json:"activated_at,omitempty"`
+}
+
+// GiftCardEntry is one line of a card's ledger. Amount is signed.
+type GiftCardEntry struct {
+	ID            int         `json:"id"`
+	GiftCardID    int         `json:"gift_card_id"`
+	TransactionID int         `json:"transaction_id,omitempty"`
+	ReturnID      int         `json:"return_id,omitempty"`
+	Type          string      `json:"type"`
+	Amount        money.Money `json:"amount"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+type IssueGiftCardRequest struct {
+	Kind      string      `json:"kind"`
+	Value     money.Money `json:"value"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+}
+
+type GiftCardTopUpRequest struct {
+	Amount money.Money `json:"amount"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"cashier-api/money"
+	"errors"
+)
+
+const (
+	PaymentMethodCash      = "cash"
+	PaymentMethodDebitCard = "debit_card"
+	PaymentMethodQRIS      = "qris"
+	PaymentMethodEWallet   = "e_wallet"
+	PaymentMethodVoucher   = "voucher"
+	// PaymentMethodPoints pays with the customer's loyalty points.
+	PaymentMethodPoints = "points"
+	// PaymentMethodGiftCard pays from a gift card or voucher issued by the
+	// store; PaymentMethodVoucher is for third-party vouchers.
+	PaymentMethodGiftCard = "gift_card"
+)
+
+// ErrInvalidPayment is returned when the tenders do not settle the total:
+// they fall short of it, or non-cash tenders exceed it.
+var ErrInvalidPayment = errors.New("invalid payment")
+
+// IsPaymentMethod reports whether method is one of the accepted tenders.
+func IsPaymentMethod(method string) bool {
+	switch method {
+	case PaymentMethodCash, PaymentMethodDebitCard, PaymentMethodQRIS, PaymentMethodEWallet, PaymentMethodVoucher,
+		PaymentMethodPoints, PaymentMethodGiftCard:
+		return true
+	}
+	return false
+}
+
+// Payment is one tender in a checkout request. Reference holds the card
+// approval code, QRIS or e-wallet transaction ID, voucher code, or the code of
+// the gift card being spent.
+type Payment struct {
+	Method    string      `json:"method"`
+	Amount    money.Money `json:"amount"`
+	Reference string      `json:"reference,omitempty"`
+}
+
+// TransactionPayment is a tender recorded against a sale. Tendered is what
+// the customer handed over; Amount is the part applied to the sale, which is
+// less than Tendered only for cash that needed change.
+type TransactionPayment struct {
+	ID            int         `json:"id"`
+	TransactionID int         `json:"transaction_id"`
+	Method        string      `json:"method"`
+	Amount        money.Money `json:"amount"`
+	Tendered      money.Money `json:"tendered"`
+	Reference     string      `json:"reference,omitempty"`
+}
+
+// PaymentSummaryLine totals the payments taken with one method.
+type PaymentSummaryLine struct {
+	Method string      `json:"method"`
+	Count  int         `json:"count"`
+	Amount money.Money `json:"amount"`
+}
@@ -1,10 +1,160 @@
 package models
 
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"errors"
+	"fmt"
+)
+
+const (
+	ProductTypeStandard = "standard"
+	// ProductTypeBundle is a kit such as a gift hamper. It holds no stock of
+	// its own; selling one takes its components out of stock.
+	ProductTypeBundle = "bundle"
+)
+
+// BundleAllocation is how a bundle's revenue is attributed to its
+// components in reports.
+type BundleAllocation string
+
+const (
+	// AllocateByListPrice weights each component by its list price at the
+	// time of sale times its quantity in the bundle.
+	AllocateByListPrice BundleAllocation = "list_price"
+	// AllocateByQuantity weights each component by its quantity alone.
+	AllocateByQuantity BundleAllocation = "quantity"
+	// AllocateEqually gives every component the same share.
+	AllocateEqually BundleAllocation = "equal"
+)
+
+func ParseBundleAllocation(s string) (BundleAllocation, error) {
+	switch rule := BundleAllocation(s); rule {
+	case "":
+		return AllocateByListPrice, nil
+	case AllocateByListPrice, AllocateByQuantity, AllocateEqually:
+		return rule, nil
+	default:
+		return "", fmt.Errorf("unknown bundle allocation %q", s)
+	}
+}
+
+// Units a product can be sold in.
+const (
+	UnitPiece    = "pcs"
+	UnitKilogram = "kg"
+	UnitGram     = "g"
+	UnitLitre    = "l"
+	UnitMetre    = "m"
+)
+
+func IsUnit(unit string) bool {
+	switch unit {
+	case UnitPiece, UnitKilogram, UnitGram, UnitLitre, UnitMetre:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrInvalidProduct  = errors.New("invalid product")
+	// ErrDuplicateProductCode is returned when a SKU or barcode already
+	// belongs to another product.
+	ErrDuplicateProductCode = errors.New("sku or barcode is already in use")
+	// ErrProductHasVariants is returned when a parent product is sold or
+	// deleted directly instead of through its variants.
+	ErrProductHasVariants = errors.New("product has variants")
+	// ErrProductIsComponent is returned when deleting a product that a
+	// bundle is made of.
+	ErrProductIsComponent = errors.New("product is a component of a bundle")
+)
+
+// BundleComponent is one product in a bundle and how much of it goes into
+// one bundle.
+type BundleComponent struct {
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name,omitempty"`
+	Quantity    quantity.Quantity `json:"quantity"`
+}
+
+// ProductOption is one axis a parent product varies along, such as size.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// ProductPack is a larger unit the product is bought in, such as a carton
+// of 24. Size is in the product's own unit.
+type ProductPack struct {
+	Name string            `json:"name"`
+	Size quantity.Quantity `json:"size"`
+}
+
+// ReceiveStockRequest adds stock counted in the product's unit or, when Pack
+// names one of its packs, in whole packs. UnitCost is what one unit, or one
+// pack, was bought at; without it the goods come in at the cost price.
+type ReceiveStockRequest struct {
+	Quantity    quantity.Quantity `json:"quantity"`
+	Pack        string            `json:"pack,omitempty"`
+	UnitCost    *money.Money      `json:"unit_cost,omitempty"`
+	PerformedBy string            `json:"performed_by,omitempty"`
+}
+
+// GenerateVariantsRequest sets a parent's option axes and creates a variant
+// for every combination that does not have one yet.
+type GenerateVariantsRequest struct {
+	Options []ProductOption `json:"options"`
+}
+
 type Product struct {
-	ID           int     `json:"id"`
-	Name         string  `json:"name"`
-	Price        float64 `json:"price"`
-	Stock        int     `json:"stock"`
-	CategoryID   int     `json:"category_id"`
-	CategoryName string  `json:"category_name,omitempty"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Type is standard or bundle; it defaults to standard.
+	Type string `json:"type"`
+	SKU  string `json:"sku,omitempty"`
+	// Price is per Unit: per kilogram for a product sold by weight.
+	Price money.Money `json:"price"`
+	// CostPrice is what one Unit costs to buy; stock is valued at it. Like
+	// Stock it is taken as given only when a product is created; after that
+	// it follows the unit cost of stock received or adjusted in.
+	CostPrice money.Money `json:"cost_price"`
+	// Stock is taken as given only when a product is created; after that it
+	// moves through the stock ledger. Stock of a bundle is how many can be
+	// made up from its components.
+	Stock quantity.Quantity `json:"stock"`
+	// Unit defaults to pieces. Precision is how many decimal places a
+	// quantity sold may have, up to 3; zero sells whole units only.
+	Unit      string `json:"unit"`
+	Precision int    `json:"precision"`
+	// ReorderPoint is the stock at or below which the product is low and
+	// ReorderQuantity how much to order then. Zero turns reordering off.
+	// PreferredSupplierID is who it is ordered from.
+	ReorderPoint        quantity.Quantity `json:"reorder_point"`
+	ReorderQuantity     quantity.Quantity `json:"reorder_quantity"`
+	PreferredSupplierID int               `json:"preferred_supplier_id,omitempty"`
+	// Packs are converted to the product's unit when stock is received in
+	// them. On update a missing list leaves the packs as they are.
+	Packs []ProductPack `json:"packs"`
+	// Barcodes are EAN-13 or UPC-A codes, stored in their 13-digit form.
+	// On update a missing list leaves the barcodes as they are and an empty
+	// one removes them all.
+	Barcodes     []string `json:"barcodes"`
+	CategoryID   int      `json:"category_id"`
+	CategoryName string   `json:"category_name,omitempty"`
+	// TaxRateID overrides the category's tax rate when set.
+	TaxRateID int `json:"tax_rate_id,omitempty"`
+	// ParentID is set on variants. A variant is sold, stocked and priced on
+	// its own; OptionValues holds its value on each of the parent's Options.
+	ParentID     int               `json:"parent_id,omitempty"`
+	Options      []ProductOption   `json:"options,omitempty"`
+	OptionValues map[string]string `json:"option_values,omitempty"`
+	// PriceOverride is set on a variant whose price differs from its
+	// parent's. Variants without one follow the parent's price changes.
+	PriceOverride bool `json:"price_override,omitempty"`
+	// Variants is filled on parents when listing with variants grouped.
+	Variants []Product `json:"variants,omitempty"`
+	// Components make up a bundle. On update a missing list leaves them as
+	// they are.
+	Components []BundleComponent `json:"components,omitempty"`
 }
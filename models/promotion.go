@@ -0,0 +1,59 @@
+package models
+
+import (
+	"cashier-api/money"
+	"errors"
+	"time"
+)
+
+const (
+	// PromotionTypePercentage takes Percent off each eligible line, or off the
+	// eligible order total at order level.
+	PromotionTypePercentage = "percentage"
+	// PromotionTypeFixedAmount takes Amount off each eligible unit, or once
+	// off the eligible order total at order level.
+	PromotionTypeFixedAmount = "fixed_amount"
+	// PromotionTypeBuyXGetY gives GetQuantity units free for every
+	// BuyQuantity units bought of the same product.
+	PromotionTypeBuyXGetY = "buy_x_get_y"
+	// PromotionTypeBundle sells one unit of each product in ProductIDs for
+	// BundlePrice.
+	PromotionTypeBundle = "bundle"
+
+	PromotionLevelLine  = "line"
+	PromotionLevelOrder = "order"
+)
+
+var ErrInvalidPromotion = errors.New("invalid promotion")
+
+// Promotion is a discount rule. Empty ProductIDs and CategoryIDs target every
+// product; otherwise a line is eligible when it matches either list.
+type Promotion struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Level       string        `json:"level"`
+	Percent     money.Percent `json:"percent"`
+	Amount      money.Money   `json:"amount"`
+	BuyQuantity int           `json:"buy_quantity,omitempty"`
+	GetQuantity int           `json:"get_quantity,omitempty"`
+	BundlePrice money.Money   `json:"bundle_price"`
+	// MinSpend is the eligible subtotal the cart must reach before the
+	// promotion applies.
+	MinSpend    money.Money `json:"min_spend"`
+	ProductIDs  []int       `json:"product_ids"`
+	CategoryIDs []int       `json:"category_ids"`
+	// Priority orders promotions at the same level; lower runs first.
+	Priority int        `json:"priority"`
+	Active   bool       `json:"active"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+// AppliedDiscount is one promotion's share of the discount on a line.
+type AppliedDiscount struct {
+	PromotionID   int         `json:"promotion_id"`
+	PromotionName string      `json:"promotion_name"`
+	Level         string      `json:"level"`
+	Amount        money.Money `json:"amount"`
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"errors"
+	"time"
+)
+
+// A purchase order is drafted, sent to the supplier and then received, in
+// one delivery or several. It can be cancelled at any point before it is
+// fully received; cancelling a partly received order closes what is left.
+const (
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusSent              = "sent"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusReceived          = "received"
+	PurchaseOrderStatusCancelled         = "cancelled"
+)
+
+var (
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	ErrInvalidPurchaseOrder  = errors.New("invalid purchase order")
+	// ErrPurchaseOrderStatus is returned when an order is not in a status
+	// that allows the change, such as receiving a draft.
+	ErrPurchaseOrderStatus = errors.New("purchase order status does not allow this")
+)
+
+// PurchaseOrder is stock ordered from a supplier. Total is the expected cost
+// of everything ordered.
+type PurchaseOrder struct {
+	ID           int                 `json:"id"`
+	SupplierID   int                 `json:"supplier_id"`
+	SupplierName string              `json:"supplier_name"`
+	Status       string              `json:"status"`
+	Note         string              `json:"note,omitempty"`
+	CreatedBy    string              `json:"created_by"`
+	CreatedAt    time.Time           `json:"created_at"`
+	SentAt       *time.Time          `json:"sent_at,omitempty"`
+	ClosedAt     *time.Time          `json:"closed_at,omitempty"`
+	Total        money.Money         `json:"total"`
+	Lines        []PurchaseOrderLine `json:"lines"`
+	Receipts     []GoodsReceipt      `json:"receipts,omitempty"`
+}
+
+// PurchaseOrderLine is one product on an order, in the product's unit, at
+// the cost the supplier quoted. Outstanding is what has not arrived yet.
+type PurchaseOrderLine struct {
+	ID          int               `json:"id"`
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name"`
+	Unit        string            `json:"unit"`
+	Quantity    quantity.Quantity `json:"quantity"`
+	Received    quantity.Quantity `json:"received"`
+	Outstanding quantity.Quantity `json:"outstanding"`
+	UnitCost    money.Money       `json:"unit_cost"`
+	Total       money.Money       `json:"total"`
+}
+
+// PurchaseOrderRequest creates a draft order or replaces a draft's lines.
+type PurchaseOrderRequest struct {
+	SupplierID int                        `json:"supplier_id"`
+	Note       string                     `json:"note"`
+	CreatedBy  string                     `json:"created_by"`
+	Lines      []PurchaseOrderLineRequest `json:"lines"`
+}
+
+type PurchaseOrderLineRequest struct {
+	ProductID int               `json:"product_id"`
+	Quantity  quantity.Quantity `json:"quantity"`
+	UnitCost  money.Money       `json:"unit_cost"`
+}
+
+// GoodsReceipt is one delivery against a purchase order, at the cost
+// actually invoiced.
+type GoodsReceipt struct {
+	ID              int                `json:"id"`
+	PurchaseOrderID int                `json:"purchase_order_id"`
+	ReceivedBy      string             `json:"received_by"`
+	Note            string             `json:"note,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
+	Lines           []GoodsReceiptLine `json:"lines"`
+}
+
+type GoodsReceiptLine struct {
+	ID          int               `json:"id"`
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name"`
+	Quantity    quantity.Quantity `json:"quantity"`
+	UnitCost    money.Money       `json:"unit_cost"`
+}
+
+// GoodsReceiptRequest receives a delivery. Each line names a product on the
+// order; a line without a unit cost was invoiced at the cost on the order.
+type GoodsReceiptRequest struct {
+	ReceivedBy string                    `json:"received_by"`
+	Note       string                    `json:"note"`
+	Lines      []GoodsReceiptLineRequest `json:"lines"`
+}
+
+type GoodsReceiptLineRequest struct {
+	ProductID int               `json:"product_id"`
+	Quantity  quantity.Quantity `json:"quantity"`
+	UnitCost  *money.Money      `json:"unit_cost,omitempty"`
+}
+
+// OutstandingOrders is what one supplier still has to deliver.
+// OutstandingValue is the outstanding quantities at the costs on the orders.
+type OutstandingOrders struct {
+	SupplierID       int             `json:"supplier_id"`
+	SupplierName     string          `json:"supplier_name"`
+	OutstandingValue money.Money     `json:"outstanding_value"`
+	Orders           []PurchaseOrder `json:"orders"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	ReceiptResetDaily   = "day"
+	ReceiptResetMonthly = "month"
+	ReceiptResetYearly  = "year"
+)
+
+var ErrInvalidReceiptReset = errors.New("receipt number reset must be day, month or year")
+
+// ReceiptNumbering is the scheme for receipt numbers such as
+// STR01-20261017-0001: the store code, the period the counter belongs to and
+// a counter that starts again at 1 every period.
+type ReceiptNumbering struct {
+	StoreCode string
+	Reset     string
+}
+
+// PeriodFormat returns the PostgreSQL to_char pattern for the reset period.
+func (n ReceiptNumbering) PeriodFormat() (string, error) {
+	switch n.Reset {
+	case ReceiptResetDaily, "":
+		return "YYYYMMDD", nil
+	case ReceiptResetMonthly:
+		return "YYYYMM", nil
+	case ReceiptResetYearly:
+		return "YYYY", nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidReceiptReset, n.Reset)
+	}
+}
+
+// Format builds the receipt number for the given period and counter.
+func (n ReceiptNumbering) Format(period string, number int) string {
+	return fmt.Sprintf("%s-%s-%04d", n.StoreCode, period, number)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"time"
+)
+
+// EventLowStock is the event name sent with a LowStockAlert.
+const EventLowStock = "product.low_stock"
+
+// DefaultSalesWindowDays is how many days of sales the average daily sales
+// are taken over unless asked otherwise.
+const DefaultSalesWindowDays = 30
+
+// ReorderOptions tune reorder suggestions. Average daily sales are taken
+// over the last SalesWindowDays days. With CoverDays set a suggestion is
+// raised, if need be, to cover that many days of average sales.
+type ReorderOptions struct {
+	SalesWindowDays int
+	CoverDays       int
+	SupplierID      int
+}
+
+// LowStockProduct is a product at or below its reorder point.
+//
+// OnOrder is what is still to come on purchase orders not yet received.
+// DaysOfCover is how long the stock lasts at the average daily sales; it is
+// empty when nothing sold in the window. SuggestedQuantity is zero when
+// enough is already on order to lift the product above its reorder point.
+type LowStockProduct struct {
+	ProductID         int               `json:"product_id"`
+	ProductName       string            `json:"product_name"`
+	SKU               string            `json:"sku,omitempty"`
+	Unit              string            `json:"unit"`
+	Stock             quantity.Quantity `json:"stock"`
+	ReorderPoint      quantity.Quantity `json:"reorder_point"`
+	ReorderQuantity   quantity.Quantity `json:"reorder_quantity"`
+	OnOrder           quantity.Quantity `json:"on_order"`
+	AverageDailySales quantity.Quantity `json:"average_daily_sales"`
+	DaysOfCover       *float64          `json:"days_of_cover,omitempty"`
+	SuggestedQuantity quantity.Quantity `json:"suggested_quantity"`
+	UnitCost          money.Money       `json:"unit_cost"`
+	SupplierID        int               `json:"supplier_id,omitempty"`
+	SupplierName      string            `json:"supplier_name,omitempty"`
+}
+
+// SuggestedPurchaseOrder is what to order from one supplier to restock its
+// low products, costed at their cost prices. Products without a preferred
+// supplier are grouped under SupplierID zero and cannot be ordered as they
+// are.
+type SuggestedPurchaseOrder struct {
+	SupplierID   int               `json:"supplier_id"`
+	SupplierName string            `json:"supplier_name,omitempty"`
+	Total        money.Money       `json:"total"`
+	Lines        []LowStockProduct `json:"lines"`
+}
+
+// CreateSuggestedOrdersRequest turns the suggestions into draft purchase
+// orders, one per supplier, or only for SupplierID when it is set.
+type CreateSuggestedOrdersRequest struct {
+	CreatedBy       string `json:"created_by"`
+	SupplierID      int    `json:"supplier_id"`
+	SalesWindowDays int    `json:"days"`
+	CoverDays       int    `json:"cover_days"`
+}
+
+// LowStockAlert is raised when a sale takes a product's stock from above
+// its reorder point to at or below it.
+type LowStockAlert struct {
+	Event           string            `json:"event"`
+	ProductID       int               `json:"product_id"`
+	ProductName     string            `json:"product_name"`
+	Stock           quantity.Quantity `json:"stock"`
+	ReorderPoint    quantity.Quantity `json:"reorder_point"`
+	ReorderQuantity quantity.Quantity `json:"reorder_quantity"`
+	SupplierID      int               `json:"supplier_id,omitempty"`
+	TransactionID   int               `json:"transaction_id"`
+	RaisedAt        time.Time         `json:"raised_at"`
+}
@@ -1,12 +1,90 @@
 package models
 
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+)
+
 type BestSellingProduct struct {
-	Name           string `json:"name"`
-	QuantitySold   int    `json:"quantity_sold"`
+	Name         string            `json:"name"`
+	QuantitySold quantity.Quantity `json:"quantity_sold"`
+}
+
+// ProductSalesLine is what one product sold, net of returns on those sales.
+// For a product with variants the line totals its variants, which are listed
+// under it.
+type ProductSalesLine struct {
+	ProductID    int                `json:"product_id,omitempty"`
+	Name         string             `json:"name"`
+	QuantitySold quantity.Quantity  `json:"quantity_sold"`
+	NetAmount    money.Money        `json:"net_amount"`
+	Variants     []ProductSalesLine `json:"variants,omitempty"`
 }
 
 type SalesSummary struct {
-	TotalRevenue        int                   `json:"total_revenue"`
-	TotalTransactions   int                   `json:"total_transactions"`
-	BestSellingProduct *BestSellingProduct   `json:"best_selling_product,omitempty"`
+	// TotalRevenue equals NetSales and is kept for existing clients.
+	TotalRevenue      money.Money `json:"total_revenue"`
+	GrossSales        money.Money `json:"gross_sales"`
+	Returns           money.Money `json:"returns"`
+	NetSales          money.Money `json:"net_sales"`
+	TotalTransactions int         `json:"total_transactions"`
+	// TaxCollected is tax on sales less tax refunded on returns, per rate.
+	TaxCollected []TaxSummaryLine `json:"tax_collected"`
+	// Payments breaks down what was taken on the period's sales by tender,
+	// net of change given.
+	Payments           []PaymentSummaryLine `json:"payments"`
+	BestSellingProduct *BestSellingProduct  `json:"best_selling_product,omitempty"`
+	// ProductSales is ordered by quantity sold, variants rolled up to their
+	// parent.
+	ProductSales []ProductSalesLine `json:"product_sales"`
+	// BundleComponents attributes what was taken for bundles to the
+	// products they were made of, split by the configured allocation rule.
+	// Bundles are still listed under their own name in ProductSales.
+	BundleComponents []ProductSalesLine `json:"bundle_components"`
+}
+
+// MarginLine is the gross profit on a product or category: what its sales
+// took net of tax, less what the stock sold cost, both net of returns on
+// those sales.
+type MarginLine struct {
+	ProductID    int               `json:"product_id,omitempty"`
+	CategoryID   int               `json:"category_id,omitempty"`
+	Name         string            `json:"name"`
+	QuantitySold quantity.Quantity `json:"quantity_sold,omitempty"`
+	Revenue      money.Money       `json:"revenue"`
+	Cost         money.Money       `json:"cost"`
+	GrossProfit  money.Money       `json:"gross_profit"`
+}
+
+// MarginReport is gross profit over a range of sale dates. Products and
+// categories are ordered by gross profit; a category is the one frozen on
+// the sale.
+type MarginReport struct {
+	StartDate   string       `json:"start_date"`
+	EndDate     string       `json:"end_date"`
+	Revenue     money.Money  `json:"revenue"`
+	Cost        money.Money  `json:"cost"`
+	GrossProfit money.Money  `json:"gross_profit"`
+	Products    []MarginLine `json:"products"`
+	Categories  []MarginLine `json:"categories"`
+}
+
+// InventoryValuationLine is what one product had in stock at the end of a
+// day and what that stock cost, as the stock ledger had it.
+type InventoryValuationLine struct {
+	ProductID    int               `json:"product_id"`
+	Name         string            `json:"name"`
+	CategoryID   int               `json:"category_id,omitempty"`
+	CategoryName string            `json:"category_name,omitempty"`
+	Unit         string            `json:"unit"`
+	Stock        quantity.Quantity `json:"stock"`
+	Value        money.Money       `json:"value"`
+}
+
+// InventoryValuation is the cost of the stock on hand at the end of AsOf.
+// Products are listed under their current category.
+type InventoryValuation struct {
+	AsOf       string                   `json:"as_of"`
+	TotalValue money.Money              `json:"total_value"`
+	Products   []InventoryValuationLine `json:"products"`
 }
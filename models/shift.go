@@ -0,0 +1,94 @@
+package models
+
+import (
+	"cashier-api/money"
+	"errors"
+	"time"
+)
+
+const (
+	ShiftStatusOpen   = "open"
+	ShiftStatusClosed = "closed"
+
+	CashMovementPayIn  = "pay_in"
+	CashMovementPayOut = "pay_out"
+
+	ShiftReportX = "x"
+	ShiftReportZ = "z"
+)
+
+var (
+	ErrShiftNotFound    = errors.New("shift not found")
+	ErrShiftClosed      = errors.New("shift is closed")
+	ErrShiftStillOpen   = errors.New("shift is still open")
+	ErrShiftAlreadyOpen = errors.New("register already has an open shift")
+)
+
+// Shift is one cashier's session on a till, from the opening float to the
+// counted cash at close.
+type Shift struct {
+	ID           int          `json:"id"`
+	Register     string       `json:"register"`
+	OpenedBy     string       `json:"opened_by"`
+	OpeningFloat money.Money  `json:"opening_float"`
+	Status       string       `json:"status"`
+	OpenedAt     time.Time    `json:"opened_at"`
+	ClosedBy     string       `json:"closed_by,omitempty"`
+	ClosedAt     *time.Time   `json:"closed_at,omitempty"`
+	CountedCash  *money.Money `json:"counted_cash,omitempty"`
+}
+
+type OpenShiftRequest struct {
+	Register     string      `json:"register"`
+	OpenedBy     string      `json:"opened_by"`
+	OpeningFloat money.Money `json:"opening_float"`
+}
+
+// CloseShiftRequest closes a shift. CountedCash is required: a drawer
+// counted empty is sent as 0, not left out.
+type CloseShiftRequest struct {
+	ClosedBy    string       `json:"closed_by"`
+	CountedCash *money.Money `json:"counted_cash"`
+}
+
+// CashMovement is cash put into (pay-in) or taken out of (pay-out) the drawer
+// for something other than a sale, such as topping up change or paying a
+// supplier.
+type CashMovement struct {
+	ID          int         `json:"id"`
+	ShiftID     int         `json:"shift_id"`
+	Type        string      `json:"type"`
+	Amount      money.Money `json:"amount"`
+	Reason      string      `json:"reason"`
+	PerformedBy string      `json:"performed_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// ReversalTotal counts and totals voids or refunds.
+type ReversalTotal struct {
+	Count  int         `json:"count"`
+	Amount money.Money `json:"amount"`
+}
+
+// ShiftReport is the X-report (mid-shift, read only) or Z-report (at close)
+// for a shift. ExpectedCash is the opening float plus cash sales and pay-ins,
+// less pay-outs and cash refunds.
+type ShiftReport struct {
+	Type          string               `json:"type"`
+	Shift         Shift                `json:"shift"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Transactions  int                  `json:"transactions"`
+	GrossSales    money.Money          `json:"gross_sales"`
+	SalesByTender []PaymentSummaryLine `json:"sales_by_tender"`
+	Voids         ReversalTotal        `json:"voids"`
+	Refunds       ReversalTotal        `json:"refunds"`
+	OpeningFloat  money.Money          `json:"opening_float"`
+	CashSales     money.Money          `json:"cash_sales"`
+	PayIns        money.Money          `json:"pay_ins"`
+	PayOuts       money.Money          `json:"pay_outs"`
+	ExpectedCash  money.Money          `json:"expected_cash"`
+	// CountedCash and Variance (counted less expected) are only set once the
+	// shift is closed.
+	CountedCash *money.Money `json:"counted_cash,omitempty"`
+	Variance    *money.Money `json:"variance,omitempty"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reasons a product's stock changes. Every change is written to the stock
+// ledger under one of these.
+const (
+	StockMovementSale       = "sale"
+	StockMovementReturn     = "return"
+	StockMovementReceipt    = "receipt"
+	StockMovementAdjustment = "adjustment"
+	StockMovementDamage     = "damage"
+	StockMovementTransfer   = "transfer"
+	StockMovementStocktake  = "stocktake"
+)
+
+var ErrInvalidStockAdjustment = errors.New("invalid stock adjustment")
+
+// CostingMethod is how stock leaving the shelves is costed.
+type CostingMethod string
+
+const (
+	// CostAverage costs stock at the weighted average of what is on hand;
+	// each receipt blends its cost into the product's cost price.
+	CostAverage CostingMethod = "average"
+	// CostFIFO costs stock from the oldest receipt still on hand; the
+	// product's cost price is the cost of the next unit out.
+	CostFIFO CostingMethod = "fifo"
+)
+
+func ParseCostingMethod(s string) (CostingMethod, error) {
+	switch method := CostingMethod(s); method {
+	case "":
+		return CostAverage, nil
+	case CostAverage, CostFIFO:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown costing method %q", s)
+	}
+}
+
+// StockMovement is one line of a product's stock ledger. Quantity is signed:
+// sales, damage and transfers out take stock away, returns, receipts and
+// transfers in add it. StockAfter is the product's stock once the movement
+// was applied, so the sum of a product's movements is its stock. A movement
+// points at the sale, return or goods receipt behind it, if any. Movements
+// outlive their product, under ProductName as it was when they were made.
+//
+// Value is what the movement cost, signed like Quantity, so the sum of a
+// product's movement values is what its stock is worth. UnitCost is Value
+// per unit; a receipt sets it to what the goods were bought at.
+type StockMovement struct {
+	ID             int               `json:"id"`
+	ProductID      int               `json:"product_id"`
+	ProductName    string            `json:"product_name"`
+	Type           string            `json:"type"`
+	Quantity       quantity.Quantity `json:"quantity"`
+	StockAfter     quantity.Quantity `json:"stock_after"`
+	UnitCost       money.Money       `json:"unit_cost"`
+	Value          money.Money       `json:"value"`
+	Reason         string            `json:"reason,omitempty"`
+	PerformedBy    string            `json:"performed_by,omitempty"`
+	TransactionID  int               `json:"transaction_id,omitempty"`
+	ReturnID       int               `json:"return_id,omitempty"`
+	GoodsReceiptID int               `json:"goods_receipt_id,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// StockAdjustmentRequest changes stock by hand. Type is adjustment, damage
+// or transfer; Quantity is signed the same way as on StockMovement.
+type StockAdjustmentRequest struct {
+	Type        string            `json:"type"`
+	Quantity    quantity.Quantity `json:"quantity"`
+	Reason      string            `json:"reason"`
+	PerformedBy string            `json:"performed_by"`
+}
+
+// StockDrift is a product whose stock column no longer matches the sum of
+// its ledger, as found by stock reconciliation.
+type StockDrift struct {
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name"`
+	Stock       quantity.Quantity `json:"stock"`
+	LedgerStock quantity.Quantity `json:"ledger_stock"`
+}
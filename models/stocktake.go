@@ -0,0 +1,101 @@
+package models
+
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"errors"
+	"time"
+)
+
+const (
+	StocktakeStatusOpen      = "open"
+	StocktakeStatusPosted    = "posted"
+	StocktakeStatusCancelled = "cancelled"
+)
+
+var (
+	ErrStocktakeNotFound = errors.New("stocktake not found")
+	ErrInvalidStocktake  = errors.New("invalid stocktake")
+	ErrStocktakeClosed   = errors.New("stocktake is no longer open")
+	// ErrStocktakeOverlap is returned when opening a stocktake over products
+	// another open stocktake is already counting.
+	ErrStocktakeOverlap = errors.New("products are already being counted")
+)
+
+// Stocktake is a count of the shelves, of every product or of one category.
+// Expected stock is taken from the stock ledger when it opens; posting it
+// brings stock in line with what was counted.
+type Stocktake struct {
+	ID int `json:"id"`
+	// CategoryID is zero when every product is counted.
+	CategoryID   int              `json:"category_id,omitempty"`
+	CategoryName string           `json:"category_name,omitempty"`
+	Status       string           `json:"status"`
+	Note         string           `json:"note,omitempty"`
+	OpenedBy     string           `json:"opened_by"`
+	OpenedAt     time.Time        `json:"opened_at"`
+	ClosedBy     string           `json:"closed_by,omitempty"`
+	ClosedAt     *time.Time       `json:"closed_at,omitempty"`
+	Lines        []StocktakeLine  `json:"lines,omitempty"`
+	Totals       *StocktakeTotals `json:"totals,omitempty"`
+}
+
+// StocktakeLine is one product to count.
+//
+// Expected is its stock when the stocktake opened. Sales, returns and
+// receipts made while the count is open move stock on, so ExpectedAtCount is
+// its stock when it was last counted.
+// Variance is Counted less ExpectedAtCount, valued at the product's cost
+// price when the stocktake opened. Counted is empty until someone counts the
+// product.
+type StocktakeLine struct {
+	ProductID       int                `json:"product_id"`
+	ProductName     string             `json:"product_name"`
+	Unit            string             `json:"unit"`
+	UnitCost        money.Money        `json:"unit_cost"`
+	Expected        quantity.Quantity  `json:"expected"`
+	ExpectedAtCount quantity.Quantity  `json:"expected_at_count"`
+	Counted         *quantity.Quantity `json:"counted,omitempty"`
+	Variance        quantity.Quantity  `json:"variance"`
+	VarianceValue   money.Money        `json:"variance_value"`
+	Counts          []StocktakeCount   `json:"counts,omitempty"`
+}
+
+// StocktakeCount is what one counter found of a product. When several people
+// count the same product, say on different shelves, their counts add up.
+type StocktakeCount struct {
+	CountedBy string            `json:"counted_by"`
+	Quantity  quantity.Quantity `json:"quantity"`
+	CountedAt time.Time         `json:"counted_at"`
+}
+
+type StocktakeTotals struct {
+	Products      int         `json:"products"`
+	Counted       int         `json:"counted"`
+	VarianceValue money.Money `json:"variance_value"`
+}
+
+type OpenStocktakeRequest struct {
+	CategoryID int    `json:"category_id"`
+	Note       string `json:"note"`
+	OpenedBy   string `json:"opened_by"`
+}
+
+// StocktakeCountRequest records a counter's count of a product. Sending it
+// again for the same product and counter replaces the earlier count.
+type StocktakeCountRequest struct {
+	ProductID int               `json:"product_id"`
+	Quantity  quantity.Quantity `json:"quantity"`
+	CountedBy string            `json:"counted_by"`
+}
+
+// PostStocktakeRequest posts a stocktake. Products nobody counted are left
+// as they are unless ZeroUncounted is set, which counts them as none left.
+type PostStocktakeRequest struct {
+	PostedBy      string `json:"posted_by"`
+	ZeroUncounted bool   `json:"zero_uncounted"`
+}
+
+type CancelStocktakeRequest struct {
+	CancelledBy string `json:"cancelled_by"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrSupplierNotFound = errors.New("supplier not found")
+	ErrInvalidSupplier  = errors.New("invalid supplier")
+	// ErrSupplierInUse is returned when deleting a supplier that purchase
+	// orders were raised with.
+	ErrSupplierInUse = errors.New("supplier has purchase orders")
+)
+
+type Supplier struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	ContactName string    `json:"contact_name,omitempty"`
+	Phone       string    `json:"phone,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"cashier-api/money"
+	"cashier-api/tax"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTaxRateNotFound = errors.New("tax rate not found")
+	ErrInvalidTaxRate  = errors.New("invalid tax rate")
+)
+
+// TaxRate is a named tax such as PPN. Its percentage lives in periods so a
+// change can be scheduled ahead and old sales keep the rate they used.
+type TaxRate struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// Rate is the percentage in effect now, taken from Periods.
+	Rate    tax.Rate        `json:"rate"`
+	Periods []TaxRatePeriod `json:"periods,omitempty"`
+}
+
+type TaxRatePeriod struct {
+	ID            int       `json:"id"`
+	TaxRateID     int       `json:"tax_rate_id"`
+	Rate          tax.Rate  `json:"rate"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// TaxRateRequest creates a tax rate or schedules a new percentage for one.
+// A zero EffectiveFrom means now.
+type TaxRateRequest struct {
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Rate          tax.Rate  `json:"rate"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+// TaxSummaryLine totals one rate across the lines of a transaction or a
+// report period.
+type TaxSummaryLine struct {
+	TaxCode       string      `json:"tax_code"`
+	Rate          tax.Rate    `json:"rate"`
+	TaxableAmount money.Money `json:"taxable_amount"`
+	TaxAmount     money.Money `json:"tax_amount"`
+}
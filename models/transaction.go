@@ -1,19 +1,189 @@
 package models
 
-import "time"
+import (
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"cashier-api/tax"
+	"errors"
+	"time"
+)
+
+const (
+	TransactionStatusCompleted = "completed"
+	TransactionStatusVoided    = "voided"
+	TransactionStatusRefunded  = "refunded"
+	// TransactionStatusPartiallyRefunded marks a sale with some, but not all,
+	// of its lines returned.
+	TransactionStatusPartiallyRefunded = "partially_refunded"
+)
+
+var (
+	ErrInvalidCursor            = errors.New("invalid cursor")
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrTransactionNotVoidable   = errors.New("only completed transactions from the current day can be voided")
+	ErrTransactionNotRefundable = errors.New("only completed or partially refunded transactions can be refunded")
+	ErrInvalidReturn            = errors.New("invalid return")
+)
 
 type Transaction struct {
-	ID          int                 `json:"id"`
-	TotalAmount int                 `json:"total_amount"`
-	CreatedAt   time.Time           `json:"created_at"`
-	Details     []TransactionDetail `json:"details"`
+	ID int `json:"id"`
+	// ReceiptNumber is the gapless per-store number printed on the receipt.
+	// Sales from before numbering existed have none.
+	ReceiptNumber string      `json:"receipt_number,omitempty"`
+	ShiftID       int         `json:"shift_id,omitempty"`
+	CustomerID    int         `json:"customer_id,omitempty"`
+	TotalAmount   money.Money `json:"total_amount"`
+	Currency      string      `json:"currency"`
+	// TaxAmount is the tax contained in (inclusive pricing) or added to
+	// (exclusive pricing) TotalAmount.
+	TaxAmount    money.Money `json:"tax_amount"`
+	TaxInclusive bool        `json:"tax_inclusive"`
+	// DiscountAmount is the total taken off by promotions.
+	DiscountAmount money.Money      `json:"discount_amount"`
+	TaxSummary     []TaxSummaryLine `json:"tax_summary"`
+	// ChangeAmount is the cash handed back to the customer.
+	ChangeAmount money.Money `json:"change_amount"`
+	// CashRounding is what rounding the cash part to the cash rounding
+	// increment added to TotalAmount, negative when it was rounded down. The
+	// customer paid TotalAmount plus CashRounding.
+	CashRounding money.Money          `json:"cash_rounding"`
+	Payments     []TransactionPayment `json:"payments"`
+	// PointsEarned and PointsRedeemed are the loyalty points the sale added
+	// to and took from the customer's balance.
+	PointsEarned   int64               `json:"points_earned,omitempty"`
+	PointsRedeemed int64               `json:"points_redeemed,omitempty"`
+	Status         string              `json:"status"`
+	CreatedAt      time.Time           `json:"created_at"`
+	VoidedAt       *time.Time          `json:"voided_at,omitempty"`
+	VoidReason     string              `json:"void_reason,omitempty"`
+	VoidedBy       string              `json:"voided_by,omitempty"`
+	Details        []TransactionDetail `json:"details"`
+	// Replayed is set when the transaction was returned from an earlier
+	// request with the same idempotency key instead of being created.
+	Replayed bool `json:"-"`
+	// LowStock lists the products this sale took down to their reorder
+	// point, to be alerted once the sale is committed.
+	LowStock []LowStockAlert `json:"-"`
 }
 
 type TransactionDetail struct {
-	ID            int    `json:"id"`
-	TransactionID int    `json:"transaction_id"`
-	ProductID     int    `json:"product_id"`
-	ProductName   string `json:"product_name,omitempty"`
-	Quantity      int    `json:"quantity"`
-	Subtotal      int    `json:"subtotal"`
+	ID            int `json:"id"`
+	TransactionID int `json:"transaction_id"`
+	ProductID     int `json:"product_id"`
+	// ProductName, UnitPrice, CategoryID, CategoryName and SKU are frozen at
+	// sale time so later product edits do not rewrite old receipts.
+	ProductName  string      `json:"product_name,omitempty"`
+	UnitPrice    money.Money `json:"unit_price"`
+	CategoryID   int         `json:"category_id,omitempty"`
+	CategoryName string      `json:"category_name,omitempty"`
+	SKU          string      `json:"sku,omitempty"`
+	// ParentProductID and ParentProductName are frozen for variant lines so
+	// sales roll up to the parent product.
+	ParentProductID   int    `json:"parent_product_id,omitempty"`
+	ParentProductName string `json:"parent_product_name,omitempty"`
+	// Unit is frozen with the price, which is per unit.
+	Quantity quantity.Quantity `json:"quantity"`
+	Unit     string            `json:"unit,omitempty"`
+	// Subtotal is unit price times quantity; TotalAmount is what was charged
+	// for the line: Subtotal less DiscountAmount, plus tax under exclusive
+	// pricing.
+	Subtotal       money.Money       `json:"subtotal"`
+	DiscountAmount money.Money       `json:"discount_amount"`
+	Discounts      []AppliedDiscount `json:"discounts"`
+	TaxRateID      int               `json:"tax_rate_id,omitempty"`
+	TaxCode        string            `json:"tax_code,omitempty"`
+	TaxRate        tax.Rate          `json:"tax_rate"`
+	TaxAmount      money.Money       `json:"tax_amount"`
+	TotalAmount    money.Money       `json:"total_amount"`
+	// CostAmount is what the stock sold on the line cost, frozen at sale
+	// time under the configured costing method.
+	CostAmount money.Money `json:"cost_amount"`
+	// ReturnedQuantity is how much of this line has been returned so far.
+	ReturnedQuantity quantity.Quantity `json:"returned_quantity"`
+	// Components is set on bundle lines: what one bundle was made of when
+	// sold, with each component's list price at the time.
+	Components []DetailComponent `json:"components,omitempty"`
+}
+
+type DetailComponent struct {
+	ProductID   int               `json:"product_id"`
+	ProductName string            `json:"product_name"`
+	Quantity    quantity.Quantity `json:"quantity"`
+	UnitPrice   money.Money       `json:"unit_price"`
+}
+
+// ReversalRequest is the body for voiding or refunding a transaction.
+type ReversalRequest struct {
+	Reason      string `json:"reason"`
+	PerformedBy string `json:"performed_by"`
+	// ShiftID is the open shift whose drawer pays out a refund. It is ignored
+	// for voids, which always go back to the shift of the sale.
+	ShiftID int `json:"shift_id,omitempty"`
+	// GiftCardCode credits a refund to that gift card instead of paying it
+	// out of a drawer. Voids always restore gift card tenders to their cards.
+	GiftCardCode string `json:"gift_card_code,omitempty"`
+}
+
+type ReturnItemRequest struct {
+	DetailID int               `json:"detail_id"`
+	Quantity quantity.Quantity `json:"quantity"`
+	// Restock defaults to true; send false for damaged goods that must not
+	// go back on the shelf.
+	Restock *bool `json:"restock,omitempty"`
+}
+
+type ReturnRequest struct {
+	Reason      string `json:"reason"`
+	PerformedBy string `json:"performed_by"`
+	// ShiftID is the open shift whose drawer pays out the refund in cash.
+	ShiftID int `json:"shift_id,omitempty"`
+	// GiftCardCode credits the refund to that gift card instead.
+	GiftCardCode string              `json:"gift_card_code,omitempty"`
+	Items        []ReturnItemRequest `json:"items"`
+}
+
+// TransactionReturn is a refund document. A full refund produces a single
+// return covering everything not yet returned.
+type TransactionReturn struct {
+	ID            int                     `json:"id"`
+	TransactionID int                     `json:"transaction_id"`
+	ShiftID       int                     `json:"shift_id,omitempty"`
+	GiftCardCode  string                  `json:"gift_card_code,omitempty"`
+	RefundAmount  money.Money             `json:"refund_amount"`
+	Reason        string                  `json:"reason"`
+	PerformedBy   string                  `json:"performed_by"`
+	CreatedAt     time.Time               `json:"created_at"`
+	Items         []TransactionReturnItem `json:"items"`
+}
+
+type TransactionReturnItem struct {
+	ID           int               `json:"id"`
+	ReturnID     int               `json:"return_id"`
+	DetailID     int               `json:"detail_id"`
+	ProductID    int               `json:"product_id"`
+	Quantity     quantity.Quantity `json:"quantity"`
+	RefundAmount money.Money       `json:"refund_amount"`
+	// TaxAmount is the part of RefundAmount that was tax.
+	TaxAmount money.Money `json:"tax_amount"`
+	Restocked bool        `json:"restocked"`
+}
+
+// TransactionFilter narrows the transaction list. Zero values mean no filter.
+type TransactionFilter struct {
+	StartDate  string
+	EndDate    string
+	MinTotal   *money.Money
+	MaxTotal   *money.Money
+	ProductID  int
+	CustomerID int
+	// ReceiptNumber matches receipt numbers starting with it, so a store and
+	// period prefix lists that period's sales.
+	ReceiptNumber string
+	Cursor        string
+	Limit         int
+}
+
+type TransactionPage struct {
+	Data       []Transaction `json:"data"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
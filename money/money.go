@@ -0,0 +1,360 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount held as integer minor units (cents, sen) plus an
+// ISO 4217 currency code. The zero value is zero in the default currency.
+type Money struct {
+	amount   int64
+	currency string
+}
+
+var defaultCurrency = "IDR"
+
+// exponents lists currencies whose minor unit is not 1/100.
+var exponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+}
+
+var ErrInvalidAmount = errors.New("invalid money amount")
+
+// SetDefaultCurrency sets the currency used for amounts that arrive without
+// one, such as amount columns and JSON strings. Call it once at startup.
+func SetDefaultCurrency(code string) {
+	if code != "" {
+		defaultCurrency = strings.ToUpper(code)
+	}
+}
+
+func DefaultCurrency() string {
+	return defaultCurrency
+}
+
+// Exponent returns the number of decimal places of the currency's minor unit.
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// New returns an amount of minor units in the given currency.
+func New(minor int64, currency string) Money {
+	return Money{amount: minor, currency: strings.ToUpper(currency)}
+}
+
+// FromMinor returns an amount of minor units in the default currency.
+func FromMinor(minor int64) Money {
+	return Money{amount: minor}
+}
+
+// Parse reads a decimal string such as "699.99" in the default currency.
+func Parse(s string) (Money, error) {
+	return ParseIn(s, "")
+}
+
+// ParseIn reads a decimal string in the given currency. More fractional digits
+// than the currency has are rejected unless they are trailing zeros.
+func ParseIn(s, currency string) (Money, error) {
+	m := Money{currency: strings.ToUpper(currency)}
+	exp := Exponent(m.Currency())
+
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	intPart, frac, _ := strings.Cut(s, ".")
+	if intPart == "" && frac == "" {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if !isDigits(intPart) || !isDigits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > exp {
+		if strings.TrimRight(frac[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, s, exp)
+		}
+		frac = frac[:exp]
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	amount, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if neg {
+		amount = -amount
+	}
+	m.amount = amount
+
+	return m, nil
+}
+
+// MustParse is Parse for constants; it panics on malformed input.
+func MustParse(s string) Money {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns the amount in minor units.
+func (m Money) Minor() int64 {
+	return m.amount
+}
+
+func (m Money) Currency() string {
+	if m.currency == "" {
+		return defaultCurrency
+	}
+	return m.currency
+}
+
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.amount > 0
+}
+
+func (m Money) Neg() Money {
+	return Money{amount: -m.amount, currency: m.currency}
+}
+
+// Add and the other arithmetic methods panic when mixing currencies; that is
+// always a programming error, never bad input.
+func (m Money) Add(o Money) Money {
+	return Money{amount: m.amount + o.amount, currency: m.sameCurrency(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{amount: m.amount - o.amount, currency: m.sameCurrency(o)}
+}
+
+// Mul multiplies by a whole quantity, which never needs rounding.
+func (m Money) Mul(n int64) Money {
+	return Money{amount: m.amount * n, currency: m.currency}
+}
+
+// MulRat multiplies by num/den and rounds the result to a minor unit.
+func (m Money) MulRat(num, den int64, mode RoundingMode) Money {
+	if den == 0 {
+		panic("money: division by zero")
+	}
+	product := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(num))
+	return Money{amount: divRoundBig(product, big.NewInt(den), mode), currency: m.currency}
+}
+
+// Cmp returns -1, 0 or +1 depending on whether m is less than, equal to or
+// greater than o.
+func (m Money) Cmp(o Money) int {
+	m.sameCurrency(o)
+	switch {
+	case m.amount < o.amount:
+		return -1
+	case m.amount > o.amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return m
+	}
+	return o
+}
+
+// Allocate splits m across the weights without losing or inventing minor
+// units: each share is floored and the leftover units go to the shares with
+// the largest remainders, earliest first on ties. Zero total weight splits
+// evenly.
+func (m Money) Allocate(weights []int64) []Money {
+	shares := make([]Money, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		weights = make([]int64, len(weights))
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = int64(len(weights))
+	}
+
+	sign := int64(1)
+	amount := m.amount
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	allocated := int64(0)
+	bigTotal := big.NewInt(total)
+	for i, w := range weights {
+		product := new(big.Int).Mul(big.NewInt(amount), big.NewInt(w))
+		q, r := new(big.Int).QuoRem(product, bigTotal, new(big.Int))
+		shares[i] = Money{amount: q.Int64(), currency: m.currency}
+		remainders[i] = r
+		allocated += q.Int64()
+	}
+
+	for left := amount - allocated; left > 0; left-- {
+		best := 0
+		for i := range remainders {
+			if remainders[i].Cmp(remainders[best]) > 0 {
+				best = i
+			}
+		}
+		shares[best].amount++
+		remainders[best] = big.NewInt(-1)
+	}
+
+	for i := range shares {
+		shares[i].amount *= sign
+	}
+	return shares
+}
+
+// Sum adds amounts together; the sum of nothing is zero.
+func Sum(amounts ...Money) Money {
+	var total Money
+	for _, a := range amounts {
+		total = total.Add(a)
+	}
+	return total
+}
+
+func (m Money) sameCurrency(o Money) string {
+	if m.currency == "" {
+		return o.currency
+	}
+	if o.currency != "" && o.currency != m.currency {
+		panic(fmt.Sprintf("money: currency mismatch %s and %s", m.currency, o.currency))
+	}
+	return m.currency
+}
+
+// String formats the amount as a plain decimal such as "-12.50".
+func (m Money) String() string {
+	exp := Exponent(m.Currency())
+	amount := m.amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	pow := pow10(exp)
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/pow, exp, amount%pow)
+}
+
+// MarshalJSON encodes the amount as a decimal string so clients never see
+// binary floating point.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both "699.99" and 699.99.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*m = Money{}
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads amount columns, which hold integer minor units, into the
+// default currency. BIGINT columns arrive as int64; their SUMs are NUMERIC
+// and arrive as text, which must also be a whole number of minor units.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case []byte:
+		return m.scanMinor(string(v))
+	case string:
+		return m.scanMinor(v)
+	case int64:
+		*m = Money{amount: v}
+		return nil
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+}
+
+func (m *Money) scanMinor(s string) error {
+	minor, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a whole number of minor units", ErrInvalidAmount, s)
+	}
+	*m = Money{amount: minor}
+	return nil
+}
+
+// Value writes the amount as integer minor units, the way amount columns
+// store it.
+func (m Money) Value() (driver.Value, error) {
+	return m.amount, nil
+}
+
+func pow10(exp int) int64 {
+	p := int64(1)
+	for i := 0; i < exp; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,107 @@
+package money
+
+import (
+	"strconv"
+	"testing"
+	"testing/quick"
+)
+
+func TestValueScanRoundTrip(t *testing.T) {
+	roundTrip := func(minor int64) bool {
+		m := FromMinor(minor)
+		v, err := m.Value()
+		if err != nil {
+			return false
+		}
+		var fromInt, fromSum Money
+		if err := fromInt.Scan(v); err != nil {
+			return false
+		}
+		if err := fromSum.Scan([]byte(strconv.FormatInt(minor, 10))); err != nil {
+			return false
+		}
+		return fromInt.Cmp(m) == 0 && fromSum.Cmp(m) == 0
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScanRejectsFractionsOfMinorUnits(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("1250.5")); err == nil {
+		t.Errorf("Scan(1250.5) = %s, want an error", m)
+	}
+}
+
+func TestSumOfLinesIsTheTotal(t *testing.T) {
+	sumOfLines := func(lines []int32) bool {
+		amounts := make([]Money, len(lines))
+		var want int64
+		for i, l := range lines {
+			amounts[i] = FromMinor(int64(l))
+			want += int64(l)
+		}
+		return Sum(amounts...).Minor() == want
+	}
+	if err := quick.Check(sumOfLines, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAllocateAddsUpToTheAmount(t *testing.T) {
+	addsUp := func(amount int32, weights []uint16) bool {
+		w := make([]int64, len(weights))
+		for i, weight := range weights {
+			w[i] = int64(weight)
+		}
+		shares := FromMinor(int64(amount)).Allocate(w)
+		if len(shares) != len(w) {
+			return false
+		}
+		if len(shares) == 0 {
+			return true
+		}
+		return Sum(shares...).Minor() == int64(amount)
+	}
+	if err := quick.Check(addsUp, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoundLandsOnTheNearestIncrement(t *testing.T) {
+	nearest := func(amount int32, increment uint16, halfEven bool) bool {
+		step := int64(increment) + 2
+		mode := HalfUp
+		if halfEven {
+			mode = HalfEven
+		}
+		rounded := FromMinor(int64(amount)).Round(Rounding{Mode: mode, Increment: FromMinor(step)}).Minor()
+		diff := rounded - int64(amount)
+		if diff < 0 {
+			diff = -diff
+		}
+		return rounded%step == 0 && 2*diff <= step
+	}
+	if err := quick.Check(nearest, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoundCashToRp100(t *testing.T) {
+	cash := Rounding{Mode: HalfUp, Increment: MustParse("100")}
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{"9950", "10000.00"},
+		{"9949", "9900.00"},
+		{"10000", "10000.00"},
+		{"49.99", "0.00"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.amount).Round(cash).String(); got != tt.want {
+			t.Errorf("Round(%s) = %s, want %s", tt.amount, got, tt.want)
+		}
+	}
+}
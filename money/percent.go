@@ -0,0 +1,61 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Percent is a percentage held in basis points, so 11% is 1100 and 12.5% is
+// 1250.
+type Percent int64
+
+var ErrInvalidPercent = errors.New("invalid percentage")
+
+// ParsePercent reads a percentage between 0 and 100 with up to two decimals,
+// such as "11" or "12.5".
+func ParsePercent(s string) (Percent, error) {
+	s = strings.TrimSpace(s)
+	intPart, frac, _ := strings.Cut(s, ".")
+	if intPart == "" || len(frac) > 2 || !isDigits(intPart) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPercent, s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	bps, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if err != nil || bps > 10000 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPercent, s)
+	}
+	return Percent(bps), nil
+}
+
+func (p Percent) String() string {
+	return fmt.Sprintf("%d.%02d", int64(p)/100, int64(p)%100)
+}
+
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON accepts both "11.00" and 11.
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParsePercent(text)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// Percent returns p percent of m, rounded to a minor unit.
+func (m Money) Percent(p Percent, mode RoundingMode) Money {
+	return m.MulRat(int64(p), 10000, mode)
+}
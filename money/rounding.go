@@ -0,0 +1,77 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type RoundingMode int
+
+const (
+	// HalfUp rounds halves away from zero: 2.5 becomes 3, -2.5 becomes -3.
+	HalfUp RoundingMode = iota
+	// HalfEven rounds halves to the nearest even number (banker's rounding):
+	// 2.5 becomes 2, 3.5 becomes 4.
+	HalfEven
+)
+
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch strings.ToLower(s) {
+	case "", "half_up":
+		return HalfUp, nil
+	case "half_even", "bankers":
+		return HalfEven, nil
+	default:
+		return HalfUp, fmt.Errorf("unknown rounding mode %q", s)
+	}
+}
+
+func (r RoundingMode) String() string {
+	if r == HalfEven {
+		return "half_even"
+	}
+	return "half_up"
+}
+
+// Rounding is a rounding rule: a mode plus the step amounts are rounded to.
+// An Increment of 100.00 IDR rounds cash totals to the nearest Rp100; a zero
+// Increment leaves amounts at minor-unit precision.
+type Rounding struct {
+	Mode      RoundingMode
+	Increment Money
+}
+
+// Round applies the rounding rule to m.
+func (m Money) Round(r Rounding) Money {
+	step := r.Increment.amount
+	if step <= 1 {
+		return m
+	}
+	q := divRoundBig(big.NewInt(m.amount), big.NewInt(step), r.Mode)
+	return Money{amount: q * step, currency: m.currency}
+}
+
+// divRoundBig divides n by d and rounds the quotient according to mode.
+func divRoundBig(n, d *big.Int, mode RoundingMode) int64 {
+	if d.Sign() < 0 {
+		n = new(big.Int).Neg(n)
+		d = new(big.Int).Neg(d)
+	}
+	neg := n.Sign() < 0
+	abs := new(big.Int).Abs(n)
+
+	q, r := new(big.Int).QuoRem(abs, d, new(big.Int))
+	twice := new(big.Int).Lsh(r, 1)
+	switch cmp := twice.Cmp(d); {
+	case cmp > 0:
+		q.Add(q, big.NewInt(1))
+	case cmp == 0 && (mode == HalfUp || q.Bit(0) == 1):
+		q.Add(q, big.NewInt(1))
+	}
+
+	if neg {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
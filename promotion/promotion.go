@@ -0,0 +1,204 @@
+package promotion
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"sort"
+)
+
+// Line is a cart line as the engine sees it. Lines are expected to hold one
+// product each. Buy-X-get-Y and bundles count whole units only, so a
+// weighed line never earns a free fraction.
+type Line struct {
+	ProductID  int
+	CategoryID int
+	UnitPrice  money.Money
+	Quantity   quantity.Quantity
+}
+
+func (l Line) amount(mode money.RoundingMode) money.Money {
+	return l.Quantity.Price(l.UnitPrice, mode)
+}
+
+// Apply evaluates promotions against the cart and returns the discounts
+// applied to each line, indexed like lines.
+//
+// Evaluation is deterministic: line-level promotions run before order-level
+// ones, then by priority and ID. Every promotion sees the line amounts left
+// after the ones before it, and a line is never discounted below zero.
+// Order-level discounts are spread over the eligible lines in proportion to
+// what is left on them, so per-line tax stays correct.
+func Apply(lines []Line, promotions []models.Promotion, mode money.RoundingMode) [][]models.AppliedDiscount {
+	applied := make([][]models.AppliedDiscount, len(lines))
+	remaining := make([]money.Money, len(lines))
+	for i, l := range lines {
+		remaining[i] = l.amount(mode)
+	}
+
+	ordered := append([]models.Promotion(nil), promotions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		li, lj := isOrderLevel(ordered[i]), isOrderLevel(ordered[j])
+		if li != lj {
+			return !li
+		}
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority < ordered[j].Priority
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	for _, p := range ordered {
+		eligible := make([]int, 0)
+		eligibleTotal := money.Money{}
+		for i, l := range lines {
+			if targets(p, l) && remaining[i].IsPositive() {
+				eligible = append(eligible, i)
+				eligibleTotal = eligibleTotal.Add(remaining[i])
+			}
+		}
+		if len(eligible) == 0 || eligibleTotal.Cmp(p.MinSpend) < 0 {
+			continue
+		}
+
+		discounts := make(map[int]money.Money)
+		switch {
+		case p.Type == models.PromotionTypePercentage && isOrderLevel(p):
+			spread(discounts, eligible, remaining, eligibleTotal.Percent(p.Percent, mode))
+		case p.Type == models.PromotionTypePercentage:
+			for _, i := range eligible {
+				discounts[i] = remaining[i].Percent(p.Percent, mode)
+			}
+		case p.Type == models.PromotionTypeFixedAmount && isOrderLevel(p):
+			spread(discounts, eligible, remaining, p.Amount.Min(eligibleTotal))
+		case p.Type == models.PromotionTypeFixedAmount:
+			for _, i := range eligible {
+				discounts[i] = lines[i].Quantity.Price(p.Amount, mode)
+			}
+		case p.Type == models.PromotionTypeBuyXGetY:
+			group := p.BuyQuantity + p.GetQuantity
+			if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+				continue
+			}
+			for _, i := range eligible {
+				free := lines[i].Quantity.Whole() / int64(group) * int64(p.GetQuantity)
+				discounts[i] = lines[i].UnitPrice.Mul(free)
+			}
+		case p.Type == models.PromotionTypeBundle:
+			applyBundle(discounts, p, lines, eligible)
+		}
+
+		for _, i := range eligible {
+			d, ok := discounts[i]
+			if !ok || !d.IsPositive() {
+				continue
+			}
+			d = d.Min(remaining[i])
+			remaining[i] = remaining[i].Sub(d)
+			applied[i] = append(applied[i], models.AppliedDiscount{
+				PromotionID:   p.ID,
+				PromotionName: p.Name,
+				Level:         levelOf(p),
+				Amount:        d,
+			})
+		}
+	}
+
+	return applied
+}
+
+// Total sums the discounts applied to one line.
+func Total(discounts []models.AppliedDiscount) money.Money {
+	total := money.Money{}
+	for _, d := range discounts {
+		total = total.Add(d.Amount)
+	}
+	return total
+}
+
+// applyBundle prices complete sets of the bundle's products at BundlePrice
+// and spreads the saving over the lines by list price.
+func applyBundle(discounts map[int]money.Money, p models.Promotion, lines []Line, eligible []int) {
+	if len(p.ProductIDs) == 0 {
+		return
+	}
+
+	members := make([]int, 0, len(p.ProductIDs))
+	sets := int64(-1)
+	listPrice := money.Money{}
+	for _, productID := range p.ProductIDs {
+		found := -1
+		for _, i := range eligible {
+			if lines[i].ProductID == productID {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return
+		}
+		members = append(members, found)
+		listPrice = listPrice.Add(lines[found].UnitPrice)
+		if whole := lines[found].Quantity.Whole(); sets < 0 || whole < sets {
+			sets = whole
+		}
+	}
+
+	saving := listPrice.Sub(p.BundlePrice)
+	if sets <= 0 || !saving.IsPositive() {
+		return
+	}
+
+	weights := make([]int64, len(members))
+	for k, i := range members {
+		weights[k] = lines[i].UnitPrice.Minor()
+	}
+	for k, share := range saving.Mul(sets).Allocate(weights) {
+		discounts[members[k]] = share
+	}
+}
+
+// spread allocates an order-level discount over the eligible lines in
+// proportion to their remaining amounts.
+func spread(discounts map[int]money.Money, eligible []int, remaining []money.Money, amount money.Money) {
+	weights := make([]int64, len(eligible))
+	for k, i := range eligible {
+		weights[k] = remaining[i].Minor()
+	}
+	for k, share := range amount.Allocate(weights) {
+		discounts[eligible[k]] = share
+	}
+}
+
+func targets(p models.Promotion, l Line) bool {
+	if len(p.ProductIDs) == 0 && len(p.CategoryIDs) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == l.ProductID {
+			return true
+		}
+	}
+	for _, id := range p.CategoryIDs {
+		if id == l.CategoryID && id != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isOrderLevel(p models.Promotion) bool {
+	return levelOf(p) == models.PromotionLevelOrder
+}
+
+// levelOf reports the level a promotion runs at. Buy-X-get-Y and bundles are
+// always line-level.
+func levelOf(p models.Promotion) string {
+	if p.Type == models.PromotionTypeBuyXGetY || p.Type == models.PromotionTypeBundle {
+		return models.PromotionLevelLine
+	}
+	if p.Level == models.PromotionLevelOrder {
+		return models.PromotionLevelOrder
+	}
+	return models.PromotionLevelLine
+}
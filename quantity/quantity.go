@@ -0,0 +1,187 @@
+// Package quantity holds exact decimal quantities of goods, so weighed and
+// measured items can be sold without binary floating point.
+package quantity
+
+import (
+	"cashier-api/money"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Quantity is an amount of a product in thousandths of its unit: 0.75 kg is
+// 750 and 24 pieces is 24000. Being an integer, quantities add, subtract and
+// compare with the ordinary operators.
+type Quantity int64
+
+// MaxPlaces is the most decimal places a quantity can carry.
+const MaxPlaces = 3
+
+// Scale is the number of Quantity units in one whole unit.
+const Scale = 1000
+
+var ErrInvalid = errors.New("invalid quantity")
+
+// FromInt returns n whole units.
+func FromInt(n int64) Quantity {
+	return Quantity(n * Scale)
+}
+
+// Parse reads a decimal string such as "0.75" or "24". More than MaxPlaces
+// decimals are rejected unless they are trailing zeros.
+func Parse(s string) (Quantity, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	intPart, frac, _ := strings.Cut(s, ".")
+	if intPart == "" && frac == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	if !isDigits(intPart) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	if len(frac) > MaxPlaces {
+		if strings.TrimRight(frac[MaxPlaces:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalid, s, MaxPlaces)
+		}
+		frac = frac[:MaxPlaces]
+	}
+	frac += strings.Repeat("0", MaxPlaces-len(frac))
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	n, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	if neg {
+		n = -n
+	}
+	return Quantity(n), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Whole returns the number of complete units, rounding toward zero.
+func (q Quantity) Whole() int64 {
+	return int64(q) / Scale
+}
+
+// Places returns how many decimal places q needs: 0 for 2, 2 for 0.75.
+func (q Quantity) Places() int {
+	n := int64(q)
+	places := MaxPlaces
+	for places > 0 && n%10 == 0 {
+		n /= 10
+		places--
+	}
+	return places
+}
+
+// Mul multiplies by another quantity, as when counting the pieces in three
+// cartons of 24. ok is false when the product needs more than MaxPlaces.
+func (q Quantity) Mul(o Quantity) (Quantity, bool) {
+	product := int64(q) * int64(o)
+	if product%Scale != 0 {
+		return 0, false
+	}
+	return Quantity(product / Scale), true
+}
+
+// Price returns the amount for q units at unitPrice, rounded to a minor
+// unit. Whole quantities never need rounding.
+func (q Quantity) Price(unitPrice money.Money, mode money.RoundingMode) money.Money {
+	return unitPrice.MulRat(int64(q), Scale, mode)
+}
+
+// String formats the quantity with as few decimals as it needs, such as
+// "2" or "0.75".
+func (q Quantity) String() string {
+	n := int64(q)
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	whole, frac := n/Scale, n%Scale
+	if frac == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", MaxPlaces, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, digits)
+}
+
+// MarshalJSON encodes the quantity as a JSON number written out in decimal,
+// so whole quantities look exactly as they did when they were integers.
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalJSON accepts both 0.75 and "0.75".
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*q = 0
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// Scan reads NUMERIC and integer columns.
+func (q *Quantity) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*q = 0
+		return nil
+	case []byte:
+		return q.scanString(string(v))
+	case string:
+		return q.scanString(v)
+	case int64:
+		*q = FromInt(v)
+		return nil
+	case float64:
+		return q.scanString(strconv.FormatFloat(v, 'f', MaxPlaces, 64))
+	default:
+		return fmt.Errorf("quantity: cannot scan %T", src)
+	}
+}
+
+func (q *Quantity) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// Value writes the quantity as a decimal string for NUMERIC columns.
+func (q Quantity) Value() (driver.Value, error) {
+	return q.String(), nil
+}
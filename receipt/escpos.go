@@ -0,0 +1,41 @@
+package receipt
+
+import "bytes"
+
+// ESC/POS command bytes.
+var (
+	escInit      = []byte{0x1b, '@'}
+	escAlign     = []byte{0x1b, 'a'}
+	escBold      = []byte{0x1b, 'E'}
+	escFeedLines = []byte{0x1b, 'd'}
+	gsCut        = []byte{0x1d, 'V', 66, 0}
+)
+
+// ESCPOS renders lines as an ESC/POS byte stream that a thermal printer can
+// print as is. The lines must already be laid out for the roll width; the
+// printer does the alignment and the cut.
+func ESCPOS(lines []Line) []byte {
+	var buf bytes.Buffer
+	buf.Write(escInit)
+
+	for _, line := range lines {
+		buf.Write(escAlign)
+		buf.WriteByte(byte(line.Align))
+		buf.Write(escBold)
+		if line.Bold {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.WriteString(ascii(line.Text))
+		buf.WriteByte('\n')
+	}
+
+	buf.Write(escBold)
+	buf.WriteByte(0)
+	buf.Write(escFeedLines)
+	buf.WriteByte(4)
+	buf.Write(gsCut)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// PDF layout in points. Courier is monospaced at 0.6 em, so a line of width
+// characters is exactly width * charWidth wide.
+const (
+	pdfFontSize   = 8.0
+	pdfCharWidth  = pdfFontSize * 0.6
+	pdfLineHeight = 10.0
+	pdfMargin     = 12.0
+)
+
+// PDF renders lines onto a single page the size of a receipt roll. It uses
+// the built-in Courier fonts, so no font is embedded and the output is the
+// same byte for byte for the same lines.
+func PDF(lines []Line, width int) []byte {
+	pageWidth := float64(width)*pdfCharWidth + 2*pdfMargin
+	pageHeight := float64(len(lines))*pdfLineHeight + 2*pdfMargin
+
+	var content strings.Builder
+	content.WriteString("BT\n")
+	for i, line := range lines {
+		font := "F1"
+		if line.Bold {
+			font = "F2"
+		}
+		indent := utf8.RuneCountInString(pad(line, width)) - utf8.RuneCountInString(line.Text)
+		x := pdfMargin + float64(indent)*pdfCharWidth
+		y := pageHeight - pdfMargin - float64(i+1)*pdfLineHeight + 2
+		fmt.Fprintf(&content, "/%s %.0f Tf 1 0 0 1 %.2f %.2f Tm (%s) Tj\n", font, pdfFontSize, x, y, pdfEscape(ascii(line.Text)))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Contents 4 0 R "+
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
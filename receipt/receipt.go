@@ -0,0 +1,294 @@
+package receipt
+
+import (
+	"bytes"
+	"cashier-api/models"
+	"cashier-api/money"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	FormatText   = "text"
+	FormatESCPOS = "escpos"
+	FormatPDF    = "pdf"
+)
+
+// Characters per line on the thermal rolls we print to, using the printer's
+// default font A.
+const (
+	Width58mm = 32
+	Width80mm = 48
+)
+
+var ErrUnknownFormat = errors.New("unknown receipt format")
+
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+)
+
+// Line is one printed line. Text is never wider than the layout width.
+type Line struct {
+	Text  string
+	Align Align
+	Bold  bool
+}
+
+// Data is what the header and footer templates are executed with.
+type Data struct {
+	Number      string
+	Date        time.Time
+	Transaction *models.Transaction
+}
+
+// Renderer lays receipts out between the store's header and footer templates
+// and encodes them in one of the supported formats.
+type Renderer struct {
+	header *template.Template
+	footer *template.Template
+}
+
+// NewRenderer parses the header and footer as text/template sources, such as
+// "TOKO MAJU\nJl. Merdeka 1" or "Receipt {{.Number}}".
+func NewRenderer(header, footer string) (*Renderer, error) {
+	h, err := template.New("header").Parse(header)
+	if err != nil {
+		return nil, fmt.Errorf("receipt header: %w", err)
+	}
+	f, err := template.New("footer").Parse(footer)
+	if err != nil {
+		return nil, fmt.Errorf("receipt footer: %w", err)
+	}
+	return &Renderer{header: h, footer: f}, nil
+}
+
+// Number is the receipt number printed for a transaction. Sales recorded
+// before receipt numbering fall back to their zero-padded ID.
+func Number(t *models.Transaction) string {
+	if t.ReceiptNumber != "" {
+		return t.ReceiptNumber
+	}
+	return fmt.Sprintf("%08d", t.ID)
+}
+
+// Render lays out the transaction at the given width in characters and
+// encodes it. It returns the body and its content type.
+func (r *Renderer) Render(t *models.Transaction, format string, width int) ([]byte, string, error) {
+	lines, err := r.Layout(t, width)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case FormatText:
+		return Text(lines, width), "text/plain; charset=utf-8", nil
+	case FormatESCPOS:
+		return ESCPOS(lines), "application/octet-stream", nil
+	case FormatPDF:
+		return PDF(lines, width), "application/pdf", nil
+	default:
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+var paymentLabels = map[string]string{
+	models.PaymentMethodCash:      "Cash",
+	models.PaymentMethodDebitCard: "Debit card",
+	models.PaymentMethodQRIS:      "QRIS",
+	models.PaymentMethodEWallet:   "E-wallet",
+	models.PaymentMethodVoucher:   "Voucher",
+	models.PaymentMethodPoints:    "Points",
+	models.PaymentMethodGiftCard:  "Gift card",
+}
+
+// Layout turns a transaction into printable lines.
+func (r *Renderer) Layout(t *models.Transaction, width int) ([]Line, error) {
+	data := Data{Number: Number(t), Date: t.CreatedAt, Transaction: t}
+	rule := Line{Text: strings.Repeat("-", width)}
+	lines := make([]Line, 0)
+
+	header, err := execute(r.header, data)
+	if err != nil {
+		return nil, err
+	}
+	for _, text := range wrapBlock(header, width) {
+		lines = append(lines, Line{Text: text, Align: AlignCenter, Bold: true})
+	}
+
+	lines = append(lines, rule,
+		Line{Text: columns("Receipt", data.Number, width)},
+		Line{Text: columns("Date", t.CreatedAt.Format("2006-01-02 15:04"), width)},
+	)
+	switch t.Status {
+	case models.TransactionStatusVoided:
+		lines = append(lines, Line{Text: "*** VOIDED ***", Align: AlignCenter, Bold: true})
+	case models.TransactionStatusRefunded:
+		lines = append(lines, Line{Text: "*** REFUNDED ***", Align: AlignCenter, Bold: true})
+	case models.TransactionStatusPartiallyRefunded:
+		lines = append(lines, Line{Text: "*** PARTIALLY REFUNDED ***", Align: AlignCenter, Bold: true})
+	}
+	lines = append(lines, rule)
+
+	subtotal := money.New(0, t.Currency)
+	for _, d := range t.Details {
+		for _, text := range wrap(d.ProductName, width) {
+			lines = append(lines, Line{Text: text})
+		}
+		qty := fmt.Sprintf("  %s x %s", d.Quantity, d.UnitPrice)
+		if d.Unit != "" && d.Unit != models.UnitPiece {
+			qty = fmt.Sprintf("  %s %s x %s/%s", d.Quantity, d.Unit, d.UnitPrice, d.Unit)
+		}
+		lines = append(lines, Line{Text: columns(qty, d.Subtotal.String(), width)})
+		for _, discount := range d.Discounts {
+			lines = append(lines, Line{Text: columns("  "+discount.PromotionName, "-"+discount.Amount.String(), width)})
+		}
+		subtotal = subtotal.Add(d.Subtotal)
+	}
+	lines = append(lines, rule, Line{Text: columns("Subtotal", subtotal.String(), width)})
+
+	if !t.DiscountAmount.IsZero() {
+		lines = append(lines, Line{Text: columns("Discount", "-"+t.DiscountAmount.String(), width)})
+	}
+	for _, tax := range t.TaxSummary {
+		label := fmt.Sprintf("%s %s%%", tax.TaxCode, tax.Rate)
+		if t.TaxInclusive {
+			label = "incl. " + label
+		}
+		lines = append(lines, Line{Text: columns(label, tax.TaxAmount.String(), width)})
+	}
+	lines = append(lines, Line{Text: columns("TOTAL "+t.Currency, t.TotalAmount.String(), width), Bold: true})
+	if !t.CashRounding.IsZero() {
+		lines = append(lines, Line{Text: columns("Rounding", t.CashRounding.String(), width)})
+	}
+
+	if len(t.Payments) > 0 {
+		lines = append(lines, rule)
+		for _, p := range t.Payments {
+			label, ok := paymentLabels[p.Method]
+			if !ok {
+				label = p.Method
+			}
+			lines = append(lines, Line{Text: columns(label, p.Tendered.String(), width)})
+		}
+		lines = append(lines, Line{Text: columns("Change", t.ChangeAmount.String(), width)})
+	}
+
+	footer, err := execute(r.footer, data)
+	if err != nil {
+		return nil, err
+	}
+	if footer != "" {
+		lines = append(lines, rule)
+		for _, text := range wrapBlock(footer, width) {
+			lines = append(lines, Line{Text: text, Align: AlignCenter})
+		}
+	}
+
+	return lines, nil
+}
+
+func execute(tmpl *template.Template, data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// columns puts left and right on one line, cutting left short if both do not
+// fit.
+func columns(left, right string, width int) string {
+	room := width - utf8.RuneCountInString(right) - 1
+	if room < 0 {
+		return truncate(right, width)
+	}
+	left = truncate(left, room)
+	return left + strings.Repeat(" ", width-utf8.RuneCountInString(left)-utf8.RuneCountInString(right)) + right
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// wrapBlock wraps every line of a multi-line block.
+func wrapBlock(block string, width int) []string {
+	lines := make([]string, 0)
+	if block == "" {
+		return lines
+	}
+	for _, line := range strings.Split(block, "\n") {
+		lines = append(lines, wrap(strings.TrimSpace(line), width)...)
+	}
+	return lines
+}
+
+// wrap breaks text on spaces into lines of at most width characters, cutting
+// words that are longer than a line.
+func wrap(text string, width int) []string {
+	lines := make([]string, 0)
+	current := ""
+	for _, word := range strings.Fields(text) {
+		for utf8.RuneCountInString(word) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case current == "":
+			current = word
+		case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" || len(lines) == 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// pad aligns text within width using spaces.
+func pad(line Line, width int) string {
+	gap := width - utf8.RuneCountInString(line.Text)
+	if gap <= 0 {
+		return line.Text
+	}
+	switch line.Align {
+	case AlignCenter:
+		return strings.Repeat(" ", gap/2) + line.Text
+	case AlignRight:
+		return strings.Repeat(" ", gap) + line.Text
+	default:
+		return line.Text
+	}
+}
+
+// ascii replaces anything outside printable ASCII, which is all the printer
+// code page and the PDF base fonts are guaranteed to have.
+func ascii(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package receipt
+
+import (
+	"bytes"
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenTransaction is a sale that reaches every part of the layout: a name
+// that wraps, a weighed line, a promotion, tax, split tenders with change
+// and cash rounding.
+func goldenTransaction() *models.Transaction {
+	idr := func(s string) money.Money { return money.MustParse(s) }
+	return &models.Transaction{
+		ID:             42,
+		ReceiptNumber:  "STR01-20260314-0042",
+		TotalAmount:    idr("76050"),
+		Currency:       "IDR",
+		TaxAmount:      idr("7537"),
+		TaxInclusive:   true,
+		DiscountAmount: idr("5000"),
+		TaxSummary: []models.TaxSummaryLine{
+			{TaxCode: "PPN", Rate: 1100, TaxableAmount: idr("68513"), TaxAmount: idr("7537")},
+		},
+		ChangeAmount: idr("3900"),
+		CashRounding: idr("50"),
+		Payments: []models.TransactionPayment{
+			{Method: models.PaymentMethodQRIS, Amount: idr("30000"), Tendered: idr("30000")},
+			{Method: models.PaymentMethodCash, Amount: idr("46100"), Tendered: idr("50000")},
+		},
+		Status:    models.TransactionStatusCompleted,
+		CreatedAt: time.Date(2026, 3, 14, 9, 41, 0, 0, time.UTC),
+		Details: []models.TransactionDetail{
+			{
+				ProductName: "Indomie Goreng Rendang Jumbo Pack Isi Lima",
+				UnitPrice:   idr("15500"),
+				Quantity:    quantity.FromInt(2),
+				Unit:        models.UnitPiece,
+				Subtotal:    idr("31000"),
+				Discounts: []models.AppliedDiscount{
+					{PromotionName: "Promo Mie", Level: models.PromotionLevelLine, Amount: idr("5000")},
+				},
+			},
+			{
+				ProductName: "Beras Pandan Wangi",
+				UnitPrice:   idr("14300"),
+				Quantity:    quantity.Quantity(3500),
+				Unit:        models.UnitKilogram,
+				Subtotal:    idr("50050"),
+			},
+		},
+	}
+}
+
+// storeTenderTransaction is the golden sale paid off the customer's points
+// and a gift card, which need no change or cash rounding.
+func storeTenderTransaction() *models.Transaction {
+	t := goldenTransaction()
+	t.ChangeAmount = money.New(0, "IDR")
+	t.CashRounding = money.New(0, "IDR")
+	t.Payments = []models.TransactionPayment{
+		{Method: models.PaymentMethodPoints, Amount: money.MustParse("26050"), Tendered: money.MustParse("26050")},
+		{Method: models.PaymentMethodGiftCard, Amount: money.MustParse("50000"), Tendered: money.MustParse("50000")},
+	}
+	return t
+}
+
+// matchGolden compares got with testdata/name.golden, rewriting the file
+// first with -update.
+func matchGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test ./receipt -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match %s:\n%q\nwant:\n%q", name, path, got, want)
+	}
+}
+
+func TestRenderMatchesGolden(t *testing.T) {
+	r, err := NewRenderer("TOKO MAJU\nJl. Merdeka 1, Bandung", "Receipt {{.Number}}\nThank you for shopping with us")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	widths := []struct {
+		name  string
+		width int
+	}{
+		{"58mm", Width58mm},
+		{"80mm", Width80mm},
+	}
+	for _, format := range []string{FormatText, FormatESCPOS, FormatPDF} {
+		for _, w := range widths {
+			name := fmt.Sprintf("%s_%s", format, w.name)
+			t.Run(name, func(t *testing.T) {
+				got, _, err := r.Render(goldenTransaction(), format, w.width)
+				if err != nil {
+					t.Fatal(err)
+				}
+				matchGolden(t, name, got)
+			})
+		}
+	}
+}
+
+func TestRenderLabelsStoreTenders(t *testing.T) {
+	r, err := NewRenderer("TOKO MAJU", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := r.Render(storeTenderTransaction(), FormatText, Width58mm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchGolden(t, "text_58mm_store_tenders", got)
+}
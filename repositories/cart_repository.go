@@ -0,0 +1,384 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/quantity"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type CartRepositoryInput interface {
+	GetAll(status string) ([]models.Cart, error)
+	Create(req models.CreateCartRequest) (*models.Cart, error)
+	GetByID(id int) (*models.Cart, error)
+	AddItem(id int, item models.CheckoutItem) (*models.Cart, error)
+	SetItemQuantity(id, productID int, qty quantity.Quantity) (*models.Cart, error)
+	Hold(id int) (*models.Cart, error)
+	Resume(id int) (*models.Cart, error)
+}
+
+type cartRepository struct {
+	db *sql.DB
+	// ttl is how long a cart lives after it was last touched.
+	ttl time.Duration
+}
+
+func NewCartRepository(db *sql.DB, ttl time.Duration) CartRepositoryInput {
+	return &cartRepository{db: db, ttl: ttl}
+}
+
+// reservedStock is the SQL for the quantity of product p held back by live
+// reserving carts other than the one in parameter cartParam. Bundles in
+// those carts hold back their components.
+func reservedStock(cartParam string) string {
+	return `COALESCE((
+		SELECT SUM(ci.quantity * COALESCE(pc.quantity, 1))
+		FROM cart_items ci
+		JOIN carts c ON c.id = ci.cart_id
+		LEFT JOIN product_components pc ON pc.bundle_id = ci.product_id AND pc.component_id = p.id
+		WHERE (ci.product_id = p.id OR pc.component_id IS NOT NULL)
+			AND c.reserve AND c.status IN ('active', 'held') AND c.expires_at > NOW()
+			AND c.id <> ` + cartParam + `
+	), 0)`
+}
+
+// availableStock is the SQL for how much of product p can still be sold:
+// its stock less reservations by carts other than cartParam or, for a
+// bundle, how many whole bundles its components' available stock makes up.
+// bundleParam must hold p's ID, since p is rebound inside the bundle branch.
+func availableStock(bundleParam, cartParam string) string {
+	return `CASE WHEN p.type = 'bundle' THEN GREATEST(COALESCE((
+		SELECT MIN(FLOOR((p.stock - ` + reservedStock(cartParam) + `) / pc.quantity))
+		FROM product_components pc
+		JOIN product p ON p.id = pc.component_id
+		WHERE pc.bundle_id = ` + bundleParam + `
+	), 0), 0) ELSE p.stock - ` + reservedStock(cartParam) + ` END`
+}
+
+// expireCarts marks carts past their expiry as expired, which also releases
+// any stock they reserved.
+func expireCarts(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE carts SET status = $1 WHERE status IN ($2, $3) AND expires_at <= NOW()`,
+		models.CartStatusExpired, models.CartStatusActive, models.CartStatusHeld)
+	return err
+}
+
+// lockCart locks the cart row and returns its status and whether it
+// reserves stock. Live carts past their expiry are reported as expired.
+func lockCart(tx *sql.Tx, id int) (string, bool, error) {
+	var status string
+	var reserve, expired bool
+	err := tx.QueryRow(`SELECT status, reserve, expires_at <= NOW() FROM carts WHERE id = $1 FOR UPDATE`, id).
+		Scan(&status, &reserve, &expired)
+	if err == sql.ErrNoRows {
+		return "", false, models.ErrCartNotFound
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if expired && (status == models.CartStatusActive || status == models.CartStatusHeld) {
+		return "", false, models.ErrCartExpired
+	}
+	return status, reserve, nil
+}
+
+// claimCart locks an active cart for checkout and returns its lines.
+func claimCart(tx *sql.Tx, id int) ([]models.CheckoutItem, error) {
+	status, _, err := lockCart(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != models.CartStatusActive {
+		return nil, models.ErrCartNotActive
+	}
+
+	rows, err := tx.Query("SELECT product_id, quantity FROM cart_items WHERE cart_id = $1 ORDER BY product_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.CheckoutItem, 0)
+	for rows.Next() {
+		var item models.CheckoutItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, models.ErrCartEmpty
+	}
+
+	return items, nil
+}
+
+func (repo *cartRepository) GetAll(status string) ([]models.Cart, error) {
+	if err := expireCarts(repo.db); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, status, reserve, COALESCE(transaction_id, 0), created_at, updated_at, expires_at FROM carts"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY updated_at DESC, id DESC"
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	carts := make([]models.Cart, 0)
+	for rows.Next() {
+		var c models.Cart
+		if err := rows.Scan(&c.ID, &c.Status, &c.Reserve, &c.TransactionID, &c.CreatedAt, &c.UpdatedAt, &c.ExpiresAt); err != nil {
+			return nil, err
+		}
+		carts = append(carts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range carts {
+		if carts[i].Items, err = repo.loadItems(carts[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return carts, nil
+}
+
+func (repo *cartRepository) Create(req models.CreateCartRequest) (*models.Cart, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO carts (status, reserve, expires_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+		RETURNING id`,
+		models.CartStatusActive, req.Reserve, int64(repo.ttl.Seconds())).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := resolveProductCodes(tx, req.Items)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range mergeCheckoutItems(items) {
+		if err := setCartItem(tx, id, req.Reserve, item.ProductID, item.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+func (repo *cartRepository) GetByID(id int) (*models.Cart, error) {
+	if err := expireCarts(repo.db); err != nil {
+		return nil, err
+	}
+
+	var c models.Cart
+	err := repo.db.QueryRow(`
+		SELECT id, status, reserve, COALESCE(transaction_id, 0), created_at, updated_at, expires_at
+		FROM carts WHERE id = $1`, id).
+		Scan(&c.ID, &c.Status, &c.Reserve, &c.TransactionID, &c.CreatedAt, &c.UpdatedAt, &c.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Items, err = repo.loadItems(id); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (repo *cartRepository) loadItems(cartID int) ([]models.CartItem, error) {
+	rows, err := repo.db.Query(`
+		SELECT ci.product_id, p.name, p.price, ci.quantity, p.unit
+		FROM cart_items ci
+		JOIN product p ON p.id = ci.product_id
+		WHERE ci.cart_id = $1
+		ORDER BY ci.product_id`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]models.CartItem, 0)
+	for rows.Next() {
+		var item models.CartItem
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.UnitPrice, &item.Quantity, &item.Unit); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// AddItem adds quantity to a line, creating it if needed.
+func (repo *cartRepository) AddItem(id int, item models.CheckoutItem) (*models.Cart, error) {
+	return repo.updateItems(id, func(tx *sql.Tx, reserve bool) error {
+		resolved, err := resolveProductCodes(tx, []models.CheckoutItem{item})
+		if err != nil {
+			return err
+		}
+		item := resolved[0]
+
+		var current quantity.Quantity
+		err = tx.QueryRow("SELECT quantity FROM cart_items WHERE cart_id = $1 AND product_id = $2", id, item.ProductID).
+			Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		return setCartItem(tx, id, reserve, item.ProductID, current+item.Quantity)
+	})
+}
+
+// SetItemQuantity replaces a line's quantity; zero removes the line.
+func (repo *cartRepository) SetItemQuantity(id, productID int, qty quantity.Quantity) (*models.Cart, error) {
+	return repo.updateItems(id, func(tx *sql.Tx, reserve bool) error {
+		return setCartItem(tx, id, reserve, productID, qty)
+	})
+}
+
+// updateItems runs change on an active cart and pushes its expiry out.
+func (repo *cartRepository) updateItems(id int, change func(tx *sql.Tx, reserve bool) error) (*models.Cart, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, reserve, err := lockCart(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != models.CartStatusActive {
+		return nil, models.ErrCartNotActive
+	}
+
+	if err := change(tx, reserve); err != nil {
+		return nil, err
+	}
+	if err := repo.touch(tx, id, models.CartStatusActive); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// setCartItem writes one line. For a reserving cart the quantity must be
+// available after what other carts have reserved.
+func setCartItem(tx *sql.Tx, cartID int, reserve bool, productID int, qty quantity.Quantity) error {
+	if qty == 0 {
+		_, err := tx.Exec("DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2", cartID, productID)
+		return err
+	}
+
+	var name string
+	var available quantity.Quantity
+	var precision int
+	var hasVariants bool
+	err := tx.QueryRow(`
+		SELECT p.name, `+availableStock("$1", "$2")+`, p.quantity_precision,
+			EXISTS (SELECT 1 FROM product v WHERE v.parent_id = p.id)
+		FROM product p WHERE p.id = $1`,
+		productID, cartID).Scan(&name, &available, &precision, &hasVariants)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: product id %d not found", models.ErrInvalidCartItem, productID)
+	}
+	if err != nil {
+		return err
+	}
+	if hasVariants {
+		return fmt.Errorf("%w: %s has variants; add one of them instead", models.ErrInvalidCartItem, name)
+	}
+	if err := checkPrecision(name, precision, qty); err != nil {
+		return err
+	}
+	if reserve && available < qty {
+		return &models.InsufficientStockError{Items: []models.StockShortage{{
+			ProductID:   productID,
+			ProductName: name,
+			Requested:   qty,
+			Available:   available,
+		}}}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cart_items (cart_id, product_id, quantity) VALUES ($1, $2, $3)
+		ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = EXCLUDED.quantity`,
+		cartID, productID, qty)
+	return err
+}
+
+func (repo *cartRepository) touch(tx *sql.Tx, id int, status string) error {
+	_, err := tx.Exec(`
+		UPDATE carts SET status = $1, updated_at = NOW(), expires_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id = $3`,
+		status, int64(repo.ttl.Seconds()), id)
+	return err
+}
+
+// Hold parks an active cart so it can be resumed later, on any till.
+func (repo *cartRepository) Hold(id int) (*models.Cart, error) {
+	return repo.transition(id, models.CartStatusActive, models.CartStatusHeld, models.ErrCartNotActive)
+}
+
+// Resume makes a held cart active again.
+func (repo *cartRepository) Resume(id int) (*models.Cart, error) {
+	return repo.transition(id, models.CartStatusHeld, models.CartStatusActive, models.ErrCartNotHeld)
+}
+
+func (repo *cartRepository) transition(id int, from, to string, wrongState error) (*models.Cart, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, _, err := lockCart(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != from {
+		return nil, wrongState
+	}
+	if err := repo.touch(tx, id, to); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
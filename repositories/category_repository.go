@@ -23,7 +23,7 @@ func NewCategoryRepository(db *sql.DB) CategoryRepositoryInput {
 }
 
 func (repo *categoryRepository) GetAll() ([]models.Category, error) {
-	query := "SELECT id, name, description FROM category"
+	query := "SELECT id, name, description, COALESCE(tax_rate_id, 0) FROM category"
 	rows, err := repo.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -33,7 +33,7 @@ func (repo *categoryRepository) GetAll() ([]models.Category, error) {
 	categories := make([]models.Category, 0)
 	for rows.Next() {
 		var c models.Category
-		err := rows.Scan(&c.ID, &c.Name, &c.Description)
+		err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.TaxRateID)
 		if err != nil {
 			return nil, err
 		}
@@ -44,8 +44,8 @@ func (repo *categoryRepository) GetAll() ([]models.Category, error) {
 }
 
 func (repo *categoryRepository) Create(category *models.Category) error {
-	query := "INSERT INTO category (name, description) VALUES ($1, $2) RETURNING id"
-	err := repo.db.QueryRow(query, category.Name, category.Description).Scan(&category.ID)
+	query := "INSERT INTO category (name, description, tax_rate_id) VALUES ($1, $2, NULLIF($3, 0)) RETURNING id"
+	err := repo.db.QueryRow(query, category.Name, category.Description, category.TaxRateID).Scan(&category.ID)
 	if err != nil {
 		return err
 	}
@@ -53,10 +53,10 @@ func (repo *categoryRepository) Create(category *models.Category) error {
 }
 
 func (repo *categoryRepository) GetByID(id int) (*models.Category, error) {
-	query := "SELECT id, name, description FROM category WHERE id = $1"
+	query := "SELECT id, name, description, COALESCE(tax_rate_id, 0) FROM category WHERE id = $1"
 
 	var c models.Category
-	err := repo.db.QueryRow(query, id).Scan(&c.ID, &c.Name, &c.Description)
+	err := repo.db.QueryRow(query, id).Scan(&c.ID, &c.Name, &c.Description, &c.TaxRateID)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("category not found")
 	}
@@ -67,8 +67,8 @@ func (repo *categoryRepository) GetByID(id int) (*models.Category, error) {
 }
 
 func (repo *categoryRepository) Update(category *models.Category) error {
-	query := "UPDATE category SET name = $1, description = $2 WHERE id = $3"
-	result, err := repo.db.Exec(query, category.Name, category.Description, category.ID)
+	query := "UPDATE category SET name = $1, description = $2, tax_rate_id = NULLIF($3, 0) WHERE id = $4"
+	result, err := repo.db.Exec(query, category.Name, category.Description, category.TaxRateID, category.ID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,679 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/promotion"
+	"cashier-api/quantity"
+	"cashier-api/tax"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// pricedCart is a cart with every line priced, discounted and taxed.
+type pricedCart struct {
+	details  []models.TransactionDetail
+	subtotal money.Money
+	discount money.Money
+	tax      money.Money
+	total    money.Money
+}
+
+// CreateTransaction records a sale and takes the sold quantities out of stock.
+//
+// With opts.UseLock the product rows are locked with SELECT ... FOR UPDATE
+// before the stock check. Without it the stock check is folded into a
+// conditional UPDATE, so a concurrent sale that got there first makes the
+// update match no rows.
+// Either way products are touched in ascending ID order to avoid deadlocks.
+//
+// Each line is taxed at the product's rate (falling back to its category's)
+// in effect at the time of sale, and that rate is copied onto the line.
+// The payments must settle the total, with the cash part rounded to
+// the cash rounding increment; see settlePayments. The sale is booked
+// to req.ShiftID, which must be open. With req.CartID the lines are taken
+// from that cart, which is marked checked out in the same transaction. With
+// req.CustomerID the sale earns loyalty points, and points tenders are taken
+// off that customer's balance.
+// Gift card tenders are taken off their cards in the same transaction.
+// Products the sale takes down to their reorder point are listed in
+// LowStock.
+func (repo *TransactionRepository) CreateTransaction(req models.CheckoutRequest, opts models.CheckoutOptions) (*models.Transaction, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if opts.IdempotencyKey != "" {
+		replay, err := claimIdempotencyKey(tx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if replay != nil {
+			return replay, nil
+		}
+	}
+
+	if err := requireOpenShift(tx, req.ShiftID); err != nil {
+		return nil, err
+	}
+
+	if req.CustomerID != 0 {
+		if err := lockCustomer(tx, req.CustomerID); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.CartID != 0 {
+		if req.Items, err = claimCart(tx, req.CartID); err != nil {
+			return nil, err
+		}
+	} else if req.Items, err = resolveProductCodes(tx, req.Items); err != nil {
+		return nil, err
+	}
+
+	cart, err := repo.priceCart(tx, req.Items, req.CartID, opts.UseLock)
+	if err != nil {
+		return nil, err
+	}
+	details := cart.details
+
+	payments, change, cashRounding, err := settlePayments(req.Payments, cart.total, repo.cashRounding)
+	if err != nil {
+		return nil, err
+	}
+	pointsRedeemed, err := repo.pointsToRedeem(tx, req.CustomerID, payments)
+	if err != nil {
+		return nil, err
+	}
+	var pointsEarned int64
+	if req.CustomerID != 0 {
+		pointsEarned = repo.pointsToEarn(cart.total, payments)
+	}
+
+	// Bundle lines take their components out of stock. Those are always
+	// checked as they are taken, since the same product may also be sold on
+	// its own or in another bundle in this sale.
+	// The ledger lines are written once the transaction has an ID.
+	shortages := make([]models.StockShortage, 0)
+	movements := make([]models.StockMovement, 0)
+	for _, demand := range stockDemands(details) {
+		query := "UPDATE product SET stock = stock - $1 WHERE id = $2 AND stock >= $1 RETURNING stock"
+		if opts.UseLock && !demand.viaBundle {
+			query = "UPDATE product SET stock = stock - $1 WHERE id = $2 RETURNING stock"
+		}
+
+		var remaining quantity.Quantity
+		err = tx.QueryRow(query, demand.quantity, demand.productID).Scan(&remaining)
+		if err == sql.ErrNoRows {
+			var available quantity.Quantity
+			if err := tx.QueryRow("SELECT stock FROM product WHERE id = $1", demand.productID).Scan(&available); err != nil {
+				return nil, err
+			}
+			shortages = append(shortages, models.StockShortage{
+				ProductID:   demand.productID,
+				ProductName: demand.productName,
+				Requested:   demand.quantity,
+				Available:   available,
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, models.StockMovement{
+			ProductID:  demand.productID,
+			Type:       models.StockMovementSale,
+			Quantity:   -demand.quantity,
+			StockAfter: remaining,
+		})
+	}
+
+	if len(shortages) > 0 {
+		return nil, &models.InsufficientStockError{Items: shortages}
+	}
+
+	// Taken as late as possible: the counter stays locked until commit.
+	receiptNumber, err := repo.allocateReceiptNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactionID int
+	var createdAt time.Time
+	err = tx.QueryRow(`
+		INSERT INTO "transaction"
+			(total_amount, currency, tax_amount, tax_inclusive, discount_amount, change_amount, cash_rounding, shift_id,
+			receipt_number, customer_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, 0))
+		RETURNING id, created_at`,
+		cart.total, cart.total.Currency(), cart.tax, repo.taxEngine.PricesIncludeTax(), cart.discount, change, cashRounding,
+		req.ShiftID, receiptNumber, req.CustomerID).
+		Scan(&transactionID, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range movements {
+		movements[i].TransactionID = transactionID
+		if err := repo.costing.recordMovement(tx, &movements[i]); err != nil {
+			return nil, err
+		}
+	}
+	costDetails(details, movements)
+	lowStock, err := lowStockAlerts(tx, movements)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertPayments(tx, transactionID, payments); err != nil {
+		return nil, err
+	}
+	if err := redeemGiftCards(tx, transactionID, payments); err != nil {
+		return nil, err
+	}
+
+	if err := insertPointsEntry(tx, req.CustomerID, transactionID, 0, models.PointsEntryRedeem, -pointsRedeemed); err != nil {
+		return nil, err
+	}
+	if err := insertPointsEntry(tx, req.CustomerID, transactionID, 0, models.PointsEntryEarn, pointsEarned); err != nil {
+		return nil, err
+	}
+
+	if req.CartID != 0 {
+		_, err = tx.Exec("UPDATE carts SET status = $1, transaction_id = $2, updated_at = NOW() WHERE id = $3",
+			models.CartStatusCheckedOut, transactionID, req.CartID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range details {
+		details[i].TransactionID = transactionID
+		err = tx.QueryRow(`
+			INSERT INTO transaction_details
+				(transaction_id, product_id, quantity, subtotal, unit_price, product_name, category_id, category_name, sku,
+				tax_rate_id, tax_code, tax_rate_bps, tax_amount, total_amount, discount_amount,
+				parent_product_id, parent_product_name, unit, cost_amount)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), NULLIF($9, ''),
+				NULLIF($10, 0), NULLIF($11, ''), $12, $13, $14, $15, NULLIF($16, 0), NULLIF($17, ''), $18, $19)
+			RETURNING id`,
+			transactionID, details[i].ProductID, details[i].Quantity, details[i].Subtotal, details[i].UnitPrice,
+			details[i].ProductName, details[i].CategoryID, details[i].CategoryName, details[i].SKU,
+			details[i].TaxRateID, details[i].TaxCode, details[i].TaxRate, details[i].TaxAmount, details[i].TotalAmount,
+			details[i].DiscountAmount, details[i].ParentProductID, details[i].ParentProductName, details[i].Unit,
+			details[i].CostAmount).
+			Scan(&details[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range details[i].Components {
+			_, err = tx.Exec(`
+				INSERT INTO transaction_detail_components (detail_id, product_id, product_name, quantity, unit_price)
+				VALUES ($1, $2, $3, $4, $5)`,
+				details[i].ID, c.ProductID, c.ProductName, c.Quantity, c.UnitPrice)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, discount := range details[i].Discounts {
+			_, err = tx.Exec(`
+				INSERT INTO transaction_discounts (transaction_id, detail_id, promotion_id, promotion_name, level, amount)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				transactionID, details[i].ID, discount.PromotionID, discount.PromotionName, discount.Level, discount.Amount)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	transaction := &models.Transaction{
+		ID:             transactionID,
+		ReceiptNumber:  receiptNumber,
+		ShiftID:        req.ShiftID,
+		CustomerID:     req.CustomerID,
+		TotalAmount:    cart.total,
+		Currency:       cart.total.Currency(),
+		TaxAmount:      cart.tax,
+		TaxInclusive:   repo.taxEngine.PricesIncludeTax(),
+		DiscountAmount: cart.discount,
+		TaxSummary:     summarizeTax(details),
+		ChangeAmount:   change,
+		CashRounding:   cashRounding,
+		Payments:       payments,
+		PointsEarned:   pointsEarned,
+		PointsRedeemed: pointsRedeemed,
+		Status:         models.TransactionStatusCompleted,
+		CreatedAt:      createdAt,
+		Details:        details,
+		LowStock:       lowStock,
+	}
+
+	if opts.IdempotencyKey != "" {
+		body, err := json.Marshal(transaction)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE idempotency_keys SET transaction_id = $1, response_body = $2 WHERE key = $3",
+			transactionID, body, opts.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// PreviewTransaction prices a cart the same way CreateTransaction does but
+// records nothing. Rows are not locked, so the result is only a quote.
+func (repo *TransactionRepository) PreviewTransaction(req models.CheckoutRequest) (*models.CheckoutPreview, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if req.CartID != 0 {
+		if req.Items, err = claimCart(tx, req.CartID); err != nil {
+			return nil, err
+		}
+	} else if req.Items, err = resolveProductCodes(tx, req.Items); err != nil {
+		return nil, err
+	}
+
+	cart, err := repo.priceCart(tx, req.Items, req.CartID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CheckoutPreview{
+		Currency:       cart.total.Currency(),
+		Subtotal:       cart.subtotal,
+		DiscountAmount: cart.discount,
+		TaxAmount:      cart.tax,
+		TotalAmount:    cart.total,
+		TaxInclusive:   repo.taxEngine.PricesIncludeTax(),
+		TaxSummary:     summarizeTax(cart.details),
+		Details:        cart.details,
+	}, nil
+}
+
+// priceCart loads the products in the cart, checks stock, applies the active
+// promotions and taxes what is left of each line. Tax is always worked out on
+// the discounted amount. Stock reserved by carts other than cartID is not
+// available. A product with variants cannot be sold itself; only its
+// variants can. A bundle line carries a copy of its components.
+func (repo *TransactionRepository) priceCart(tx *sql.Tx, items []models.CheckoutItem, cartID int, useLock bool) (*pricedCart, error) {
+	details := make([]models.TransactionDetail, 0)
+	shortages := make([]models.StockShortage, 0)
+	items = mergeCheckoutItems(items)
+
+	if useLock {
+		if err := lockProducts(tx, items); err != nil {
+			return nil, err
+		}
+	}
+
+	productQuery := `
+		SELECT p.name, COALESCE(p.sku, ''), p.price, ` + availableStock("$1", "$2") + `, COALESCE(p.category_id, 0),
+			COALESCE(c.name, ''), COALESCE(tr.id, 0), COALESCE(tr.code, ''), COALESCE(tr.rate_bps, 0),
+			COALESCE(p.parent_id, 0), COALESCE(pp.name, ''), EXISTS (SELECT 1 FROM product v WHERE v.parent_id = p.id),
+			p.unit, p.quantity_precision, p.type
+		FROM product p
+		LEFT JOIN product pp ON pp.id = p.parent_id
+		LEFT JOIN category c ON c.id = p.category_id
+		LEFT JOIN LATERAL (
+			SELECT r.id, r.code, trp.rate_bps
+			FROM tax_rates r
+			JOIN tax_rate_periods trp ON trp.tax_rate_id = r.id
+			WHERE r.id = COALESCE(p.tax_rate_id, c.tax_rate_id) AND trp.effective_from <= NOW()
+			ORDER BY trp.effective_from DESC
+			LIMIT 1
+		) tr ON TRUE
+		WHERE p.id = $1`
+
+	for _, item := range items {
+		var productPrice money.Money
+		var stock quantity.Quantity
+		var unit string
+		var precision int
+		var productName string
+		var sku string
+		var categoryID int
+		var categoryName string
+		var taxRateID int
+		var taxCode string
+		var taxRate tax.Rate
+		var parentID int
+		var parentName string
+		var hasVariants bool
+		var productType string
+
+		err := tx.QueryRow(productQuery, item.ProductID, cartID).
+			Scan(&productName, &sku, &productPrice, &stock, &categoryID, &categoryName, &taxRateID, &taxCode, &taxRate,
+				&parentID, &parentName, &hasVariants, &unit, &precision, &productType)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("product id %d not found", item.ProductID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hasVariants {
+			return nil, fmt.Errorf("%w: pick a variant of %s", models.ErrProductHasVariants, productName)
+		}
+		if err := checkPrecision(productName, precision, item.Quantity); err != nil {
+			return nil, err
+		}
+
+		if stock < item.Quantity {
+			shortages = append(shortages, models.StockShortage{
+				ProductID:   item.ProductID,
+				ProductName: productName,
+				Requested:   item.Quantity,
+				Available:   stock,
+			})
+			continue
+		}
+
+		var components []models.DetailComponent
+		if productType == models.ProductTypeBundle {
+			if components, err = loadBundleComponents(tx, item.ProductID); err != nil {
+				return nil, err
+			}
+			if len(components) == 0 {
+				return nil, fmt.Errorf("%w: bundle %s has no components", models.ErrInvalidProduct, productName)
+			}
+		}
+
+		details = append(details, models.TransactionDetail{
+			ProductID:    item.ProductID,
+			ProductName:  productName,
+			SKU:          sku,
+			UnitPrice:    productPrice,
+			CategoryID:   categoryID,
+			CategoryName: categoryName,
+			Quantity:     item.Quantity,
+			Unit:         unit,
+			Subtotal:     item.Quantity.Price(productPrice, repo.roundingMode),
+			TaxRateID:    taxRateID,
+			TaxCode:      taxCode,
+			TaxRate:      taxRate,
+
+			ParentProductID:   parentID,
+			ParentProductName: parentName,
+			Components:        components,
+		})
+	}
+
+	if len(shortages) > 0 {
+		return nil, &models.InsufficientStockError{Items: shortages}
+	}
+
+	promotions, err := loadActivePromotions(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return priceLines(details, promotions, repo.roundingMode, repo.taxEngine), nil
+}
+
+// priceLines applies promotions and tax to the priced details and adds them
+// up. Every cart total is the sum of the same amount on the lines, so what
+// the receipt shows per line always adds up to what was charged.
+func priceLines(details []models.TransactionDetail, promotions []models.Promotion, mode money.RoundingMode,
+	taxEngine tax.Engine) *pricedCart {
+	lines := make([]promotion.Line, len(details))
+	for i, d := range details {
+		lines[i] = promotion.Line{
+			ProductID:  d.ProductID,
+			CategoryID: d.CategoryID,
+			UnitPrice:  d.UnitPrice,
+			Quantity:   d.Quantity,
+		}
+	}
+	discounts := promotion.Apply(lines, promotions, mode)
+
+	cart := &pricedCart{
+		subtotal: money.New(0, money.DefaultCurrency()),
+		discount: money.New(0, money.DefaultCurrency()),
+		tax:      money.New(0, money.DefaultCurrency()),
+		total:    money.New(0, money.DefaultCurrency()),
+	}
+	for i := range details {
+		d := &details[i]
+		d.Discounts = discounts[i]
+		if d.Discounts == nil {
+			d.Discounts = make([]models.AppliedDiscount, 0)
+		}
+		d.DiscountAmount = promotion.Total(d.Discounts)
+
+		lineTax := taxEngine.LineTax(d.Subtotal.Sub(d.DiscountAmount), d.TaxRate)
+		d.TaxAmount = lineTax.Tax
+		d.TotalAmount = lineTax.Gross
+
+		cart.subtotal = cart.subtotal.Add(d.Subtotal)
+		cart.discount = cart.discount.Add(d.DiscountAmount)
+		cart.tax = cart.tax.Add(lineTax.Tax)
+		cart.total = cart.total.Add(lineTax.Gross)
+	}
+	cart.details = details
+
+	return cart
+}
+
+// claimIdempotencyKey inserts the key for this request. If the key already
+// exists for the same request the stored transaction is returned for replay;
+// a concurrent request holding the same key blocks the insert until it commits
+// or rolls back.
+func claimIdempotencyKey(tx *sql.Tx, opts models.CheckoutOptions) (*models.Transaction, error) {
+	_, err := tx.Exec("DELETE FROM idempotency_keys WHERE key = $1 AND expires_at <= NOW()", opts.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO idempotency_keys (key, request_hash, expires_at)
+		VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (key) DO NOTHING`,
+		opts.IdempotencyKey, opts.RequestHash, int64(opts.IdempotencyTTL.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	var requestHash string
+	var body []byte
+	err = tx.QueryRow("SELECT request_hash, response_body FROM idempotency_keys WHERE key = $1", opts.IdempotencyKey).
+		Scan(&requestHash, &body)
+	if err != nil {
+		return nil, err
+	}
+	if requestHash != opts.RequestHash {
+		return nil, models.ErrIdempotencyKeyMismatch
+	}
+	if body == nil {
+		return nil, errors.New("idempotency key has no stored response")
+	}
+
+	var transaction models.Transaction
+	if err := json.Unmarshal(body, &transaction); err != nil {
+		return nil, err
+	}
+	transaction.Replayed = true
+
+	return &transaction, nil
+}
+
+// lockProducts locks the products in items, and the components of any
+// bundles among them, in ascending ID order.
+func lockProducts(tx *sql.Tx, items []models.CheckoutItem) error {
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = int64(item.ProductID)
+	}
+	rows, err := tx.Query(`
+		SELECT id FROM product
+		WHERE id = ANY($1) OR id IN (SELECT component_id FROM product_components WHERE bundle_id = ANY($1))
+		ORDER BY id
+		FOR UPDATE`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// loadBundleComponents copies what one bundle is made of, at today's prices.
+func loadBundleComponents(tx *sql.Tx, bundleID int) ([]models.DetailComponent, error) {
+	rows, err := tx.Query(`
+		SELECT pc.component_id, p.name, pc.quantity, p.price
+		FROM product_components pc
+		JOIN product p ON p.id = pc.component_id
+		WHERE pc.bundle_id = $1
+		ORDER BY pc.component_id`, bundleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	components := make([]models.DetailComponent, 0)
+	for rows.Next() {
+		var c models.DetailComponent
+		if err := rows.Scan(&c.ProductID, &c.ProductName, &c.Quantity, &c.UnitPrice); err != nil {
+			return nil, err
+		}
+		components = append(components, c)
+	}
+	return components, rows.Err()
+}
+
+// stockDemand is what a sale takes out of one product's stock.
+type stockDemand struct {
+	productID   int
+	productName string
+	quantity    quantity.Quantity
+	// viaBundle is set when some of the quantity comes from a bundle, whose
+	// components were not checked against the other lines of the sale.
+	viaBundle bool
+}
+
+// stockDemands totals what the lines take out of stock per product, a bundle
+// line counting as its components, in ascending product ID order.
+func stockDemands(details []models.TransactionDetail) []stockDemand {
+	byProduct := make(map[int]*stockDemand)
+	add := func(productID int, name string, qty quantity.Quantity, viaBundle bool) {
+		d, ok := byProduct[productID]
+		if !ok {
+			d = &stockDemand{productID: productID, productName: name}
+			byProduct[productID] = d
+		}
+		d.quantity += qty
+		d.viaBundle = d.viaBundle || viaBundle
+	}
+	for _, detail := range details {
+		if len(detail.Components) == 0 {
+			add(detail.ProductID, detail.ProductName, detail.Quantity, false)
+			continue
+		}
+		for _, c := range detail.Components {
+			qty, _ := c.Quantity.Mul(detail.Quantity)
+			add(c.ProductID, c.ProductName, qty, true)
+		}
+	}
+
+	demands := make([]stockDemand, 0, len(byProduct))
+	for _, d := range byProduct {
+		demands = append(demands, *d)
+	}
+	sort.Slice(demands, func(i, j int) bool { return demands[i].productID < demands[j].productID })
+	return demands
+}
+
+// costDetails sets each line's cost from the sale movements. A product sold
+// on several lines, on its own and in a bundle say, has its movement's cost
+// split over them by quantity.
+func costDetails(details []models.TransactionDetail, movements []models.StockMovement) {
+	type use struct {
+		detail   int
+		quantity quantity.Quantity
+	}
+	uses := make(map[int][]use)
+	for i := range details {
+		details[i].CostAmount = money.New(0, money.DefaultCurrency())
+		if len(details[i].Components) == 0 {
+			uses[details[i].ProductID] = append(uses[details[i].ProductID], use{i, details[i].Quantity})
+			continue
+		}
+		for _, c := range details[i].Components {
+			qty, _ := c.Quantity.Mul(details[i].Quantity)
+			uses[c.ProductID] = append(uses[c.ProductID], use{i, qty})
+		}
+	}
+
+	for _, m := range movements {
+		weights := make([]int64, len(uses[m.ProductID]))
+		for k, u := range uses[m.ProductID] {
+			weights[k] = int64(u.quantity)
+		}
+		for k, share := range m.Value.Neg().Allocate(weights) {
+			d := &details[uses[m.ProductID][k].detail]
+			d.CostAmount = d.CostAmount.Add(share)
+		}
+	}
+}
+
+// mergeCheckoutItems folds repeated products into a single line and sorts the
+// result by product ID, which is the order rows get locked in.
+func mergeCheckoutItems(items []models.CheckoutItem) []models.CheckoutItem {
+	quantities := make(map[int]quantity.Quantity)
+	for _, item := range items {
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	merged := make([]models.CheckoutItem, 0, len(quantities))
+	for productID, qty := range quantities {
+		merged = append(merged, models.CheckoutItem{ProductID: productID, Quantity: qty})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ProductID < merged[j].ProductID })
+
+	return merged
+}
+
+// allocateReceiptNumber takes the next number in the current period. The
+// upsert row-locks the counter until the checkout commits, so concurrent
+// checkouts queue for it and a rolled-back checkout gives its number back:
+// numbers have no gaps and no duplicates.
+func (repo *TransactionRepository) allocateReceiptNumber(tx *sql.Tx) (string, error) {
+	var period string
+	var number int
+	err := tx.QueryRow(`
+		INSERT INTO receipt_sequences (store_code, period, last_number)
+		VALUES ($1, to_char(NOW(), $2), 1)
+		ON CONFLICT (store_code, period) DO UPDATE SET last_number = receipt_sequences.last_number + 1
+		RETURNING period, last_number`,
+		repo.numbering.StoreCode, repo.periodFormat).Scan(&period, &number)
+	if err != nil {
+		return "", err
+	}
+	return repo.numbering.Format(period, number), nil
+}
@@ -0,0 +1,220 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"cashier-api/tax"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+// randomCart builds up to eight lines over a handful of products and
+// categories, taxed at 0%, 10% or 11%, and a few promotions of each kind
+// that can overlap on them.
+func randomCart(r *rand.Rand) ([]models.TransactionDetail, []models.Promotion) {
+	rates := []money.Percent{0, 1000, 1100}
+	details := make([]models.TransactionDetail, 1+r.Intn(8))
+	for i := range details {
+		price := money.FromMinor(r.Int63n(5_000_000))
+		qty := quantity.Quantity(1 + r.Int63n(20_000))
+		details[i] = models.TransactionDetail{
+			ProductID:  1 + r.Intn(5),
+			CategoryID: 1 + r.Intn(3),
+			UnitPrice:  price,
+			Quantity:   qty,
+			Subtotal:   qty.Price(price, money.HalfUp),
+			TaxRate:    rates[r.Intn(len(rates))],
+		}
+	}
+
+	types := []string{models.PromotionTypePercentage, models.PromotionTypeFixedAmount, models.PromotionTypeBuyXGetY}
+	levels := []string{models.PromotionLevelLine, models.PromotionLevelOrder}
+	promotions := make([]models.Promotion, r.Intn(4))
+	for i := range promotions {
+		p := models.Promotion{
+			ID:          i + 1,
+			Type:        types[r.Intn(len(types))],
+			Level:       levels[r.Intn(len(levels))],
+			Percent:     money.Percent(r.Int63n(10_001)),
+			Amount:      money.FromMinor(r.Int63n(1_000_000)),
+			BuyQuantity: 1 + r.Intn(3),
+			GetQuantity: 1 + r.Intn(2),
+			Priority:    r.Intn(3),
+			Active:      true,
+		}
+		if r.Intn(2) == 0 {
+			p.CategoryIDs = []int{1 + r.Intn(3)}
+		}
+		promotions[i] = p
+	}
+	return details, promotions
+}
+
+func TestPriceLinesTotalsAreSumsOfLines(t *testing.T) {
+	for _, inclusive := range []bool{false, true} {
+		engine := tax.NewStandardEngine(inclusive, money.HalfUp)
+		addsUp := func(seed int64) bool {
+			details, promotions := randomCart(rand.New(rand.NewSource(seed)))
+			cart := priceLines(details, promotions, money.HalfUp, engine)
+
+			var subtotal, discount, taxAmount, total money.Money
+			for _, d := range cart.details {
+				if d.DiscountAmount.Cmp(d.Subtotal) > 0 || d.DiscountAmount.IsNegative() {
+					t.Logf("seed %d: line discount %s outside 0..%s", seed, d.DiscountAmount, d.Subtotal)
+					return false
+				}
+				net := d.Subtotal.Sub(d.DiscountAmount)
+				if !inclusive {
+					net = net.Add(d.TaxAmount)
+				}
+				if net.Cmp(d.TotalAmount) != 0 {
+					t.Logf("seed %d: line total %s, want %s", seed, d.TotalAmount, net)
+					return false
+				}
+				subtotal = subtotal.Add(d.Subtotal)
+				discount = discount.Add(d.DiscountAmount)
+				taxAmount = taxAmount.Add(d.TaxAmount)
+				total = total.Add(d.TotalAmount)
+			}
+			return cart.subtotal.Cmp(subtotal) == 0 && cart.discount.Cmp(discount) == 0 &&
+				cart.tax.Cmp(taxAmount) == 0 && cart.total.Cmp(total) == 0
+		}
+		if err := quick.Check(addsUp, &quick.Config{MaxCount: 500}); err != nil {
+			t.Errorf("inclusive %v: %v", inclusive, err)
+		}
+	}
+}
+
+func TestCreateTransactionNeverOversells(t *testing.T) {
+	db := testDB(t)
+	for _, mode := range []struct {
+		name    string
+		useLock bool
+	}{
+		{"lock", true},
+		{"optimistic", false},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			const stock, buyers = 5, 20
+			f := newCheckoutFixture(t, db, quantity.FromInt(stock))
+
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			sold, short := 0, 0
+			for i := 0; i < buyers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := f.repo.CreateTransaction(f.sale(1), models.CheckoutOptions{UseLock: mode.useLock})
+					mu.Lock()
+					defer mu.Unlock()
+					var shortage *models.InsufficientStockError
+					switch {
+					case err == nil:
+						sold++
+					case errors.As(err, &shortage):
+						short++
+					default:
+						t.Errorf("checkout: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if sold != stock || short != buyers-stock {
+				t.Errorf("%d sales and %d shortages, want %d and %d", sold, short, stock, buyers-stock)
+			}
+			var left, lowest, ledger quantity.Quantity
+			err := db.QueryRow(`
+				SELECT p.stock, MIN(m.stock_after), SUM(m.quantity)
+				FROM product p JOIN stock_movements m ON m.product_id = p.id
+				WHERE p.id = $1
+				GROUP BY p.stock`, f.productID).Scan(&left, &lowest, &ledger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if left != 0 || lowest < 0 || ledger != left {
+				t.Errorf("stock %s, lowest %s, ledger %s; want 0, at least 0 and equal to stock", left, lowest, ledger)
+			}
+		})
+	}
+}
+
+func TestReceiptNumbersAreGaplessUnderParallelCheckouts(t *testing.T) {
+	db := testDB(t)
+	const stock, buyers, registers = 30, 40, 3
+	f := newCheckoutFixture(t, db, quantity.FromInt(stock))
+
+	// Every register of the store draws from the store's one counter.
+	shifts := []int{f.shiftID}
+	for i := 1; i < registers; i++ {
+		shift, err := NewShiftRepository(db).Open(models.OpenShiftRequest{
+			Register: fmt.Sprintf("%s-%d", f.storeCode, i),
+			OpenedBy: "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		shifts = append(shifts, shift.ID)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	numbers := make([]string, 0, stock)
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := f.sale(1)
+			req.ShiftID = shifts[i%registers]
+			transaction, err := f.repo.CreateTransaction(req, models.CheckoutOptions{UseLock: i%2 == 0})
+			var shortage *models.InsufficientStockError
+			if errors.As(err, &shortage) {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				t.Errorf("checkout: %v", err)
+				return
+			}
+			numbers = append(numbers, transaction.ReceiptNumber)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(numbers) != stock {
+		t.Fatalf("%d sales, want %d", len(numbers), stock)
+	}
+	periods := make(map[string]bool)
+	counters := make([]int, 0, len(numbers))
+	for _, number := range numbers {
+		parts := strings.Split(number, "-")
+		if len(parts) != 3 || parts[0] != f.storeCode {
+			t.Fatalf("receipt number %q is not %s-<day>-<counter>", number, f.storeCode)
+		}
+		counter, err := strconv.Atoi(parts[2])
+		if err != nil {
+			t.Fatalf("receipt number %q: %v", number, err)
+		}
+		periods[parts[1]] = true
+		counters = append(counters, counter)
+	}
+	if len(periods) != 1 {
+		t.Errorf("receipt numbers span days %v, want one", periods)
+	}
+	sort.Ints(counters)
+	for i, counter := range counters {
+		if counter != i+1 {
+			t.Fatalf("receipt counters %v, want 1 to %d with no gaps or repeats", counters, stock)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type CustomerRepositoryInput interface {
+	GetAll(search string) ([]models.Customer, error)
+	Create(customer *models.Customer) error
+	GetByID(id int) (*models.Customer, error)
+	Update(customer *models.Customer) error
+	Delete(id int) error
+	GetPoints(id int) (*models.PointsStatement, error)
+}
+
+type customerRepository struct {
+	db *sql.DB
+}
+
+func NewCustomerRepository(db *sql.DB) CustomerRepositoryInput {
+	return &customerRepository{db: db}
+}
+
+const customerColumns = `c.id, c.member_number, c.name, COALESCE(c.phone, ''), COALESCE(c.email, ''),
+	COALESCE((SELECT SUM(lp.points) FROM loyalty_points lp WHERE lp.customer_id = c.id), 0), c.created_at`
+
+func scanCustomer(row rowScanner, c *models.Customer) error {
+	return row.Scan(&c.ID, &c.MemberNumber, &c.Name, &c.Phone, &c.Email, &c.PointsBalance, &c.CreatedAt)
+}
+
+// customerWriteError turns a unique violation on member number, phone or
+// email into ErrDuplicateCustomer.
+func customerWriteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return models.ErrDuplicateCustomer
+	}
+	return err
+}
+
+// GetAll lists customers by name. search matches the member number, phone or
+// email exactly, or any part of the name.
+func (repo *customerRepository) GetAll(search string) ([]models.Customer, error) {
+	query := "SELECT " + customerColumns + " FROM customers c"
+	args := []interface{}{}
+	if search != "" {
+		query += ` WHERE c.member_number = $1 OR c.phone = $1 OR lower(c.email) = lower($1) OR c.name ILIKE '%' || $1 || '%'`
+		args = append(args, search)
+	}
+	query += " ORDER BY c.name, c.id"
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := make([]models.Customer, 0)
+	for rows.Next() {
+		var c models.Customer
+		if err := scanCustomer(rows, &c); err != nil {
+			return nil, err
+		}
+		customers = append(customers, c)
+	}
+
+	return customers, rows.Err()
+}
+
+func (repo *customerRepository) Create(c *models.Customer) error {
+	query := `
+		INSERT INTO customers (member_number, name, phone, email)
+		VALUES (COALESCE(NULLIF($1, ''), 'M' || lpad(nextval('customer_member_number_seq')::text, 8, '0')), $2,
+			NULLIF($3, ''), NULLIF($4, ''))
+		RETURNING id, member_number, created_at`
+	err := repo.db.QueryRow(query, c.MemberNumber, c.Name, c.Phone, c.Email).Scan(&c.ID, &c.MemberNumber, &c.CreatedAt)
+	return customerWriteError(err)
+}
+
+func (repo *customerRepository) GetByID(id int) (*models.Customer, error) {
+	var c models.Customer
+	err := scanCustomer(repo.db.QueryRow("SELECT "+customerColumns+" FROM customers c WHERE c.id = $1", id), &c)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Update changes the contact details. An empty member number keeps the
+// current one.
+func (repo *customerRepository) Update(c *models.Customer) error {
+	query := `
+		UPDATE customers SET member_number = COALESCE(NULLIF($1, ''), member_number), name = $2,
+			phone = NULLIF($3, ''), email = NULLIF($4, '')
+		WHERE id = $5
+		RETURNING member_number, created_at`
+	err := repo.db.QueryRow(query, c.MemberNumber, c.Name, c.Phone, c.Email, c.ID).Scan(&c.MemberNumber, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return models.ErrCustomerNotFound
+	}
+	if err != nil {
+		return customerWriteError(err)
+	}
+
+	balance, err := pointsBalance(repo.db, c.ID)
+	if err != nil {
+		return err
+	}
+	c.PointsBalance = balance
+	return nil
+}
+
+// Delete removes the customer and their points ledger. Their past sales stay
+// on record without a customer.
+func (repo *customerRepository) Delete(id int) error {
+	result, err := repo.db.Exec("DELETE FROM customers WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return models.ErrCustomerNotFound
+	}
+
+	return nil
+}
+
+func (repo *customerRepository) GetPoints(id int) (*models.PointsStatement, error) {
+	var exists bool
+	if err := repo.db.QueryRow("SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1)", id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, models.ErrCustomerNotFound
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT id, customer_id, COALESCE(transaction_id, 0), COALESCE(return_id, 0), type, points, created_at
+		FROM loyalty_points
+		WHERE customer_id = $1
+		ORDER BY id DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statement := &models.PointsStatement{CustomerID: id, Entries: make([]models.PointsEntry, 0)}
+	for rows.Next() {
+		var e models.PointsEntry
+		if err := rows.Scan(&e.ID, &e.CustomerID, &e.TransactionID, &e.ReturnID, &e.Type, &e.Points, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		statement.Balance += e.Points
+		statement.Entries = append(statement.Entries, e)
+	}
+
+	return statement, rows.Err()
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"cashier-api/database"
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"cashier-api/tax"
+	"database/sql"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testDB connects to the PostgreSQL database in TEST_DB_CONN and migrates
+// it; tests that need one are skipped without it. Every test sets up its own
+// products and shift, so they can share the database.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn := os.Getenv("TEST_DB_CONN")
+	if conn == "" {
+		t.Skip("TEST_DB_CONN is not set")
+	}
+	db, err := database.InitDB(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// checkoutFixture is a product with stock, an open shift to sell it on and a
+// transaction repository to sell it with.
+type checkoutFixture struct {
+	db        *sql.DB
+	repo      TransactionRepositoryInput
+	storeCode string
+	shiftID   int
+	productID int
+}
+
+func newCheckoutFixture(t *testing.T, db *sql.DB, stock quantity.Quantity) *checkoutFixture {
+	t.Helper()
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	f := &checkoutFixture{db: db, storeCode: "T" + suffix}
+
+	var categoryID int
+	if err := db.QueryRow("INSERT INTO category (name) VALUES ($1) RETURNING id", "Test "+suffix).Scan(&categoryID); err != nil {
+		t.Fatal(err)
+	}
+	product := &models.Product{
+		Name:       "Test " + suffix,
+		Price:      money.MustParse("10000"),
+		Stock:      stock,
+		CategoryID: categoryID,
+		Unit:       models.UnitPiece,
+	}
+	if err := NewProductRepository(db, money.HalfUp, models.CostAverage).Create(product); err != nil {
+		t.Fatal(err)
+	}
+	f.productID = product.ID
+
+	shift, err := NewShiftRepository(db).Open(models.OpenShiftRequest{Register: "T" + suffix, OpenedBy: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.shiftID = shift.ID
+
+	f.repo, err = NewTransactionRepository(db, money.HalfUp, money.Rounding{}, models.CostAverage,
+		tax.NewStandardEngine(true, money.HalfUp), models.ReceiptNumbering{StoreCode: f.storeCode}, models.LoyaltyRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// sale is a checkout of n units of the fixture's product paid in exact cash.
+func (f *checkoutFixture) sale(n int64) models.CheckoutRequest {
+	return models.CheckoutRequest{
+		ShiftID: f.shiftID,
+		Items:   []models.CheckoutItem{{ProductID: f.productID, Quantity: quantity.FromInt(n)}},
+	}
+}
@@ -0,0 +1,379 @@
+package repositories
+
+import (
+	"cashier-api/giftcard"
+	"cashier-api/models"
+	"cashier-api/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+type GiftCardRepositoryInput interface {
+	GetAll(kind, status string) ([]models.GiftCard, error)
+	Issue(req models.IssueGiftCardRequest) (*models.GiftCard, error)
+	GetByCode(code string) (*models.GiftCard, error)
+	Activate(code string) (*models.GiftCard, error)
+	TopUp(code string, amount money.Money) (*models.GiftCard, error)
+	GetEntries(code string) ([]models.GiftCardEntry, error)
+}
+
+type giftCardRepository struct {
+	db *sql.DB
+}
+
+func NewGiftCardRepository(db *sql.DB) GiftCardRepositoryInput {
+	return &giftCardRepository{db: db}
+}
+
+const giftCardColumns = `g.id, g.code, g.kind, g.status, g.initial_value,
+	COALESCE((SELECT SUM(e.amount) FROM gift_card_entries e WHERE e.gift_card_id = g.id), 0), g.expires_at, g.created_at,
+	g.activated_at`
+
+func scanGiftCard(row rowScanner, g *models.GiftCard) error {
+	var expiresAt, activatedAt sql.NullTime
+	err := row.Scan(&g.ID, &g.Code, &g.Kind, &g.Status, &g.InitialValue, &g.Balance, &expiresAt, &g.CreatedAt,
+		&activatedAt)
+	if err != nil {
+		return err
+	}
+	if expiresAt.Valid {
+		g.ExpiresAt = &expiresAt.Time
+	}
+	if activatedAt.Valid {
+		g.ActivatedAt = &activatedAt.Time
+	}
+	return nil
+}
+
+func getGiftCard(q queryer, code string) (*models.GiftCard, error) {
+	if !giftcard.Valid(code) {
+		return nil, fmt.Errorf("%w: %q is not a valid code", models.ErrGiftCardNotFound, code)
+	}
+	var g models.GiftCard
+	err := scanGiftCard(q.QueryRow("SELECT "+giftCardColumns+" FROM gift_cards g WHERE g.code = $1", code), &g)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// lockGiftCard row-locks the card for the rest of the transaction and only
+// then reads its balance, so the balance cannot change under the caller.
+func lockGiftCard(tx *sql.Tx, code string) (*models.GiftCard, error) {
+	if !giftcard.Valid(code) {
+		return nil, fmt.Errorf("%w: %q is not a valid code", models.ErrGiftCardNotFound, code)
+	}
+	var id int
+	err := tx.QueryRow("SELECT id FROM gift_cards WHERE code = $1 FOR UPDATE", code).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getGiftCard(tx, code)
+}
+
+// requireUsable fails unless the card is active and not past its expiry.
+func requireUsable(tx *sql.Tx, g *models.GiftCard) error {
+	if g.Status != models.GiftCardStatusActive {
+		return fmt.Errorf("%w: %s", models.ErrGiftCardNotActive, g.Code)
+	}
+	var expired bool
+	if err := tx.QueryRow("SELECT COALESCE(expires_at <= NOW(), FALSE) FROM gift_cards WHERE id = $1", g.ID).
+		Scan(&expired); err != nil {
+		return err
+	}
+	if expired {
+		return fmt.Errorf("%w: %s", models.ErrGiftCardExpired, g.Code)
+	}
+	return nil
+}
+
+func insertGiftCardEntry(tx *sql.Tx, giftCardID, transactionID, returnID int, entryType string, amount money.Money) error {
+	if amount.IsZero() {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO gift_card_entries (gift_card_id, transaction_id, return_id, type, amount)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5)`,
+		giftCardID, transactionID, returnID, entryType, amount)
+	return err
+}
+
+// redeemGiftCards takes the gift card tenders off their cards. Cards are
+// locked in code order so concurrent sales on the same cards cannot deadlock.
+// A voucher is used up by the sale and whatever it did not cover is
+// forfeited. It runs inside the checkout transaction, so a sale that fails
+// later leaves every card untouched.
+func redeemGiftCards(tx *sql.Tx, transactionID int, payments []models.TransactionPayment) error {
+	amounts := make(map[string]money.Money)
+	for _, p := range payments {
+		if p.Method != models.PaymentMethodGiftCard {
+			continue
+		}
+		if current, ok := amounts[p.Reference]; ok {
+			amounts[p.Reference] = current.Add(p.Amount)
+		} else {
+			amounts[p.Reference] = p.Amount
+		}
+	}
+
+	codes := make([]string, 0, len(amounts))
+	for code := range amounts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		card, err := lockGiftCard(tx, code)
+		if err != nil {
+			return err
+		}
+		if err := requireUsable(tx, card); err != nil {
+			return err
+		}
+		amount := amounts[code]
+		if card.Balance.Cmp(amount) < 0 {
+			return fmt.Errorf("%w: %s has %s, %s requested", models.ErrInsufficientGiftCardBalance, code, card.Balance, amount)
+		}
+
+		if err := insertGiftCardEntry(tx, card.ID, transactionID, 0, models.GiftCardEntryRedeem, amount.Neg()); err != nil {
+			return err
+		}
+		if card.Kind == models.GiftCardKindVoucher {
+			if err := insertGiftCardEntry(tx, card.ID, transactionID, 0, models.GiftCardEntryForfeit,
+				card.Balance.Sub(amount).Neg()); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE gift_cards SET status = $1 WHERE id = $2", models.GiftCardStatusUsed, card.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreGiftCards puts back everything a voided sale took off gift cards,
+// forfeited voucher value included, and makes its vouchers usable again.
+func restoreGiftCards(tx *sql.Tx, transactionID int) error {
+	rows, err := tx.Query(`
+		SELECT e.gift_card_id, g.kind, SUM(e.amount)
+		FROM gift_card_entries e
+		JOIN gift_cards g ON g.id = e.gift_card_id
+		WHERE e.transaction_id = $1 AND e.return_id IS NULL
+		GROUP BY e.gift_card_id, g.kind
+		ORDER BY e.gift_card_id`, transactionID)
+	if err != nil {
+		return err
+	}
+
+	type taken struct {
+		giftCardID int
+		kind       string
+		amount     money.Money
+	}
+	cards := make([]taken, 0)
+	for rows.Next() {
+		var t taken
+		if err := rows.Scan(&t.giftCardID, &t.kind, &t.amount); err != nil {
+			rows.Close()
+			return err
+		}
+		cards = append(cards, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range cards {
+		if _, err := tx.Exec("SELECT id FROM gift_cards WHERE id = $1 FOR UPDATE", t.giftCardID); err != nil {
+			return err
+		}
+		if err := insertGiftCardEntry(tx, t.giftCardID, transactionID, 0, models.GiftCardEntryReversal, t.amount.Neg()); err != nil {
+			return err
+		}
+		if t.kind == models.GiftCardKindVoucher {
+			if _, err := tx.Exec("UPDATE gift_cards SET status = $1 WHERE id = $2", models.GiftCardStatusActive, t.giftCardID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// refundToGiftCard credits a refund to a reloadable card instead of paying it
+// out in cash.
+func refundToGiftCard(tx *sql.Tx, code string, transactionID, returnID int, amount money.Money) error {
+	card, err := lockGiftCard(tx, code)
+	if err != nil {
+		return err
+	}
+	if card.Kind != models.GiftCardKindCard {
+		return models.ErrGiftCardNotReloadable
+	}
+	if err := requireUsable(tx, card); err != nil {
+		return err
+	}
+	return insertGiftCardEntry(tx, card.ID, transactionID, returnID, models.GiftCardEntryRefund, amount)
+}
+
+func (repo *giftCardRepository) GetAll(kind, status string) ([]models.GiftCard, error) {
+	rows, err := repo.db.Query(`
+		SELECT `+giftCardColumns+`
+		FROM gift_cards g
+		WHERE ($1 = '' OR g.kind = $1) AND ($2 = '' OR g.status = $2)
+		ORDER BY g.id DESC`, kind, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := make([]models.GiftCard, 0)
+	for rows.Next() {
+		var g models.GiftCard
+		if err := scanGiftCard(rows, &g); err != nil {
+			return nil, err
+		}
+		cards = append(cards, g)
+	}
+
+	return cards, rows.Err()
+}
+
+// Issue creates an inactive card under a fresh code. A clash with an
+// existing code is retried with a new one.
+func (repo *giftCardRepository) Issue(req models.IssueGiftCardRequest) (*models.GiftCard, error) {
+	for attempt := 0; ; attempt++ {
+		code, err := giftcard.NewCode()
+		if err != nil {
+			return nil, err
+		}
+
+		card := &models.GiftCard{
+			Code:         code,
+			Kind:         req.Kind,
+			Status:       models.GiftCardStatusInactive,
+			InitialValue: req.Value,
+			Balance:      money.New(0, req.Value.Currency()),
+			ExpiresAt:    req.ExpiresAt,
+		}
+		err = repo.db.QueryRow(`
+			INSERT INTO gift_cards (code, kind, status, initial_value, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`,
+			card.Code, card.Kind, card.Status, card.InitialValue, card.ExpiresAt).Scan(&card.ID, &card.CreatedAt)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return card, nil
+	}
+}
+
+func (repo *giftCardRepository) GetByCode(code string) (*models.GiftCard, error) {
+	return getGiftCard(repo.db, code)
+}
+
+// Activate loads the card's initial value and makes it spendable.
+func (repo *giftCardRepository) Activate(code string) (*models.GiftCard, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	card, err := lockGiftCard(tx, code)
+	if err != nil {
+		return nil, err
+	}
+	if card.Status != models.GiftCardStatusInactive {
+		return nil, models.ErrGiftCardAlreadyActivated
+	}
+
+	_, err = tx.Exec("UPDATE gift_cards SET status = $1, activated_at = NOW() WHERE id = $2",
+		models.GiftCardStatusActive, card.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertGiftCardEntry(tx, card.ID, 0, 0, models.GiftCardEntryActivate, card.InitialValue); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByCode(code)
+}
+
+// TopUp adds value to an active card. Vouchers cannot be topped up.
+func (repo *giftCardRepository) TopUp(code string, amount money.Money) (*models.GiftCard, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	card, err := lockGiftCard(tx, code)
+	if err != nil {
+		return nil, err
+	}
+	if card.Kind != models.GiftCardKindCard {
+		return nil, models.ErrGiftCardNotReloadable
+	}
+	if err := requireUsable(tx, card); err != nil {
+		return nil, err
+	}
+	if err := insertGiftCardEntry(tx, card.ID, 0, 0, models.GiftCardEntryTopUp, amount); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByCode(code)
+}
+
+// GetEntries returns the card's ledger, newest first.
+func (repo *giftCardRepository) GetEntries(code string) ([]models.GiftCardEntry, error) {
+	card, err := repo.GetByCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT id, gift_card_id, COALESCE(transaction_id, 0), COALESCE(return_id, 0), type, amount, created_at
+		FROM gift_card_entries
+		WHERE gift_card_id = $1
+		ORDER BY id DESC`, card.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.GiftCardEntry, 0)
+	for rows.Next() {
+		var e models.GiftCardEntry
+		if err := rows.Scan(&e.ID, &e.GiftCardID, &e.TransactionID, &e.ReturnID, &e.Type, &e.Amount, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
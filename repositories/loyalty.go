@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// pointsBalance sums a customer's points ledger.
+func pointsBalance(q queryer, customerID int) (int64, error) {
+	var balance int64
+	err := q.QueryRow("SELECT COALESCE(SUM(points), 0) FROM loyalty_points WHERE customer_id = $1", customerID).
+		Scan(&balance)
+	return balance, err
+}
+
+// lockCustomer row-locks the customer for the rest of the checkout so two
+// sales cannot both spend the same points.
+func lockCustomer(tx *sql.Tx, customerID int) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM customers WHERE id = $1 FOR UPDATE", customerID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return models.ErrCustomerNotFound
+	}
+	return err
+}
+
+// pointsToRedeem works out how many points the points tenders spend and
+// checks the customer has them. The customer must already be locked.
+func (repo *TransactionRepository) pointsToRedeem(tx *sql.Tx, customerID int, payments []models.TransactionPayment) (int64, error) {
+	var points int64
+	for _, p := range payments {
+		if p.Method != models.PaymentMethodPoints {
+			continue
+		}
+		if customerID == 0 {
+			return 0, fmt.Errorf("%w: paying with points requires a customer", models.ErrInvalidPayment)
+		}
+		n, err := repo.loyalty.PointsFor(p.Amount)
+		if err != nil {
+			return 0, err
+		}
+		points += n
+	}
+	if points == 0 {
+		return 0, nil
+	}
+
+	balance, err := pointsBalance(tx, customerID)
+	if err != nil {
+		return 0, err
+	}
+	if balance < points {
+		return 0, fmt.Errorf("%w: %d points needed, %d available", models.ErrInsufficientPoints, points, balance)
+	}
+	return points, nil
+}
+
+// pointsToEarn is what a sale earns: everything paid for with anything other
+// than points counts towards it.
+func (repo *TransactionRepository) pointsToEarn(total money.Money, payments []models.TransactionPayment) int64 {
+	paid := total
+	for _, p := range payments {
+		if p.Method == models.PaymentMethodPoints {
+			paid = paid.Sub(p.Amount)
+		}
+	}
+	return repo.loyalty.PointsEarned(paid)
+}
+
+func insertPointsEntry(tx *sql.Tx, customerID, transactionID, returnID int, entryType string, points int64) error {
+	if points == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO loyalty_points (customer_id, transaction_id, return_id, type, points)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5)`,
+		customerID, transactionID, returnID, entryType, points)
+	return err
+}
+
+// reversePoints takes back the points a sale earned and gives back the points
+// it redeemed, in proportion to how much of the sale has been refunded so
+// far. Working from running totals lets the last return settle any rounding,
+// so a fully refunded or voided sale nets to zero. A zero returnID means the
+// sale was voided.
+func reversePoints(tx *sql.Tx, transactionID, returnID int) error {
+	var customerID sql.NullInt64
+	var total money.Money
+	err := tx.QueryRow(`SELECT customer_id, total_amount FROM "transaction" WHERE id = $1`, transactionID).
+		Scan(&customerID, &total)
+	if err != nil || !customerID.Valid {
+		return err
+	}
+
+	refunded := total
+	if returnID != 0 {
+		err = tx.QueryRow("SELECT COALESCE(SUM(refund_amount), 0) FROM transaction_returns WHERE transaction_id = $1",
+			transactionID).Scan(&refunded)
+		if err != nil {
+			return err
+		}
+	}
+
+	var earned, earnTakenBack, redeemed, redeemGivenBack int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(points) FILTER (WHERE type = $2), 0), COALESCE(-SUM(points) FILTER (WHERE type = $3), 0),
+			COALESCE(-SUM(points) FILTER (WHERE type = $4), 0), COALESCE(SUM(points) FILTER (WHERE type = $5), 0)
+		FROM loyalty_points
+		WHERE transaction_id = $1`,
+		transactionID, models.PointsEntryEarn, models.PointsEntryEarnReversal, models.PointsEntryRedeem,
+		models.PointsEntryRedeemReversal).
+		Scan(&earned, &earnTakenBack, &redeemed, &redeemGivenBack)
+	if err != nil {
+		return err
+	}
+
+	share := func(points int64) int64 {
+		if refunded.Cmp(total) >= 0 || !total.IsPositive() {
+			return points
+		}
+		return points * refunded.Minor() / total.Minor()
+	}
+
+	customer := int(customerID.Int64)
+	if err := insertPointsEntry(tx, customer, transactionID, returnID, models.PointsEntryEarnReversal,
+		-(share(earned) - earnTakenBack)); err != nil {
+		return err
+	}
+	return insertPointsEntry(tx, customer, transactionID, returnID, models.PointsEntryRedeemReversal,
+		share(redeemed)-redeemGivenBack)
+}
+
+// loadPoints fills PointsEarned and PointsRedeemed for every transaction.
+func (repo *TransactionRepository) loadPoints(transactions []models.Transaction, ids []int64) error {
+	index := make(map[int]int, len(transactions))
+	for i := range transactions {
+		index[transactions[i].ID] = i
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT transaction_id, COALESCE(SUM(points) FILTER (WHERE type = $2), 0),
+			COALESCE(-SUM(points) FILTER (WHERE type = $3), 0)
+		FROM loyalty_points
+		WHERE transaction_id = ANY($1)
+		GROUP BY transaction_id`,
+		pq.Array(ids), models.PointsEntryEarn, models.PointsEntryRedeem)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transactionID int
+		var earned, redeemed int64
+		if err := rows.Scan(&transactionID, &earned, &redeemed); err != nil {
+			return err
+		}
+		i := index[transactionID]
+		transactions[i].PointsEarned = earned
+		transactions[i].PointsRedeemed = redeemed
+	}
+
+	return rows.Err()
+}
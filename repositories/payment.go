@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// settlePayments checks the tenders against the amount due and works out the
+// change. Non-cash tenders are charged for exactly what is entered, so they
+// may not add up to more than the total; only cash can be overpaid, and the
+// excess comes back as change taken off the cash tenders.
+//
+// When any of it is paid in cash, the part left for cash is rounded with
+// cashRounding, since coins below its increment are not handed over. The
+// rounding is returned so it can be booked against the total.
+func settlePayments(payments []models.Payment, total money.Money,
+	cashRounding money.Rounding) ([]models.TransactionPayment, money.Money, money.Money, error) {
+	change := money.New(0, total.Currency())
+	rounding := money.New(0, total.Currency())
+	if len(payments) == 0 {
+		payments = []models.Payment{{Method: models.PaymentMethodCash, Amount: total.Round(cashRounding)}}
+	}
+
+	tendered := money.New(0, total.Currency())
+	nonCash := money.New(0, total.Currency())
+	paysCash := false
+	for _, p := range payments {
+		tendered = tendered.Add(p.Amount)
+		if p.Method != models.PaymentMethodCash {
+			nonCash = nonCash.Add(p.Amount)
+		} else {
+			paysCash = true
+		}
+	}
+
+	if nonCash.Cmp(total) > 0 {
+		return nil, change, rounding, fmt.Errorf("%w: non-cash payments of %s exceed the total of %s",
+			models.ErrInvalidPayment, nonCash, total)
+	}
+	due := total
+	if paysCash {
+		cashDue := total.Sub(nonCash)
+		rounding = cashDue.Round(cashRounding).Sub(cashDue)
+		due = total.Add(rounding)
+	}
+	if tendered.Cmp(due) < 0 {
+		return nil, change, rounding, fmt.Errorf("%w: payments of %s do not cover the amount due of %s",
+			models.ErrInvalidPayment, tendered, due)
+	}
+	change = tendered.Sub(due)
+
+	settled := make([]models.TransactionPayment, len(payments))
+	owed := change
+	for i, p := range payments {
+		settled[i] = models.TransactionPayment{
+			Method:    p.Method,
+			Amount:    p.Amount,
+			Tendered:  p.Amount,
+			Reference: p.Reference,
+		}
+		if p.Method == models.PaymentMethodCash && owed.IsPositive() {
+			given := owed.Min(p.Amount)
+			settled[i].Amount = p.Amount.Sub(given)
+			owed = owed.Sub(given)
+		}
+	}
+
+	return settled, change, rounding, nil
+}
+
+func insertPayments(tx *sql.Tx, transactionID int, payments []models.TransactionPayment) error {
+	for i := range payments {
+		payments[i].TransactionID = transactionID
+		err := tx.QueryRow(`
+			INSERT INTO transaction_payments (transaction_id, method, amount, tendered, reference)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+			RETURNING id`,
+			transactionID, payments[i].Method, payments[i].Amount, payments[i].Tendered, payments[i].Reference).
+			Scan(&payments[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPayments fills Payments for every transaction with a single query.
+func (repo *TransactionRepository) loadPayments(transactions []models.Transaction, ids []int64) error {
+	index := make(map[int]int, len(transactions))
+	for i := range transactions {
+		index[transactions[i].ID] = i
+		transactions[i].Payments = make([]models.TransactionPayment, 0)
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT id, transaction_id, method, amount, tendered, COALESCE(reference, '')
+		FROM transaction_payments
+		WHERE transaction_id = ANY($1)
+		ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.TransactionPayment
+		if err := rows.Scan(&p.ID, &p.TransactionID, &p.Method, &p.Amount, &p.Tendered, &p.Reference); err != nil {
+			return err
+		}
+		i := index[p.TransactionID]
+		transactions[i].Payments = append(transactions[i].Payments, p)
+	}
+
+	return rows.Err()
+}
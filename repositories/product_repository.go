@@ -1,85 +1,254 @@
 package repositories
 
 import (
+	"cashier-api/barcode"
 	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 type ProductRepositoryInput interface {
-	GetAll(page, limit, name string) ([]models.Product, error)
+	GetAll(page, limit, name string, grouped bool) ([]models.Product, error)
 	Create(product *models.Product) error
 	GetByID(id int) (*models.Product, error)
 	Update(product *models.Product) error
 	Delete(id int) error
+	// Lookup finds a product by a normalized barcode or by SKU.
+	Lookup(barcode, sku string) (*models.Product, error)
+	GetVariants(parentID int) ([]models.Product, error)
+	GenerateVariants(parentID int, options []models.ProductOption) ([]models.Product, error)
+	ReceiveStock(id int, req models.ReceiveStockRequest) (*models.Product, error)
+	AdjustStock(id int, req models.StockAdjustmentRequest) (*models.StockMovement, error)
+	GetMovements(id int) ([]models.StockMovement, error)
+	FindStockDrift() ([]models.StockDrift, error)
+	GetLowStock(opts models.ReorderOptions) ([]models.LowStockProduct, error)
 }
 
 type productRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	costing stockCosting
+}
+
+// NewProductRepository costs stock movements with costingMethod, rounding
+// with roundingMode.
+func NewProductRepository(db *sql.DB, roundingMode money.RoundingMode, costingMethod models.CostingMethod) ProductRepositoryInput {
+	return &productRepository{db: db, costing: stockCosting{method: costingMethod, rounding: roundingMode}}
+}
+
+var productColumns = `p.id, p.name, p.type, COALESCE(p.sku, ''), p.price, p.cost_price,
+	CASE WHEN p.type = 'bundle' THEN GREATEST(COALESCE((
+		SELECT MIN(FLOOR(cp.stock / pc.quantity))
+		FROM product_components pc JOIN product cp ON cp.id = pc.component_id
+		WHERE pc.bundle_id = p.id
+	), 0), 0) ELSE p.stock END,
+	COALESCE(p.category_id, 0), COALESCE(c.name, ''),
+	COALESCE(p.tax_rate_id, 0),
+	COALESCE((SELECT array_agg(b.barcode ORDER BY b.barcode) FROM product_barcodes b WHERE b.product_id = p.id), '{}'),
+	COALESCE(p.parent_id, 0), p.options, p.option_values, p.price_override, p.unit, p.quantity_precision,
+	p.reorder_point, p.reorder_quantity, COALESCE(p.preferred_supplier_id, 0),
+	COALESCE((SELECT json_agg(json_build_object('name', k.name, 'size', k.size) ORDER BY k.size, k.name)
+		FROM product_packs k WHERE k.product_id = p.id), '[]'),
+	` + componentsJSON("p.id")
+
+// componentsJSON is the SQL for the components of bundle bundleRef as a JSON
+// array.
+func componentsJSON(bundleRef string) string {
+	return `COALESCE((
+		SELECT json_agg(json_build_object('product_id', pc.component_id, 'product_name', cp.name, 'quantity', pc.quantity)
+			ORDER BY pc.component_id)
+		FROM product_components pc JOIN product cp ON cp.id = pc.component_id
+		WHERE pc.bundle_id = ` + bundleRef + `
+	), '[]')`
+}
+
+func scanProduct(row rowScanner, p *models.Product) error {
+	var barcodes pq.StringArray
+	var options, optionValues, packs, components []byte
+	err := row.Scan(&p.ID, &p.Name, &p.Type, &p.SKU, &p.Price, &p.CostPrice, &p.Stock, &p.CategoryID, &p.CategoryName, &p.TaxRateID,
+		&barcodes, &p.ParentID, &options, &optionValues, &p.PriceOverride, &p.Unit, &p.Precision,
+		&p.ReorderPoint, &p.ReorderQuantity, &p.PreferredSupplierID, &packs, &components)
+	if err != nil {
+		return err
+	}
+	p.Barcodes = []string(barcodes)
+	if err := json.Unmarshal(packs, &p.Packs); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(components, &p.Components); err != nil {
+		return err
+	}
+	if options != nil {
+		if err := json.Unmarshal(options, &p.Options); err != nil {
+			return err
+		}
+	}
+	if optionValues != nil {
+		if err := json.Unmarshal(optionValues, &p.OptionValues); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func NewProductRepository(db *sql.DB) ProductRepositoryInput {
-	return &productRepository{db: db}
+func queryProducts(q queryer, query string, args ...interface{}) ([]models.Product, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]models.Product, 0)
+	for rows.Next() {
+		var p models.Product
+		if err := scanProduct(rows, &p); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+
+	return products, rows.Err()
 }
 
-func (repo *productRepository) GetAll(page, limit, name string) ([]models.Product, error) {
+// productWriteError turns a unique violation on SKU or barcode into
+// ErrDuplicateProductCode.
+func productWriteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return models.ErrDuplicateProductCode
+	}
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == "product_preferred_supplier_id_fkey" {
+		return fmt.Errorf("%w: preferred supplier not found", models.ErrInvalidProduct)
+	}
+	return err
+}
+
+// GetAll lists products. With grouped set only top-level products are
+// listed, each parent carrying its variants; otherwise variants are listed
+// alongside everything else.
+func (repo *productRepository) GetAll(page, limit, name string, grouped bool) ([]models.Product, error) {
 	fmt.Println(page, limit, name)
 	query := `
-		SELECT p.id, p.name, p.price, p.stock, COALESCE(p.category_id, 0), COALESCE(c.name, '') 
-		FROM product p 
+		SELECT ` + productColumns + `
+		FROM product p
 		LEFT JOIN category c ON p.category_id = c.id
 	`
+	conditions := []string{}
 	args := []interface{}{}
 	argNum := 1
 	if name != "" {
-		query += " WHERE p.name ILIKE $" + fmt.Sprint(argNum)
+		conditions = append(conditions, "p.name ILIKE $"+fmt.Sprint(argNum))
 		args = append(args, "%"+name+"%")
 		argNum++
 	}
+	if grouped {
+		conditions = append(conditions, "p.parent_id IS NULL")
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argNum, argNum+1)
 	args = append(args, limit, page)
 
-	rows, err := repo.db.Query(query, args...)
+	products, err := queryProducts(repo.db, query, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if !grouped || len(products) == 0 {
+		return products, nil
+	}
 
-	products := make([]models.Product, 0)
-	for rows.Next() {
-		var p models.Product
-		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.CategoryName)
-		if err != nil {
-			return nil, err
-		}
-		products = append(products, p)
+	ids := make([]int64, len(products))
+	index := make(map[int]int, len(products))
+	for i := range products {
+		ids[i] = int64(products[i].ID)
+		index[products[i].ID] = i
+	}
+	variants, err := queryProducts(repo.db, `
+		SELECT `+productColumns+`
+		FROM product p
+		LEFT JOIN category c ON p.category_id = c.id
+		WHERE p.parent_id = ANY($1)
+		ORDER BY p.id`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		parent := &products[index[v.ParentID]]
+		parent.Variants = append(parent.Variants, v)
 	}
 
 	return products, nil
 }
 
 func (repo *productRepository) Create(product *models.Product) error {
-	query := "INSERT INTO product (name, price, stock, category_id) VALUES ($1, $2, $3, $4) RETURNING id"
-	err := repo.db.QueryRow(query, product.Name, product.Price, product.Stock, product.CategoryID).Scan(&product.ID)
+	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO product (name, type, sku, price, cost_price, stock, category_id, tax_rate_id, unit, quantity_precision,
+			reorder_point, reorder_quantity, preferred_supplier_id)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NULLIF($8, 0), $9, $10, $11, $12, NULLIF($13, 0)) RETURNING id`
+	err = tx.QueryRow(query, product.Name, product.Type, product.SKU, product.Price, product.CostPrice, product.Stock,
+		product.CategoryID, product.TaxRateID, product.Unit, product.Precision, product.ReorderPoint,
+		product.ReorderQuantity, product.PreferredSupplierID).Scan(&product.ID)
+	if err != nil {
+		return productWriteError(err)
+	}
+	if product.Stock != 0 {
+		err = repo.costing.recordMovement(tx, &models.StockMovement{
+			ProductID:  product.ID,
+			Type:       models.StockMovementAdjustment,
+			Quantity:   product.Stock,
+			StockAfter: product.Stock,
+			Reason:     "opening stock",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if product.Barcodes == nil {
+		product.Barcodes = []string{}
+	}
+	if err := replaceBarcodes(tx, product.ID, product.Barcodes); err != nil {
+		return err
+	}
+	if product.Packs == nil {
+		product.Packs = []models.ProductPack{}
+	}
+	if err := replacePacks(tx, product.ID, product.Packs); err != nil {
+		return err
+	}
+	if err := replaceComponents(tx, product); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (repo *productRepository) GetByID(id int) (*models.Product, error) {
 	query := `
-		SELECT p.id, p.name, p.price, p.stock, COALESCE(p.category_id, 0), COALESCE(c.name, '') 
-		FROM product p 
-		LEFT JOIN category c ON p.category_id = c.id 
+		SELECT ` + productColumns + `
+		FROM product p
+		LEFT JOIN category c ON p.category_id = c.id
 		WHERE p.id = $1
 	`
 
 	var p models.Product
-	err := repo.db.QueryRow(query, id).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.CategoryName)
+	err := scanProduct(repo.db.QueryRow(query, id), &p)
 	if err == sql.ErrNoRows {
-		return nil, errors.New("product not found")
+		return nil, models.ErrProductNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -87,40 +256,524 @@ func (repo *productRepository) GetByID(id int) (*models.Product, error) {
 	return &p, nil
 }
 
+// Update changes everything about a product except its stock, which only
+// moves through the stock ledger; the stock sent is replaced by the current
+// figure.
 func (repo *productRepository) Update(product *models.Product) error {
-	query := "UPDATE product SET name = $1, price = $2, stock = $3, category_id = $4 WHERE id = $5"
-	result, err := repo.db.Exec(query, product.Name, product.Price, product.Stock, product.CategoryID, product.ID)
+	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	// cost_price follows the stock that comes in, so it is read rather than
+	// written here.
+	var stock quantity.Quantity
+	err = tx.QueryRow("SELECT stock, cost_price FROM product WHERE id = $1 FOR UPDATE", product.ID).Scan(&stock,
+		&product.CostPrice)
+	if err == sql.ErrNoRows {
+		return models.ErrProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if product.Type == models.ProductTypeBundle && stock != 0 {
+		return fmt.Errorf("%w: adjust the stock of %s to zero before making it a bundle", models.ErrInvalidProduct,
+			product.Name)
+	}
+
+	query := `
+		UPDATE product SET name = $1, sku = NULLIF($2, ''), price = $3, category_id = $4,
+			tax_rate_id = NULLIF($5, 0), unit = $6, quantity_precision = $7, type = $8, reorder_point = $9,
+			reorder_quantity = $10, preferred_supplier_id = NULLIF($11, 0)
+		WHERE id = $12`
+	_, err = tx.Exec(query, product.Name, product.SKU, product.Price, product.CategoryID, product.TaxRateID,
+		product.Unit, product.Precision, product.Type, product.ReorderPoint, product.ReorderQuantity,
+		product.PreferredSupplierID, product.ID)
+	if err != nil {
+		return productWriteError(err)
+	}
+	if product.Type != models.ProductTypeBundle {
+		product.Stock = stock
+	}
 
-	rows, err := result.RowsAffected()
+	// A variant priced like its parent follows the parent; one priced
+	// differently keeps its own price.
+	err = tx.QueryRow(`
+		UPDATE product v SET price_override = v.price <> p.price
+		FROM product p
+		WHERE v.id = $1 AND p.id = v.parent_id
+		RETURNING v.parent_id, v.price_override`, product.ID).Scan(&product.ParentID, &product.PriceOverride)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	_, err = tx.Exec("UPDATE product SET price = $1 WHERE parent_id = $2 AND NOT price_override", product.Price, product.ID)
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return errors.New("product not found")
+	if product.Barcodes == nil {
+		var barcodes pq.StringArray
+		err = tx.QueryRow("SELECT COALESCE(array_agg(barcode ORDER BY barcode), '{}') FROM product_barcodes WHERE product_id = $1",
+			product.ID).Scan(&barcodes)
+		if err != nil {
+			return err
+		}
+		product.Barcodes = barcodes
+	} else if err := replaceBarcodes(tx, product.ID, product.Barcodes); err != nil {
+		return err
+	}
+
+	if product.Packs == nil {
+		var packs []byte
+		err = tx.QueryRow(`
+			SELECT COALESCE(json_agg(json_build_object('name', name, 'size', size) ORDER BY size, name), '[]')
+			FROM product_packs WHERE product_id = $1`, product.ID).Scan(&packs)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(packs, &product.Packs); err != nil {
+			return err
+		}
+	} else if err := replacePacks(tx, product.ID, product.Packs); err != nil {
+		return err
+	}
+
+	if product.Type == models.ProductTypeBundle && product.Components == nil {
+		var components []byte
+		if err := tx.QueryRow("SELECT "+componentsJSON("$1"), product.ID).Scan(&components); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(components, &product.Components); err != nil {
+			return err
+		}
+		if len(product.Components) == 0 {
+			return fmt.Errorf("%w: a bundle needs at least one component", models.ErrInvalidProduct)
+		}
+	} else if err := replaceComponents(tx, product); err != nil {
+		return err
 	}
 
+	return tx.Commit()
+}
+
+// replaceComponents makes product.Components the bundle's complete set of
+// components; a standard product is left with none. Components must be
+// standard products that are sold themselves, in quantities their precision
+// allows, and a bundle cannot itself be a component.
+func replaceComponents(tx *sql.Tx, product *models.Product) error {
+	if _, err := tx.Exec("DELETE FROM product_components WHERE bundle_id = $1", product.ID); err != nil {
+		return err
+	}
+	if product.Type != models.ProductTypeBundle {
+		return nil
+	}
+
+	var isComponent bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_components WHERE component_id = $1)", product.ID).
+		Scan(&isComponent)
+	if err != nil {
+		return err
+	}
+	if isComponent {
+		return fmt.Errorf("%w: %s is a component of another bundle and cannot be a bundle itself",
+			models.ErrInvalidProduct, product.Name)
+	}
+
+	for i := range product.Components {
+		c := &product.Components[i]
+		var productType string
+		var precision int
+		var hasVariants bool
+		err := tx.QueryRow(`
+			SELECT p.name, p.type, p.quantity_precision, EXISTS (SELECT 1 FROM product v WHERE v.parent_id = p.id)
+			FROM product p WHERE p.id = $1`, c.ProductID).
+			Scan(&c.ProductName, &productType, &precision, &hasVariants)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: component product id %d not found", models.ErrInvalidProduct, c.ProductID)
+		}
+		if err != nil {
+			return err
+		}
+		if c.ProductID == product.ID || productType != models.ProductTypeStandard || hasVariants {
+			return fmt.Errorf("%w: %s cannot be a component; pick a standard product or one of its variants",
+				models.ErrInvalidProduct, c.ProductName)
+		}
+		if err := checkPrecision(c.ProductName, precision, c.Quantity); err != nil {
+			return fmt.Errorf("%w: %v", models.ErrInvalidProduct, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO product_components (bundle_id, component_id, quantity) VALUES ($1, $2, $3)",
+			product.ID, c.ProductID, c.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacePacks makes packs the product's complete set of packs.
+func replacePacks(tx *sql.Tx, productID int, packs []models.ProductPack) error {
+	if _, err := tx.Exec("DELETE FROM product_packs WHERE product_id = $1", productID); err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		if _, err := tx.Exec("INSERT INTO product_packs (product_id, name, size) VALUES ($1, $2, $3)",
+			productID, pack.Name, pack.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceBarcodes makes barcodes the product's complete set of barcodes.
+func replaceBarcodes(tx *sql.Tx, productID int, barcodes []string) error {
+	if _, err := tx.Exec("DELETE FROM product_barcodes WHERE product_id = $1", productID); err != nil {
+		return err
+	}
+	for _, code := range barcodes {
+		if _, err := tx.Exec("INSERT INTO product_barcodes (barcode, product_id) VALUES ($1, $2)", code, productID); err != nil {
+			return productWriteError(err)
+		}
+	}
 	return nil
 }
 
+// Delete removes a product. Stock still on hand is written off first, so the
+// ledger the product leaves behind adds up to zero, and its cost layers are
+// closed out.
 func (repo *productRepository) Delete(id int) error {
-	query := "DELETE FROM product WHERE id = $1"
-	result, err := repo.db.Exec(query, id)
+	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := result.RowsAffected()
+	var stock quantity.Quantity
+	err = tx.QueryRow("SELECT stock FROM product WHERE id = $1 FOR UPDATE", id).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return models.ErrProductNotFound
+	}
 	if err != nil {
 		return err
 	}
+	if stock != 0 {
+		err := repo.costing.moveStock(tx, &models.StockMovement{
+			ProductID: id,
+			Type:      models.StockMovementAdjustment,
+			Quantity:  -stock,
+			Reason:    "product deleted",
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	if rows == 0 {
-		return errors.New("product not found")
+	if _, err := tx.Exec("UPDATE cost_layers SET remaining = 0 WHERE product_id = $1 AND remaining > 0", id); err != nil {
+		return err
 	}
 
-	return nil
+	_, err = tx.Exec("DELETE FROM product WHERE id = $1", id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		switch pqErr.Constraint {
+		case "product_parent_id_fkey":
+			return models.ErrProductHasVariants
+		case "product_components_component_id_fkey":
+			return fmt.Errorf("%w: remove it from its bundles first", models.ErrProductIsComponent)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Lookup is the scan path: both branches are a single primary key or unique
+// index probe.
+func (repo *productRepository) Lookup(barcode, sku string) (*models.Product, error) {
+	query := `
+		SELECT ` + productColumns + `
+		FROM product p
+		LEFT JOIN category c ON p.category_id = c.id
+		WHERE p.sku = $1`
+	arg := sku
+	if barcode != "" {
+		query = `
+		SELECT ` + productColumns + `
+		FROM product_barcodes pb
+		JOIN product p ON p.id = pb.product_id
+		LEFT JOIN category c ON p.category_id = c.id
+		WHERE pb.barcode = $1`
+		arg = barcode
+	}
+
+	var p models.Product
+	err := scanProduct(repo.db.QueryRow(query, arg), &p)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (repo *productRepository) GetVariants(parentID int) ([]models.Product, error) {
+	if _, err := repo.GetByID(parentID); err != nil {
+		return nil, err
+	}
+	return queryProducts(repo.db, `
+		SELECT `+productColumns+`
+		FROM product p
+		LEFT JOIN category c ON p.category_id = c.id
+		WHERE p.parent_id = $1
+		ORDER BY p.id`, parentID)
+}
+
+// GenerateVariants stores options on the parent and creates a variant for
+// every combination of values that has none yet. Variants start at the
+// parent's price, cost price, category and tax rate with no stock; when the
+// parent has a SKU each variant gets it suffixed with its values. Variants
+// whose combination is no longer offered are kept, since sales may point at
+// them.
+func (repo *productRepository) GenerateVariants(parentID int, options []models.ProductOption) ([]models.Product, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var parent models.Product
+	err = scanProduct(tx.QueryRow(`
+		SELECT `+productColumns+`
+		FROM product p
+		LEFT JOIN category c ON p.category_id = c.id
+		WHERE p.id = $1
+		FOR UPDATE OF p`, parentID), &parent)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parent.ParentID != 0 {
+		return nil, fmt.Errorf("%w: a variant cannot have variants of its own", models.ErrInvalidProduct)
+	}
+	if parent.Type == models.ProductTypeBundle {
+		return nil, fmt.Errorf("%w: a bundle cannot have variants", models.ErrInvalidProduct)
+	}
+	var isComponent bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM product_components WHERE component_id = $1)", parentID).
+		Scan(&isComponent)
+	if err != nil {
+		return nil, err
+	}
+	if isComponent {
+		return nil, fmt.Errorf("%w: %s is a bundle component; give the bundle a variant instead",
+			models.ErrInvalidProduct, parent.Name)
+	}
+
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE product SET options = $1 WHERE id = $2", encoded, parentID); err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	rows, err := tx.Query("SELECT option_values FROM product WHERE parent_id = $1", parentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var values map[string]string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[combinationKey(options, values)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, values := range combinations(options) {
+		if existing[combinationKey(options, values)] {
+			continue
+		}
+
+		labels := make([]string, len(options))
+		for i, o := range options {
+			labels[i] = values[o.Name]
+		}
+		sku := ""
+		if parent.SKU != "" {
+			sku = strings.ToUpper(parent.SKU + "-" + strings.Join(labels, "-"))
+		}
+		encodedValues, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO product (name, sku, price, cost_price, stock, category_id, tax_rate_id, parent_id, option_values,
+				unit, quantity_precision, reorder_point, reorder_quantity, preferred_supplier_id)
+			VALUES ($1, NULLIF($2, ''), $3, $4, 0, NULLIF($5, 0), NULLIF($6, 0), $7, $8, $9, $10, $11, $12, NULLIF($13, 0))`,
+			parent.Name+" / "+strings.Join(labels, " / "), sku, parent.Price, parent.CostPrice, parent.CategoryID,
+			parent.TaxRateID, parentID, encodedValues, parent.Unit, parent.Precision, parent.ReorderPoint,
+			parent.ReorderQuantity, parent.PreferredSupplierID)
+		if err != nil {
+			return nil, productWriteError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetVariants(parentID)
+}
+
+// ReceiveStock adds stock to a product. A quantity given in one of its packs
+// is converted to the product's unit first, so three cartons of 24 add 72.
+func (repo *productRepository) ReceiveStock(id int, req models.ReceiveStockRequest) (*models.Product, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var name, productType string
+	var precision int
+	var unitCost money.Money
+	err = tx.QueryRow("SELECT name, type, quantity_precision, cost_price FROM product WHERE id = $1 FOR UPDATE", id).
+		Scan(&name, &productType, &precision, &unitCost)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if productType == models.ProductTypeBundle {
+		return nil, fmt.Errorf("%w: %s is a bundle; receive its components instead", models.ErrInvalidProduct, name)
+	}
+
+	if req.UnitCost != nil {
+		unitCost = *req.UnitCost
+	}
+
+	qty := req.Quantity
+	reason := ""
+	if req.Pack != "" {
+		var size quantity.Quantity
+		err = tx.QueryRow("SELECT size FROM product_packs WHERE product_id = $1 AND name = $2", id, req.Pack).Scan(&size)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s has no pack named %q", models.ErrInvalidProduct, name, req.Pack)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if qty.Places() > 0 {
+			return nil, fmt.Errorf("%w: packs are received whole, not %s", models.ErrInvalidQuantity, qty)
+		}
+		qty, _ = qty.Mul(size)
+		reason = fmt.Sprintf("%s x %s", req.Quantity, req.Pack)
+		if req.UnitCost != nil {
+			unitCost = unitCost.MulRat(1000, int64(size), repo.costing.rounding)
+		}
+	}
+	if err := checkPrecision(name, precision, qty); err != nil {
+		return nil, err
+	}
+
+	movement := &models.StockMovement{
+		ProductID:   id,
+		Type:        models.StockMovementReceipt,
+		Quantity:    qty,
+		UnitCost:    unitCost,
+		Reason:      reason,
+		PerformedBy: req.PerformedBy,
+	}
+	if err := repo.costing.moveStock(tx, movement); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// combinations expands option axes into every combination of their values,
+// first axis varying slowest.
+func combinations(options []models.ProductOption) []map[string]string {
+	result := []map[string]string{{}}
+	for _, o := range options {
+		next := make([]map[string]string, 0, len(result)*len(o.Values))
+		for _, partial := range result {
+			for _, v := range o.Values {
+				combo := make(map[string]string, len(partial)+1)
+				for k, pv := range partial {
+					combo[k] = pv
+				}
+				combo[o.Name] = v
+				next = append(next, combo)
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// combinationKey identifies a variant by its values on the given axes only,
+// so values on axes that have since been dropped are ignored.
+func combinationKey(options []models.ProductOption, values map[string]string) string {
+	names := make([]string, len(options))
+	for i, o := range options {
+		names[i] = o.Name
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + values[name]
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// resolveProductCodes returns items with ProductID filled in for the ones
+// that name their product by barcode or SKU.
+func resolveProductCodes(q queryer, items []models.CheckoutItem) ([]models.CheckoutItem, error) {
+	resolved := make([]models.CheckoutItem, len(items))
+	for i, item := range items {
+		var err error
+		switch {
+		case item.ProductID != 0:
+		case item.Barcode != "":
+			code, normErr := barcode.Normalize(item.Barcode)
+			if normErr != nil {
+				return nil, fmt.Errorf("%w: %v", models.ErrUnknownProductCode, normErr)
+			}
+			err = q.QueryRow("SELECT product_id FROM product_barcodes WHERE barcode = $1", code).Scan(&item.ProductID)
+		case item.SKU != "":
+			err = q.QueryRow("SELECT id FROM product WHERE sku = $1", item.SKU).Scan(&item.ProductID)
+		}
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: barcode %q, sku %q", models.ErrUnknownProductCode, item.Barcode, item.SKU)
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = item
+	}
+	return resolved, nil
 }
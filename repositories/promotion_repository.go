@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type PromotionRepositoryInput interface {
+	GetAll() ([]models.Promotion, error)
+	Create(promotion *models.Promotion) error
+	GetByID(id int) (*models.Promotion, error)
+	Update(promotion *models.Promotion) error
+	Delete(id int) error
+}
+
+type promotionRepository struct {
+	db *sql.DB
+}
+
+func NewPromotionRepository(db *sql.DB) PromotionRepositoryInput {
+	return &promotionRepository{db: db}
+}
+
+const promotionColumns = `id, name, type, level, percent_bps, amount, buy_quantity, get_quantity, bundle_price,
+	min_spend, product_ids, category_ids, priority, active, starts_at, ends_at`
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanPromotion(row rowScanner, p *models.Promotion) error {
+	var productIDs, categoryIDs pq.Int64Array
+	var endsAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.Type, &p.Level, &p.Percent, &p.Amount, &p.BuyQuantity, &p.GetQuantity,
+		&p.BundlePrice, &p.MinSpend, &productIDs, &categoryIDs, &p.Priority, &p.Active, &p.StartsAt, &endsAt)
+	if err != nil {
+		return err
+	}
+
+	p.ProductIDs = make([]int, len(productIDs))
+	for i, id := range productIDs {
+		p.ProductIDs[i] = int(id)
+	}
+	p.CategoryIDs = make([]int, len(categoryIDs))
+	for i, id := range categoryIDs {
+		p.CategoryIDs[i] = int(id)
+	}
+	if endsAt.Valid {
+		p.EndsAt = &endsAt.Time
+	}
+	return nil
+}
+
+func queryPromotions(q queryer, query string, args ...interface{}) ([]models.Promotion, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := make([]models.Promotion, 0)
+	for rows.Next() {
+		var p models.Promotion
+		if err := scanPromotion(rows, &p); err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, p)
+	}
+
+	return promotions, rows.Err()
+}
+
+// loadActivePromotions returns the promotions running right now.
+func loadActivePromotions(q queryer) ([]models.Promotion, error) {
+	return queryPromotions(q, `
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE active AND starts_at <= NOW() AND (ends_at IS NULL OR ends_at > NOW())
+		ORDER BY priority, id`)
+}
+
+func (repo *promotionRepository) GetAll() ([]models.Promotion, error) {
+	return queryPromotions(repo.db, "SELECT "+promotionColumns+" FROM promotions ORDER BY priority, id")
+}
+
+func (repo *promotionRepository) Create(p *models.Promotion) error {
+	query := `
+		INSERT INTO promotions (name, type, level, percent_bps, amount, buy_quantity, get_quantity, bundle_price,
+			min_spend, product_ids, category_ids, priority, active, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, COALESCE($14, NOW()), $15)
+		RETURNING id, starts_at`
+	return repo.db.QueryRow(query, p.Name, p.Type, p.Level, p.Percent, p.Amount, p.BuyQuantity, p.GetQuantity,
+		p.BundlePrice, p.MinSpend, pq.Array(p.ProductIDs), pq.Array(p.CategoryIDs), p.Priority, p.Active,
+		nullTime(p.StartsAt), p.EndsAt).Scan(&p.ID, &p.StartsAt)
+}
+
+func (repo *promotionRepository) GetByID(id int) (*models.Promotion, error) {
+	var p models.Promotion
+	err := scanPromotion(repo.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = $1", id), &p)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("promotion not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (repo *promotionRepository) Update(p *models.Promotion) error {
+	query := `
+		UPDATE promotions SET name = $1, type = $2, level = $3, percent_bps = $4, amount = $5, buy_quantity = $6,
+			get_quantity = $7, bundle_price = $8, min_spend = $9, product_ids = $10, category_ids = $11,
+			priority = $12, active = $13, starts_at = COALESCE($14, starts_at), ends_at = $15
+		WHERE id = $16
+		RETURNING starts_at`
+	err := repo.db.QueryRow(query, p.Name, p.Type, p.Level, p.Percent, p.Amount, p.BuyQuantity, p.GetQuantity,
+		p.BundlePrice, p.MinSpend, pq.Array(p.ProductIDs), pq.Array(p.CategoryIDs), p.Priority, p.Active,
+		nullTime(p.StartsAt), p.EndsAt, p.ID).Scan(&p.StartsAt)
+	if err == sql.ErrNoRows {
+		return errors.New("promotion not found")
+	}
+	return err
+}
+
+func (repo *promotionRepository) Delete(id int) error {
+	result, err := repo.db.Exec("DELETE FROM promotions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("promotion not found")
+	}
+
+	return nil
+}
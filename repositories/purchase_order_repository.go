@@ -0,0 +1,572 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+type PurchaseOrderRepositoryInput interface {
+	GetAll(status string, supplierID int) ([]models.PurchaseOrder, error)
+	Create(req models.PurchaseOrderRequest) (*models.PurchaseOrder, error)
+	GetByID(id int) (*models.PurchaseOrder, error)
+	Update(id int, req models.PurchaseOrderRequest) (*models.PurchaseOrder, error)
+	Send(id int) (*models.PurchaseOrder, error)
+	Cancel(id int) (*models.PurchaseOrder, error)
+	Receive(id int, req models.GoodsReceiptRequest) (*models.GoodsReceipt, error)
+	GetOutstanding(supplierID int) ([]models.OutstandingOrders, error)
+	GetSuggestions(opts models.ReorderOptions) ([]models.SuggestedPurchaseOrder, error)
+}
+
+type purchaseOrderRepository struct {
+	db           *sql.DB
+	roundingMode money.RoundingMode
+	costing      stockCosting
+}
+
+// NewPurchaseOrderRepository prices order lines with roundingMode and costs
+// the goods it receives with costingMethod.
+func NewPurchaseOrderRepository(db *sql.DB, roundingMode money.RoundingMode, costingMethod models.CostingMethod) PurchaseOrderRepositoryInput {
+	return &purchaseOrderRepository{
+		db:           db,
+		roundingMode: roundingMode,
+		costing:      stockCosting{method: costingMethod, rounding: roundingMode},
+	}
+}
+
+const purchaseOrderColumns = `po.id, po.supplier_id, s.name, po.status, COALESCE(po.note, ''), po.created_by,
+	po.created_at, po.sent_at, po.closed_at`
+
+func scanPurchaseOrder(row rowScanner, o *models.PurchaseOrder) error {
+	var sentAt, closedAt sql.NullTime
+	if err := row.Scan(&o.ID, &o.SupplierID, &o.SupplierName, &o.Status, &o.Note, &o.CreatedBy, &o.CreatedAt,
+		&sentAt, &closedAt); err != nil {
+		return err
+	}
+	if sentAt.Valid {
+		o.SentAt = &sentAt.Time
+	}
+	if closedAt.Valid {
+		o.ClosedAt = &closedAt.Time
+	}
+	return nil
+}
+
+// queryOrders runs a query over purchaseOrderColumns and loads each order's
+// lines.
+func (repo *purchaseOrderRepository) queryOrders(query string, args ...interface{}) ([]models.PurchaseOrder, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]models.PurchaseOrder, 0)
+	for rows.Next() {
+		var o models.PurchaseOrder
+		if err := scanPurchaseOrder(rows, &o); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := repo.loadLines(orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (repo *purchaseOrderRepository) loadLines(orders []models.PurchaseOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(orders))
+	index := make(map[int]int, len(orders))
+	for i := range orders {
+		ids[i] = int64(orders[i].ID)
+		index[orders[i].ID] = i
+		orders[i].Lines = make([]models.PurchaseOrderLine, 0)
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT purchase_order_id, id, COALESCE(product_id, 0), product_name, unit, quantity, received, unit_cost
+		FROM purchase_order_lines
+		WHERE purchase_order_id = ANY($1)
+		ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID int
+		var l models.PurchaseOrderLine
+		if err := rows.Scan(&orderID, &l.ID, &l.ProductID, &l.ProductName, &l.Unit, &l.Quantity, &l.Received,
+			&l.UnitCost); err != nil {
+			return err
+		}
+		l.Outstanding = l.Quantity - l.Received
+		if l.Outstanding < 0 {
+			l.Outstanding = 0
+		}
+		l.Total = l.Quantity.Price(l.UnitCost, repo.roundingMode)
+
+		o := &orders[index[orderID]]
+		o.Lines = append(o.Lines, l)
+		o.Total = o.Total.Add(l.Total)
+	}
+
+	return rows.Err()
+}
+
+// GetAll lists orders newest first, optionally only those in one status or
+// with one supplier.
+func (repo *purchaseOrderRepository) GetAll(status string, supplierID int) ([]models.PurchaseOrder, error) {
+	return repo.queryOrders(`
+		SELECT `+purchaseOrderColumns+`
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+		WHERE ($1 = '' OR po.status = $1) AND ($2 = 0 OR po.supplier_id = $2)
+		ORDER BY po.created_at DESC, po.id DESC`, status, supplierID)
+}
+
+// GetByID returns the order with its lines and every delivery received
+// against it.
+func (repo *purchaseOrderRepository) GetByID(id int) (*models.PurchaseOrder, error) {
+	orders, err := repo.queryOrders(`
+		SELECT `+purchaseOrderColumns+`
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+		WHERE po.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, models.ErrPurchaseOrderNotFound
+	}
+	order := &orders[0]
+
+	receipts, err := repo.loadReceipts(id)
+	if err != nil {
+		return nil, err
+	}
+	order.Receipts = receipts
+	return order, nil
+}
+
+func (repo *purchaseOrderRepository) loadReceipts(orderID int) ([]models.GoodsReceipt, error) {
+	rows, err := repo.db.Query(`
+		SELECT gr.id, gr.received_by, COALESCE(gr.note, ''), gr.created_at,
+			gl.id, COALESCE(gl.product_id, 0), gl.product_name, gl.quantity, gl.unit_cost
+		FROM goods_receipts gr
+		JOIN goods_receipt_lines gl ON gl.goods_receipt_id = gr.id
+		WHERE gr.purchase_order_id = $1
+		ORDER BY gr.id, gl.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := make([]models.GoodsReceipt, 0)
+	for rows.Next() {
+		var r models.GoodsReceipt
+		var l models.GoodsReceiptLine
+		if err := rows.Scan(&r.ID, &r.ReceivedBy, &r.Note, &r.CreatedAt,
+			&l.ID, &l.ProductID, &l.ProductName, &l.Quantity, &l.UnitCost); err != nil {
+			return nil, err
+		}
+		if n := len(receipts); n == 0 || receipts[n-1].ID != r.ID {
+			r.PurchaseOrderID = orderID
+			receipts = append(receipts, r)
+		}
+		last := &receipts[len(receipts)-1]
+		last.Lines = append(last.Lines, l)
+	}
+
+	return receipts, rows.Err()
+}
+
+// Create drafts an order.
+func (repo *purchaseOrderRepository) Create(req models.PurchaseOrderRequest) (*models.PurchaseOrder, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := requireSupplier(tx, req.SupplierID); err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO purchase_orders (supplier_id, status, note, created_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		RETURNING id`,
+		req.SupplierID, models.PurchaseOrderStatusDraft, req.Note, req.CreatedBy).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertPurchaseOrderLines(tx, id, req.Lines); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// Update replaces the supplier, note and lines of a draft. Once sent, an
+// order can only be received or cancelled.
+func (repo *purchaseOrderRepository) Update(id int, req models.PurchaseOrderRequest) (*models.PurchaseOrder, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, err := lockPurchaseOrder(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != models.PurchaseOrderStatusDraft {
+		return nil, fmt.Errorf("%w: only a draft can be changed", models.ErrPurchaseOrderStatus)
+	}
+	if err := requireSupplier(tx, req.SupplierID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE purchase_orders SET supplier_id = $1, note = NULLIF($2, '') WHERE id = $3",
+		req.SupplierID, req.Note, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM purchase_order_lines WHERE purchase_order_id = $1", id); err != nil {
+		return nil, err
+	}
+	if err := insertPurchaseOrderLines(tx, id, req.Lines); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// Send marks a draft as sent to the supplier.
+func (repo *purchaseOrderRepository) Send(id int) (*models.PurchaseOrder, error) {
+	return repo.transition(id, models.PurchaseOrderStatusSent, models.PurchaseOrderStatusDraft)
+}
+
+// Cancel closes an order that has not been fully received. Anything already
+// received stays in stock.
+func (repo *purchaseOrderRepository) Cancel(id int) (*models.PurchaseOrder, error) {
+	return repo.transition(id, models.PurchaseOrderStatusCancelled, models.PurchaseOrderStatusDraft,
+		models.PurchaseOrderStatusSent, models.PurchaseOrderStatusPartiallyReceived)
+}
+
+func (repo *purchaseOrderRepository) transition(id int, to string, from ...string) (*models.PurchaseOrder, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, err := lockPurchaseOrder(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || s == status
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: order is %s", models.ErrPurchaseOrderStatus, status)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE purchase_orders SET status = $1,
+			sent_at = CASE WHEN $1 = 'sent' THEN NOW() ELSE sent_at END,
+			closed_at = CASE WHEN $1 = 'cancelled' THEN NOW() ELSE closed_at END
+		WHERE id = $2`, to, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// receivingLine is an order line as it stands when a delivery is booked.
+type receivingLine struct {
+	id        int
+	productID int
+	name      string
+	precision int
+	quantity  quantity.Quantity
+	received  quantity.Quantity
+	unitCost  money.Money
+}
+
+// Receive books a delivery against a sent order. Each product received goes
+// into stock through the ledger as a receipt, and the order becomes
+// partially received or, once nothing is outstanding, received. A line
+// cannot be received beyond what is outstanding on it.
+func (repo *purchaseOrderRepository) Receive(id int, req models.GoodsReceiptRequest) (*models.GoodsReceipt, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, err := lockPurchaseOrder(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != models.PurchaseOrderStatusSent && status != models.PurchaseOrderStatusPartiallyReceived {
+		return nil, fmt.Errorf("%w: order is %s", models.ErrPurchaseOrderStatus, status)
+	}
+
+	rows, err := tx.Query(`
+		SELECT l.id, COALESCE(l.product_id, 0), l.product_name, COALESCE(p.quantity_precision, 0), l.quantity,
+			l.received, l.unit_cost
+		FROM purchase_order_lines l
+		LEFT JOIN product p ON p.id = l.product_id
+		WHERE l.purchase_order_id = $1
+		ORDER BY l.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]receivingLine, 0)
+	for rows.Next() {
+		var l receivingLine
+		if err := rows.Scan(&l.id, &l.productID, &l.name, &l.precision, &l.quantity, &l.received, &l.unitCost); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	byProduct := make(map[int]*receivingLine, len(lines))
+	for i := range lines {
+		if lines[i].productID != 0 {
+			byProduct[lines[i].productID] = &lines[i]
+		}
+	}
+
+	receipt := &models.GoodsReceipt{PurchaseOrderID: id, ReceivedBy: req.ReceivedBy, Note: req.Note}
+	for _, item := range req.Lines {
+		line, ok := byProduct[item.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %d is not on this order", models.ErrInvalidPurchaseOrder, item.ProductID)
+		}
+		if err := checkPrecision(line.name, line.precision, item.Quantity); err != nil {
+			return nil, err
+		}
+		if outstanding := line.quantity - line.received; item.Quantity > outstanding {
+			return nil, fmt.Errorf("%w: only %s of %s is outstanding, not %s", models.ErrInvalidPurchaseOrder,
+				outstanding, line.name, item.Quantity)
+		}
+		unitCost := line.unitCost
+		if item.UnitCost != nil {
+			unitCost = *item.UnitCost
+		}
+		line.received += item.Quantity
+		receipt.Lines = append(receipt.Lines, models.GoodsReceiptLine{
+			ProductID:   item.ProductID,
+			ProductName: line.name,
+			Quantity:    item.Quantity,
+			UnitCost:    unitCost,
+		})
+	}
+	// Stock rows are updated in product ID order, as checkout locks them.
+	sort.Slice(receipt.Lines, func(i, j int) bool { return receipt.Lines[i].ProductID < receipt.Lines[j].ProductID })
+
+	err = tx.QueryRow(`
+		INSERT INTO goods_receipts (purchase_order_id, received_by, note)
+		VALUES ($1, $2, NULLIF($3, ''))
+		RETURNING id, created_at`, id, req.ReceivedBy, req.Note).Scan(&receipt.ID, &receipt.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range receipt.Lines {
+		l := &receipt.Lines[i]
+		line := byProduct[l.ProductID]
+		err = tx.QueryRow(`
+			INSERT INTO goods_receipt_lines (goods_receipt_id, purchase_order_line_id, product_id, product_name, quantity, unit_cost)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`,
+			receipt.ID, line.id, l.ProductID, l.ProductName, l.Quantity, l.UnitCost).Scan(&l.ID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE purchase_order_lines SET received = $1 WHERE id = $2", line.received, line.id); err != nil {
+			return nil, err
+		}
+
+		err = repo.costing.moveStock(tx, &models.StockMovement{
+			ProductID:      l.ProductID,
+			Type:           models.StockMovementReceipt,
+			Quantity:       l.Quantity,
+			UnitCost:       l.UnitCost,
+			Reason:         fmt.Sprintf("purchase order %d", id),
+			PerformedBy:    req.ReceivedBy,
+			GoodsReceiptID: receipt.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newStatus := models.PurchaseOrderStatusReceived
+	for _, line := range lines {
+		if line.received < line.quantity {
+			newStatus = models.PurchaseOrderStatusPartiallyReceived
+			break
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE purchase_orders SET status = $1, closed_at = CASE WHEN $1 = 'received' THEN NOW() ELSE closed_at END
+		WHERE id = $2`, newStatus, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// GetOutstanding lists, per supplier, the sent orders still waiting for
+// some or all of their goods, oldest first.
+func (repo *purchaseOrderRepository) GetOutstanding(supplierID int) ([]models.OutstandingOrders, error) {
+	orders, err := repo.queryOrders(`
+		SELECT `+purchaseOrderColumns+`
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+		WHERE po.status IN ('sent', 'partially_received') AND ($1 = 0 OR po.supplier_id = $1)
+		ORDER BY s.name, po.supplier_id, po.created_at, po.id`, supplierID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.OutstandingOrders, 0)
+	for _, o := range orders {
+		if n := len(result); n == 0 || result[n-1].SupplierID != o.SupplierID {
+			result = append(result, models.OutstandingOrders{SupplierID: o.SupplierID, SupplierName: o.SupplierName})
+		}
+		group := &result[len(result)-1]
+		for _, l := range o.Lines {
+			group.OutstandingValue = group.OutstandingValue.Add(l.Outstanding.Price(l.UnitCost, repo.roundingMode))
+		}
+		group.Orders = append(group.Orders, o)
+	}
+	return result, nil
+}
+
+// GetSuggestions groups what the low products should be reordered in by
+// preferred supplier. Products nothing needs ordering for are left out.
+func (repo *purchaseOrderRepository) GetSuggestions(opts models.ReorderOptions) ([]models.SuggestedPurchaseOrder, error) {
+	products, err := findLowStock(repo.db, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.SuggestedPurchaseOrder, 0)
+	for _, p := range products {
+		if p.SuggestedQuantity == 0 {
+			continue
+		}
+		if n := len(suggestions); n == 0 || suggestions[n-1].SupplierID != p.SupplierID {
+			suggestions = append(suggestions, models.SuggestedPurchaseOrder{
+				SupplierID:   p.SupplierID,
+				SupplierName: p.SupplierName,
+				Total:        money.New(0, money.DefaultCurrency()),
+			})
+		}
+		group := &suggestions[len(suggestions)-1]
+		group.Total = group.Total.Add(p.SuggestedQuantity.Price(p.UnitCost, repo.roundingMode))
+		group.Lines = append(group.Lines, p)
+	}
+	return suggestions, nil
+}
+
+// lockPurchaseOrder locks an order for a change and returns its status.
+func lockPurchaseOrder(tx *sql.Tx, id int) (string, error) {
+	var status string
+	err := tx.QueryRow("SELECT status FROM purchase_orders WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", models.ErrPurchaseOrderNotFound
+	}
+	return status, err
+}
+
+func requireSupplier(tx *sql.Tx, supplierID int) error {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM suppliers WHERE id = $1)", supplierID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: supplier %d not found", models.ErrInvalidPurchaseOrder, supplierID)
+	}
+	return nil
+}
+
+// insertPurchaseOrderLines adds the lines of an order. Only products that
+// hold stock can be ordered: not bundles, nor parents with variants.
+func insertPurchaseOrderLines(tx *sql.Tx, orderID int, lines []models.PurchaseOrderLineRequest) error {
+	for _, l := range lines {
+		var name, productType, unit string
+		var precision int
+		var hasVariants bool
+		err := tx.QueryRow(`
+			SELECT p.name, p.type, p.unit, p.quantity_precision, EXISTS (SELECT 1 FROM product v WHERE v.parent_id = p.id)
+			FROM product p WHERE p.id = $1`, l.ProductID).
+			Scan(&name, &productType, &unit, &precision, &hasVariants)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: product %d not found", models.ErrInvalidPurchaseOrder, l.ProductID)
+		}
+		if err != nil {
+			return err
+		}
+		if productType != models.ProductTypeStandard || hasVariants {
+			return fmt.Errorf("%w: %s holds no stock of its own; order its components or variants",
+				models.ErrInvalidPurchaseOrder, name)
+		}
+		if err := checkPrecision(name, precision, l.Quantity); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO purchase_order_lines (purchase_order_id, product_id, product_name, unit, quantity, unit_cost)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			orderID, l.ProductID, name, unit, l.Quantity, l.UnitCost)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/quantity"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// lowStockQuery lists products at or below their reorder point with what
+// they sold over the last $1 days, net of returns, and what is still to come
+// on purchase orders. A bundle sold counts as its components sold. $2
+// narrows it to one preferred supplier.
+const lowStockQuery = `
+	WITH returned AS (
+		SELECT detail_id, SUM(quantity) AS quantity FROM transaction_return_items GROUP BY detail_id
+	), sold AS (
+		SELECT product_id, SUM(quantity) AS quantity
+		FROM (
+			SELECT td.product_id, td.quantity - COALESCE(r.quantity, 0) AS quantity
+			FROM transaction_details td
+			JOIN "transaction" t ON t.id = td.transaction_id
+			LEFT JOIN returned r ON r.detail_id = td.id
+			WHERE t.status <> 'voided' AND t.created_at >= NOW() - $1 * INTERVAL '1 day'
+				AND NOT EXISTS (SELECT 1 FROM transaction_detail_components dc WHERE dc.detail_id = td.id)
+			UNION ALL
+			SELECT dc.product_id, ROUND(dc.quantity * (td.quantity - COALESCE(r.quantity, 0)), 3)
+			FROM transaction_detail_components dc
+			JOIN transaction_details td ON td.id = dc.detail_id
+			JOIN "transaction" t ON t.id = td.transaction_id
+			LEFT JOIN returned r ON r.detail_id = td.id
+			WHERE t.status <> 'voided' AND t.created_at >= NOW() - $1 * INTERVAL '1 day'
+		) s
+		WHERE product_id IS NOT NULL
+		GROUP BY product_id
+	), on_order AS (
+		SELECT l.product_id, SUM(l.quantity - l.received) AS quantity
+		FROM purchase_order_lines l
+		JOIN purchase_orders po ON po.id = l.purchase_order_id
+		WHERE po.status IN ('draft', 'sent', 'partially_received') AND l.product_id IS NOT NULL
+		GROUP BY l.product_id
+	)
+	SELECT p.id, p.name, COALESCE(p.sku, ''), p.unit, p.quantity_precision, p.stock, p.reorder_point,
+		p.reorder_quantity, COALESCE(o.quantity, 0), COALESCE(s.quantity, 0), p.cost_price,
+		COALESCE(p.preferred_supplier_id, 0), COALESCE(sp.name, '')
+	FROM product p
+	LEFT JOIN sold s ON s.product_id = p.id
+	LEFT JOIN on_order o ON o.product_id = p.id
+	LEFT JOIN suppliers sp ON sp.id = p.preferred_supplier_id
+	WHERE p.reorder_point > 0 AND p.stock <= p.reorder_point AND ($2 = 0 OR p.preferred_supplier_id = $2)
+	ORDER BY sp.name NULLS LAST, p.preferred_supplier_id, p.name, p.id`
+
+// findLowStock lists the products at or below their reorder point with
+// their days of cover and how much to reorder.
+func findLowStock(q queryer, opts models.ReorderOptions) ([]models.LowStockProduct, error) {
+	if opts.SalesWindowDays <= 0 {
+		opts.SalesWindowDays = models.DefaultSalesWindowDays
+	}
+	rows, err := q.Query(lowStockQuery, opts.SalesWindowDays, opts.SupplierID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]models.LowStockProduct, 0)
+	for rows.Next() {
+		var p models.LowStockProduct
+		var precision int
+		var sold quantity.Quantity
+		if err := rows.Scan(&p.ProductID, &p.ProductName, &p.SKU, &p.Unit, &precision, &p.Stock, &p.ReorderPoint,
+			&p.ReorderQuantity, &p.OnOrder, &sold, &p.UnitCost, &p.SupplierID, &p.SupplierName); err != nil {
+			return nil, err
+		}
+		days := quantity.Quantity(opts.SalesWindowDays)
+		p.AverageDailySales = (sold + days/2) / days
+		if p.AverageDailySales > 0 {
+			cover := math.Round(float64(max(p.Stock, 0))/float64(p.AverageDailySales)*10) / 10
+			p.DaysOfCover = &cover
+		}
+		p.SuggestedQuantity = suggestReorder(p, opts.CoverDays, precision)
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// suggestReorder is the reorder quantity, raised to cover coverDays of
+// average sales when that is more, and rounded up to the product's
+// precision. Nothing is suggested while what is on order would lift the
+// product above its reorder point.
+func suggestReorder(p models.LowStockProduct, coverDays, precision int) quantity.Quantity {
+	available := p.Stock + p.OnOrder
+	if available > p.ReorderPoint {
+		return 0
+	}
+	suggested := p.ReorderQuantity
+	if coverDays > 0 {
+		suggested = max(suggested, p.AverageDailySales*quantity.Quantity(coverDays)-available)
+	}
+
+	step := quantity.Quantity(1)
+	for i := precision; i < quantity.MaxPlaces; i++ {
+		step *= 10
+	}
+	return (suggested + step - 1) / step * step
+}
+
+// lowStockAlerts returns an alert for each product the sale movements took
+// from above its reorder point to at or below it.
+func lowStockAlerts(tx *sql.Tx, movements []models.StockMovement) ([]models.LowStockAlert, error) {
+	ids := make([]int64, len(movements))
+	for i, m := range movements {
+		ids[i] = int64(m.ProductID)
+	}
+	rows, err := tx.Query(`
+		SELECT id, name, reorder_point, reorder_quantity, COALESCE(preferred_supplier_id, 0)
+		FROM product
+		WHERE id = ANY($1) AND reorder_point > 0`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type reorder struct {
+		name              string
+		point, quantity   quantity.Quantity
+		preferredSupplier int
+	}
+	points := make(map[int]reorder)
+	for rows.Next() {
+		var id int
+		var r reorder
+		if err := rows.Scan(&id, &r.name, &r.point, &r.quantity, &r.preferredSupplier); err != nil {
+			return nil, err
+		}
+		points[id] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]models.LowStockAlert, 0)
+	for _, m := range movements {
+		r, ok := points[m.ProductID]
+		if !ok || m.StockAfter-m.Quantity <= r.point || m.StockAfter > r.point {
+			continue
+		}
+		alerts = append(alerts, models.LowStockAlert{
+			Event:           models.EventLowStock,
+			ProductID:       m.ProductID,
+			ProductName:     r.name,
+			Stock:           m.StockAfter,
+			ReorderPoint:    r.point,
+			ReorderQuantity: r.quantity,
+			SupplierID:      r.preferredSupplier,
+			TransactionID:   m.TransactionID,
+			RaisedAt:        time.Now(),
+		})
+	}
+	return alerts, nil
+}
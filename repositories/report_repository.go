@@ -2,48 +2,87 @@ package repositories
 
 import (
 	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
 	"database/sql"
+	"fmt"
+	"sort"
+	"time"
 )
 
 type ReportRepositoryInput interface {
 	GetSalesSummaryToday() (*models.SalesSummary, error)
 	GetSalesSummaryRange(startDate, endDate string) (*models.SalesSummary, error)
+	GetShiftReport(shiftID int) (*models.ShiftReport, error)
+	GetMarginReport(startDate, endDate string) (*models.MarginReport, error)
+	GetInventoryValuation(asOf string) (*models.InventoryValuation, error)
 }
 
 type ReportRepository struct {
 	db *sql.DB
+	// allocation splits bundle revenue over the bundle's components.
+	allocation models.BundleAllocation
 }
 
-func NewReportRepository(db *sql.DB) ReportRepositoryInput {
-	return &ReportRepository{db: db}
+func NewReportRepository(db *sql.DB, allocation models.BundleAllocation) ReportRepositoryInput {
+	return &ReportRepository{db: db, allocation: allocation}
 }
 
 func (repo *ReportRepository) GetSalesSummaryToday() (*models.SalesSummary, error) {
-	return repo.getSalesSummary("t.created_at::date = CURRENT_DATE")
+	return repo.getSalesSummary("%s >= CURRENT_DATE AND %[1]s < CURRENT_DATE + 1")
 }
 
 func (repo *ReportRepository) GetSalesSummaryRange(startDate, endDate string) (*models.SalesSummary, error) {
-	return repo.getSalesSummary("t.created_at::date >= $1 AND t.created_at::date <= $2", startDate, endDate)
+	return repo.getSalesSummary("%s >= $1::date AND %[1]s < $2::date + 1", startDate, endDate)
 }
 
-func (repo *ReportRepository) getSalesSummary(whereClause string, args ...interface{}) (*models.SalesSummary, error) {
+// getSalesSummary builds the summary for a date condition. dateFilter is a
+// format string whose %s is replaced by the timestamp column being filtered,
+// so sales are bucketed by sale date and returns by return date. The column
+// is compared with day bounds rather than cast to a date, so its index is
+// used.
+func (repo *ReportRepository) getSalesSummary(dateFilter string, args ...interface{}) (*models.SalesSummary, error) {
 	summary := &models.SalesSummary{}
+	salesFilter := fmt.Sprintf(dateFilter, "t.created_at") + ` AND t.status <> 'voided'`
+	refundFilter := fmt.Sprintf(dateFilter, "r.created_at")
 
 	err := repo.db.QueryRow(
-		`SELECT COALESCE(SUM(t."total_amount"), 0), COUNT(t.id) FROM "transaction" t WHERE `+whereClause,
+		`SELECT COALESCE(SUM(t."total_amount"), 0), COUNT(t.id) FROM "transaction" t WHERE `+salesFilter,
 		args...,
-	).Scan(&summary.TotalRevenue, &summary.TotalTransactions)
+	).Scan(&summary.GrossSales, &summary.TotalTransactions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.db.QueryRow(
+		`SELECT COALESCE(SUM(r.refund_amount), 0) FROM transaction_returns r WHERE `+refundFilter,
+		args...,
+	).Scan(&summary.Returns)
+	if err != nil {
+		return nil, err
+	}
+	summary.NetSales = summary.GrossSales.Sub(summary.Returns)
+	summary.TotalRevenue = summary.NetSales
+
+	summary.TaxCollected, err = repo.getTaxCollected(salesFilter, refundFilter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Payments, err = repo.getPayments(salesFilter, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	query := `
-		SELECT p.name, COALESCE(SUM(td.quantity), 0) AS qty
+		SELECT (ARRAY_AGG(td.product_name ORDER BY td.id DESC))[1], COALESCE(SUM(td.quantity - COALESCE(ri.quantity, 0)), 0) AS qty
 		FROM transaction_details td
-		JOIN product p ON p.id = td.product_id
 		JOIN "transaction" t ON t.id = td.transaction_id
-		WHERE ` + whereClause + `
-		GROUP BY p.id, p.name
+		LEFT JOIN (
+			SELECT detail_id, SUM(quantity) AS quantity FROM transaction_return_items GROUP BY detail_id
+		) ri ON ri.detail_id = td.id
+		WHERE ` + salesFilter + `
+		GROUP BY COALESCE(td.product_id::text, td.product_name)
 		ORDER BY qty DESC
 		LIMIT 1
 	`
@@ -55,12 +94,453 @@ func (repo *ReportRepository) getSalesSummary(whereClause string, args ...interf
 
 	if rows.Next() {
 		var productName string
-		var qty int
+		var qty quantity.Quantity
 		if err := rows.Scan(&productName, &qty); err != nil {
 			return nil, err
 		}
 		summary.BestSellingProduct = &models.BestSellingProduct{Name: productName, QuantitySold: qty}
 	}
 
+	summary.ProductSales, err = repo.getProductSales(salesFilter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.BundleComponents, err = repo.getBundleComponentSales(salesFilter, args...)
+	if err != nil {
+		return nil, err
+	}
+
 	return summary, nil
 }
+
+// getProductSales totals sales per product, less what was returned of them,
+// and rolls variant lines up under the parent snapshotted on the sale.
+// Products sold before they were deleted are kept apart by name.
+func (repo *ReportRepository) getProductSales(salesFilter string, args ...interface{}) ([]models.ProductSalesLine, error) {
+	query := `
+		SELECT COALESCE(MAX(td.product_id), 0), (ARRAY_AGG(td.product_name ORDER BY td.id DESC))[1],
+			COALESCE(td.parent_product_id, 0), COALESCE((ARRAY_AGG(td.parent_product_name ORDER BY td.id DESC))[1], ''),
+			COALESCE(SUM(td.quantity - COALESCE(ri.quantity, 0)), 0),
+			COALESCE(SUM(td.total_amount - COALESCE(ri.refund_amount, 0)), 0)
+		FROM transaction_details td
+		JOIN "transaction" t ON t.id = td.transaction_id
+		LEFT JOIN (
+			SELECT detail_id, SUM(quantity) AS quantity, SUM(refund_amount) AS refund_amount
+			FROM transaction_return_items GROUP BY detail_id
+		) ri ON ri.detail_id = td.id
+		WHERE ` + salesFilter + `
+		GROUP BY COALESCE(td.product_id::text, td.product_name), td.parent_product_id
+	`
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]models.ProductSalesLine, 0)
+	index := make(map[string]int)
+	lineFor := func(id int, name string) *models.ProductSalesLine {
+		key := "name:" + name
+		if id != 0 {
+			key = fmt.Sprint("id:", id)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(lines)
+			index[key] = i
+			lines = append(lines, models.ProductSalesLine{ProductID: id, Name: name})
+		}
+		return &lines[i]
+	}
+
+	type variantLine struct {
+		parentID   int
+		parentName string
+		line       models.ProductSalesLine
+	}
+	variants := make([]variantLine, 0)
+	for rows.Next() {
+		var line models.ProductSalesLine
+		var parentID int
+		var parentName string
+		if err := rows.Scan(&line.ProductID, &line.Name, &parentID, &parentName, &line.QuantitySold, &line.NetAmount); err != nil {
+			return nil, err
+		}
+		if parentID != 0 {
+			variants = append(variants, variantLine{parentID, parentName, line})
+			continue
+		}
+		total := lineFor(line.ProductID, line.Name)
+		total.QuantitySold += line.QuantitySold
+		total.NetAmount = total.NetAmount.Add(line.NetAmount)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, v := range variants {
+		parent := lineFor(v.parentID, v.parentName)
+		parent.QuantitySold += v.line.QuantitySold
+		parent.NetAmount = parent.NetAmount.Add(v.line.NetAmount)
+		parent.Variants = append(parent.Variants, v.line)
+	}
+
+	for i := range lines {
+		sortProductSales(lines[i].Variants)
+	}
+	sortProductSales(lines)
+	return lines, nil
+}
+
+// getBundleComponentSales splits each bundle line's takings, net of returns,
+// over the components copied onto it at sale time and totals the shares per
+// component.
+func (repo *ReportRepository) getBundleComponentSales(salesFilter string, args ...interface{}) ([]models.ProductSalesLine, error) {
+	query := `
+		SELECT td.id, td.quantity - COALESCE(ri.quantity, 0), td.total_amount - COALESCE(ri.refund_amount, 0),
+			COALESCE(dc.product_id, 0), dc.product_name, dc.quantity, dc.unit_price
+		FROM transaction_detail_components dc
+		JOIN transaction_details td ON td.id = dc.detail_id
+		JOIN "transaction" t ON t.id = td.transaction_id
+		LEFT JOIN (
+			SELECT detail_id, SUM(quantity) AS quantity, SUM(refund_amount) AS refund_amount
+			FROM transaction_return_items GROUP BY detail_id
+		) ri ON ri.detail_id = td.id
+		WHERE ` + salesFilter + `
+		ORDER BY td.id, dc.id
+	`
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type bundleLine struct {
+		quantity   quantity.Quantity
+		amount     money.Money
+		components []models.DetailComponent
+	}
+	bundles := make([]*bundleLine, 0)
+	var current *bundleLine
+	currentID := 0
+	for rows.Next() {
+		var detailID int
+		var line bundleLine
+		var c models.DetailComponent
+		if err := rows.Scan(&detailID, &line.quantity, &line.amount, &c.ProductID, &c.ProductName, &c.Quantity,
+			&c.UnitPrice); err != nil {
+			return nil, err
+		}
+		if current == nil || detailID != currentID {
+			current, currentID = &line, detailID
+			bundles = append(bundles, current)
+		}
+		current.components = append(current.components, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]models.ProductSalesLine, 0)
+	index := make(map[string]int)
+	for _, b := range bundles {
+		weights := make([]int64, len(b.components))
+		for k, c := range b.components {
+			switch repo.allocation {
+			case models.AllocateByQuantity:
+				weights[k] = int64(c.Quantity)
+			case models.AllocateEqually:
+				weights[k] = 1
+			default:
+				weights[k] = c.UnitPrice.Minor() * int64(c.Quantity)
+			}
+		}
+
+		for k, share := range b.amount.Allocate(weights) {
+			c := b.components[k]
+			key := "name:" + c.ProductName
+			if c.ProductID != 0 {
+				key = fmt.Sprint("id:", c.ProductID)
+			}
+			i, ok := index[key]
+			if !ok {
+				i = len(lines)
+				index[key] = i
+				lines = append(lines, models.ProductSalesLine{ProductID: c.ProductID, Name: c.ProductName})
+			}
+			sold, _ := c.Quantity.Mul(b.quantity)
+			lines[i].QuantitySold += sold
+			lines[i].NetAmount = lines[i].NetAmount.Add(share)
+		}
+	}
+
+	sortProductSales(lines)
+	return lines, nil
+}
+
+func sortProductSales(lines []models.ProductSalesLine) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].QuantitySold != lines[j].QuantitySold {
+			return lines[i].QuantitySold > lines[j].QuantitySold
+		}
+		return lines[i].Name < lines[j].Name
+	})
+}
+
+// getTaxCollected totals tax per rate from the rate snapshot on each line,
+// subtracting the tax portion of returns made in the same period.
+func (repo *ReportRepository) getTaxCollected(salesFilter, refundFilter string, args ...interface{}) ([]models.TaxSummaryLine, error) {
+	query := `
+		SELECT tax_code, tax_rate_bps, COALESCE(SUM(taxable), 0), COALESCE(SUM(tax), 0)
+		FROM (
+			SELECT td.tax_code, td.tax_rate_bps, td.total_amount - td.tax_amount AS taxable, td.tax_amount AS tax
+			FROM transaction_details td
+			JOIN "transaction" t ON t.id = td.transaction_id
+			WHERE td.tax_code IS NOT NULL AND ` + salesFilter + `
+			UNION ALL
+			SELECT td.tax_code, td.tax_rate_bps, -(ri.refund_amount - ri.tax_amount), -ri.tax_amount
+			FROM transaction_return_items ri
+			JOIN transaction_returns r ON r.id = ri.return_id
+			JOIN transaction_details td ON td.id = ri.detail_id
+			WHERE td.tax_code IS NOT NULL AND ` + refundFilter + `
+		) lines
+		GROUP BY tax_code, tax_rate_bps
+		ORDER BY tax_code, tax_rate_bps
+	`
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collected := make([]models.TaxSummaryLine, 0)
+	for rows.Next() {
+		var line models.TaxSummaryLine
+		if err := rows.Scan(&line.TaxCode, &line.Rate, &line.TaxableAmount, &line.TaxAmount); err != nil {
+			return nil, err
+		}
+		collected = append(collected, line)
+	}
+
+	return collected, rows.Err()
+}
+
+// getPayments totals the tenders taken on the sales matching salesFilter by
+// method.
+// Returns are not tied to a tender, so they are not subtracted here.
+func (repo *ReportRepository) getPayments(salesFilter string, args ...interface{}) ([]models.PaymentSummaryLine, error) {
+	query := `
+		SELECT p.method, COUNT(p.id), COALESCE(SUM(p.amount), 0)
+		FROM transaction_payments p
+		JOIN "transaction" t ON t.id = p.transaction_id
+		WHERE ` + salesFilter + `
+		GROUP BY p.method
+		ORDER BY p.method
+	`
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]models.PaymentSummaryLine, 0)
+	for rows.Next() {
+		var line models.PaymentSummaryLine
+		if err := rows.Scan(&line.Method, &line.Count, &line.Amount); err != nil {
+			return nil, err
+		}
+		payments = append(payments, line)
+	}
+
+	return payments, rows.Err()
+}
+
+// GetShiftReport totals a shift's sales, voids, refunds and cash movements.
+// Voided sales count only as voids; refunds are those paid out of this
+// shift's drawer, whichever shift made the sale.
+func (repo *ReportRepository) GetShiftReport(shiftID int) (*models.ShiftReport, error) {
+	report := &models.ShiftReport{GeneratedAt: time.Now()}
+	err := scanShift(repo.db.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE id = $1", shiftID), &report.Shift)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrShiftNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.OpeningFloat = report.Shift.OpeningFloat
+
+	err = repo.db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE status <> 'voided'),
+			COALESCE(SUM(total_amount) FILTER (WHERE status <> 'voided'), 0),
+			COUNT(*) FILTER (WHERE status = 'voided'),
+			COALESCE(SUM(total_amount) FILTER (WHERE status = 'voided'), 0)
+		FROM "transaction"
+		WHERE shift_id = $1`, shiftID).
+		Scan(&report.Transactions, &report.GrossSales, &report.Voids.Count, &report.Voids.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(refund_amount), 0) FROM transaction_returns WHERE shift_id = $1`,
+		shiftID).Scan(&report.Refunds.Count, &report.Refunds.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.db.QueryRow(`
+		SELECT COALESCE(SUM(amount) FILTER (WHERE type = $2), 0), COALESCE(SUM(amount) FILTER (WHERE type = $3), 0)
+		FROM cash_movements
+		WHERE shift_id = $1`, shiftID, models.CashMovementPayIn, models.CashMovementPayOut).
+		Scan(&report.PayIns, &report.PayOuts)
+	if err != nil {
+		return nil, err
+	}
+
+	report.SalesByTender, err = repo.getPayments(`t.shift_id = $1 AND t.status <> 'voided'`, shiftID)
+	if err != nil {
+		return nil, err
+	}
+	report.CashSales = money.New(0, money.DefaultCurrency())
+	for _, line := range report.SalesByTender {
+		if line.Method == models.PaymentMethodCash {
+			report.CashSales = line.Amount
+		}
+	}
+
+	report.ExpectedCash = money.Sum(report.OpeningFloat, report.CashSales, report.PayIns).
+		Sub(report.PayOuts).Sub(report.Refunds.Amount)
+	if report.Shift.CountedCash != nil {
+		counted := *report.Shift.CountedCash
+		variance := counted.Sub(report.ExpectedCash)
+		report.CountedCash = &counted
+		report.Variance = &variance
+	}
+
+	return report, nil
+}
+
+// GetMarginReport totals gross profit on the sales made from startDate to
+// endDate, each defaulting to today. A line's revenue is what was charged
+// less tax; its cost is the cost frozen on it at sale time. Returns on those
+// sales take back their share of both.
+func (repo *ReportRepository) GetMarginReport(startDate, endDate string) (*models.MarginReport, error) {
+	report := &models.MarginReport{}
+	err := repo.db.QueryRow("SELECT COALESCE(NULLIF($1, '')::date, CURRENT_DATE)::text, COALESCE(NULLIF($2, '')::date, CURRENT_DATE)::text",
+		startDate, endDate).Scan(&report.StartDate, &report.EndDate)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := `
+		SELECT td.product_id, td.product_name, td.category_id, td.category_name, td.id,
+			td.quantity - COALESCE(ri.quantity, 0) AS quantity,
+			td.total_amount - td.tax_amount - COALESCE(ri.refund_amount - ri.tax_amount, 0) AS revenue,
+			td.cost_amount - COALESCE(ROUND(td.cost_amount * ri.quantity / td.quantity), 0) AS cost
+		FROM transaction_details td
+		JOIN "transaction" t ON t.id = td.transaction_id
+		LEFT JOIN (
+			SELECT detail_id, SUM(quantity) AS quantity, SUM(refund_amount) AS refund_amount, SUM(tax_amount) AS tax_amount
+			FROM transaction_return_items GROUP BY detail_id
+		) ri ON ri.detail_id = td.id
+		WHERE t.created_at >= $1::date AND t.created_at < $2::date + 1 AND t.status <> 'voided'`
+
+	report.Products, err = repo.getMarginLines(`
+		SELECT COALESCE(MAX(product_id), 0), 0, (ARRAY_AGG(product_name ORDER BY id DESC))[1], SUM(quantity),
+			SUM(revenue), SUM(cost)
+		FROM (`+lines+`) l
+		GROUP BY COALESCE(product_id::text, product_name)`, report.StartDate, report.EndDate)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Categories, err = repo.getMarginLines(`
+		SELECT 0, COALESCE(category_id, 0), COALESCE((ARRAY_AGG(category_name ORDER BY id DESC))[1], ''), 0,
+			SUM(revenue), SUM(cost)
+		FROM (`+lines+`) l
+		GROUP BY category_id`, report.StartDate, report.EndDate)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Revenue = money.New(0, money.DefaultCurrency())
+	report.Cost = money.New(0, money.DefaultCurrency())
+	for _, line := range report.Categories {
+		report.Revenue = report.Revenue.Add(line.Revenue)
+		report.Cost = report.Cost.Add(line.Cost)
+	}
+	report.GrossProfit = report.Revenue.Sub(report.Cost)
+
+	return report, nil
+}
+
+// getMarginLines reads margin lines from query, largest gross profit first.
+func (repo *ReportRepository) getMarginLines(query string, args ...interface{}) ([]models.MarginLine, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]models.MarginLine, 0)
+	for rows.Next() {
+		var line models.MarginLine
+		if err := rows.Scan(&line.ProductID, &line.CategoryID, &line.Name, &line.QuantitySold, &line.Revenue,
+			&line.Cost); err != nil {
+			return nil, err
+		}
+		line.GrossProfit = line.Revenue.Sub(line.Cost)
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		if c := lines[i].GrossProfit.Cmp(lines[j].GrossProfit); c != 0 {
+			return c > 0
+		}
+		return lines[i].Name < lines[j].Name
+	})
+	return lines, nil
+}
+
+// GetInventoryValuation values the stock on hand at the end of asOf, today
+// by default, from the stock ledger: a product's stock is the sum of its
+// movements up to then and its value the sum of their values. Products
+// deleted since are listed under their last name, with no ID.
+func (repo *ReportRepository) GetInventoryValuation(asOf string) (*models.InventoryValuation, error) {
+	valuation := &models.InventoryValuation{TotalValue: money.New(0, money.DefaultCurrency())}
+	err := repo.db.QueryRow("SELECT COALESCE(NULLIF($1, '')::date, CURRENT_DATE)::text", asOf).Scan(&valuation.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT COALESCE(p.id, 0), COALESCE(p.name, MIN(m.product_name)) AS name, COALESCE(p.category_id, 0),
+			COALESCE(c.name, ''), COALESCE(p.unit, ''), SUM(m.quantity), SUM(m.value)
+		FROM stock_movements m
+		LEFT JOIN product p ON p.id = m.product_id
+		LEFT JOIN category c ON c.id = p.category_id
+		WHERE m.created_at < $1::date + 1
+		GROUP BY p.id, c.name, CASE WHEN p.id IS NULL THEN m.product_name END
+		HAVING SUM(m.quantity) <> 0 OR SUM(m.value) <> 0
+		ORDER BY c.name NULLS LAST, name, p.id`, valuation.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	valuation.Products = make([]models.InventoryValuationLine, 0)
+	for rows.Next() {
+		var line models.InventoryValuationLine
+		if err := rows.Scan(&line.ProductID, &line.Name, &line.CategoryID, &line.CategoryName, &line.Unit, &line.Stock,
+			&line.Value); err != nil {
+			return nil, err
+		}
+		valuation.TotalValue = valuation.TotalValue.Add(line.Value)
+		valuation.Products = append(valuation.Products, line)
+	}
+
+	return valuation, rows.Err()
+}
@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"database/sql"
+)
+
+type ShiftRepositoryInput interface {
+	GetAll(status string) ([]models.Shift, error)
+	Open(req models.OpenShiftRequest) (*models.Shift, error)
+	GetByID(id int) (*models.Shift, error)
+	Close(id int, req models.CloseShiftRequest) (*models.Shift, error)
+	AddCashMovement(movement *models.CashMovement) error
+}
+
+type shiftRepository struct {
+	db *sql.DB
+}
+
+func NewShiftRepository(db *sql.DB) ShiftRepositoryInput {
+	return &shiftRepository{db: db}
+}
+
+const shiftColumns = `id, register, opened_by, opening_float, status, opened_at, COALESCE(closed_by, ''), closed_at,
+	counted_cash`
+
+func scanShift(row rowScanner, s *models.Shift) error {
+	var closedAt sql.NullTime
+	var countedCash sql.NullString
+	if err := row.Scan(&s.ID, &s.Register, &s.OpenedBy, &s.OpeningFloat, &s.Status, &s.OpenedAt, &s.ClosedBy,
+		&closedAt, &countedCash); err != nil {
+		return err
+	}
+	if closedAt.Valid {
+		s.ClosedAt = &closedAt.Time
+	}
+	if countedCash.Valid {
+		s.CountedCash = new(money.Money)
+		if err := s.CountedCash.Scan(countedCash.String); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requireOpenShift takes a shared lock on the shift and fails unless it is
+// open. Closing takes an exclusive lock, so a close waits for in-flight sales
+// and no sale can slip in after it.
+func requireOpenShift(tx *sql.Tx, shiftID int) error {
+	var status string
+	err := tx.QueryRow("SELECT status FROM shifts WHERE id = $1 FOR SHARE", shiftID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return models.ErrShiftNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.ShiftStatusOpen {
+		return models.ErrShiftClosed
+	}
+	return nil
+}
+
+func (repo *shiftRepository) GetAll(status string) ([]models.Shift, error) {
+	query := "SELECT " + shiftColumns + " FROM shifts"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY opened_at DESC, id DESC"
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shifts := make([]models.Shift, 0)
+	for rows.Next() {
+		var s models.Shift
+		if err := scanShift(rows, &s); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, s)
+	}
+
+	return shifts, rows.Err()
+}
+
+// Open starts a shift on a register. A partial unique index allows only one
+// open shift per register.
+func (repo *shiftRepository) Open(req models.OpenShiftRequest) (*models.Shift, error) {
+	var s models.Shift
+	err := scanShift(repo.db.QueryRow(`
+		INSERT INTO shifts (register, opened_by, opening_float)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (register) WHERE status = 'open' DO NOTHING
+		RETURNING `+shiftColumns,
+		req.Register, req.OpenedBy, req.OpeningFloat), &s)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrShiftAlreadyOpen
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (repo *shiftRepository) GetByID(id int) (*models.Shift, error) {
+	var s models.Shift
+	err := scanShift(repo.db.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE id = $1", id), &s)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrShiftNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Close records the counted cash and closes the shift. The row lock makes a
+// second close wait and then fail the status check.
+func (repo *shiftRepository) Close(id int, req models.CloseShiftRequest) (*models.Shift, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM shifts WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrShiftNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != models.ShiftStatusOpen {
+		return nil, models.ErrShiftClosed
+	}
+
+	var s models.Shift
+	err = scanShift(tx.QueryRow(`
+		UPDATE shifts SET status = $1, closed_by = $2, closed_at = NOW(), counted_cash = $3
+		WHERE id = $4
+		RETURNING `+shiftColumns,
+		models.ShiftStatusClosed, req.ClosedBy, *req.CountedCash, id), &s)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (repo *shiftRepository) AddCashMovement(m *models.CashMovement) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := requireOpenShift(tx, m.ShiftID); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO cash_movements (shift_id, type, amount, reason, performed_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		m.ShiftID, m.Type, m.Amount, m.Reason, m.PerformedBy).Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
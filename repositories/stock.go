@@ -0,0 +1,292 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"database/sql"
+	"fmt"
+)
+
+// stockCosting values the stock ledger: what each movement in or out of
+// stock cost, and the cost price that leaves a product at.
+//
+// Stock coming in opens a cost layer and stock going out uses up the oldest
+// layers first, whichever method is configured, so the method can be changed
+// later. A receipt comes in at what it was bought at; anything else, such as
+// a return or a stocktake surplus, at the product's cost price.
+type stockCosting struct {
+	method   models.CostingMethod
+	rounding money.RoundingMode
+}
+
+// moveStock changes a product's stock by m.Quantity and writes the change to
+// the stock ledger. Every write to product.stock goes through here or
+// recordMovement, which keeps the column equal to the sum of the ledger.
+func (c stockCosting) moveStock(tx *sql.Tx, m *models.StockMovement) error {
+	err := tx.QueryRow("UPDATE product SET stock = stock + $1 WHERE id = $2 RETURNING stock", m.Quantity, m.ProductID).
+		Scan(&m.StockAfter)
+	if err != nil {
+		return err
+	}
+	return c.recordMovement(tx, m)
+}
+
+// recordMovement writes a ledger line for a change already made to
+// product.stock, for callers that need a conditional update of their own.
+// The product row must already be locked. The line keeps the product's
+// name, so it still reads after the product is deleted.
+func (c stockCosting) recordMovement(tx *sql.Tx, m *models.StockMovement) error {
+	if err := c.value(tx, m); err != nil {
+		return err
+	}
+	return tx.QueryRow(`
+		INSERT INTO stock_movements
+			(product_id, product_name, type, quantity, stock_after, unit_cost, value, reason, performed_by, transaction_id,
+			return_id, goods_receipt_id)
+		SELECT p.id, p.name, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, 0), NULLIF($10, 0),
+			NULLIF($11, 0)
+		FROM product p WHERE p.id = $1
+		RETURNING product_name, id, created_at`,
+		m.ProductID, m.Type, m.Quantity, m.StockAfter, m.UnitCost, m.Value, m.Reason, m.PerformedBy, m.TransactionID,
+		m.ReturnID, m.GoodsReceiptID).
+		Scan(&m.ProductName, &m.ID, &m.CreatedAt)
+}
+
+// value sets m.Value and m.UnitCost, keeps the product's cost layers in step
+// with the movement and moves its cost price on.
+func (c stockCosting) value(tx *sql.Tx, m *models.StockMovement) error {
+	var costPrice, onHand money.Money
+	err := tx.QueryRow(`
+		SELECT p.cost_price, COALESCE((SELECT SUM(value) FROM stock_movements WHERE product_id = p.id), 0)
+		FROM product p WHERE p.id = $1`, m.ProductID).Scan(&costPrice, &onHand)
+	if err != nil {
+		return err
+	}
+	stockBefore := m.StockAfter - m.Quantity
+
+	if m.Quantity >= 0 {
+		if m.Type != models.StockMovementReceipt {
+			m.UnitCost = costPrice
+		}
+		m.Value = m.Quantity.Price(m.UnitCost, c.rounding)
+		// Stock sold short is made good first; only what is left over
+		// opens a layer.
+		if layer := min(m.Quantity, m.StockAfter); layer > 0 {
+			_, err := tx.Exec(`
+				INSERT INTO cost_layers (product_id, unit_cost, quantity, remaining) VALUES ($1, $2, $3, $3)`,
+				m.ProductID, m.UnitCost, layer)
+			if err != nil {
+				return err
+			}
+		}
+		if m.Type != models.StockMovementReceipt {
+			return nil
+		}
+		if c.method == models.CostAverage {
+			newCost := m.UnitCost
+			if stockBefore > 0 && !onHand.IsNegative() {
+				newCost = onHand.Add(m.Value).MulRat(1000, int64(m.StockAfter), c.rounding)
+			}
+			_, err := tx.Exec("UPDATE product SET cost_price = $1 WHERE id = $2", newCost, m.ProductID)
+			return err
+		}
+		return c.refreshFIFOCost(tx, m.ProductID)
+	}
+
+	out := -m.Quantity
+	cost, err := c.useLayers(tx, m.ProductID, out, costPrice)
+	if err != nil {
+		return err
+	}
+	if c.method == models.CostAverage {
+		cost = out.Price(costPrice, c.rounding)
+	}
+	m.Value = cost.Neg()
+	m.UnitCost = cost.MulRat(1000, int64(out), c.rounding)
+	if c.method == models.CostFIFO {
+		return c.refreshFIFOCost(tx, m.ProductID)
+	}
+	return nil
+}
+
+// useLayers takes qty out of a product's cost layers, oldest first, and
+// returns what that stock cost. Anything beyond the layers, such as stock
+// sold short, is costed at fallback.
+func (c stockCosting) useLayers(tx *sql.Tx, productID int, qty quantity.Quantity, fallback money.Money) (money.Money, error) {
+	rows, err := tx.Query(`
+		SELECT id, unit_cost, remaining FROM cost_layers
+		WHERE product_id = $1 AND remaining > 0
+		ORDER BY id
+		FOR UPDATE`, productID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	type layer struct {
+		id        int
+		unitCost  money.Money
+		remaining quantity.Quantity
+	}
+	layers := make([]layer, 0)
+	for rows.Next() {
+		var l layer
+		if err := rows.Scan(&l.id, &l.unitCost, &l.remaining); err != nil {
+			rows.Close()
+			return money.Money{}, err
+		}
+		layers = append(layers, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return money.Money{}, err
+	}
+
+	cost := money.New(0, money.DefaultCurrency())
+	for _, l := range layers {
+		if qty == 0 {
+			break
+		}
+		take := min(qty, l.remaining)
+		if _, err := tx.Exec("UPDATE cost_layers SET remaining = remaining - $1 WHERE id = $2", take, l.id); err != nil {
+			return money.Money{}, err
+		}
+		cost = cost.Add(take.Price(l.unitCost, c.rounding))
+		qty -= take
+	}
+	return cost.Add(qty.Price(fallback, c.rounding)), nil
+}
+
+// refreshFIFOCost sets a product's cost price to its oldest layer still in
+// stock. With no stock left the last cost price stands.
+func (c stockCosting) refreshFIFOCost(tx *sql.Tx, productID int) error {
+	_, err := tx.Exec(`
+		UPDATE product SET cost_price = l.unit_cost
+		FROM (
+			SELECT unit_cost FROM cost_layers WHERE product_id = $1 AND remaining > 0 ORDER BY id LIMIT 1
+		) l
+		WHERE id = $1`, productID)
+	return err
+}
+
+// checkPrecision rejects a quantity finer than the product is sold in, such
+// as half of an item sold by the piece.
+func checkPrecision(productName string, precision int, qty quantity.Quantity) error {
+	if qty.Places() > precision {
+		return fmt.Errorf("%w: %s is sold in steps of %d decimal places, not %s",
+			models.ErrInvalidQuantity, productName, precision, qty)
+	}
+	return nil
+}
+
+// AdjustStock changes a product's stock by hand, such as writing off damaged
+// goods or moving stock to another store. Stock cannot be taken below zero.
+func (repo *productRepository) AdjustStock(id int, req models.StockAdjustmentRequest) (*models.StockMovement, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var name, productType string
+	var precision int
+	var stock quantity.Quantity
+	err = tx.QueryRow("SELECT name, type, quantity_precision, stock FROM product WHERE id = $1 FOR UPDATE", id).
+		Scan(&name, &productType, &precision, &stock)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if productType == models.ProductTypeBundle {
+		return nil, fmt.Errorf("%w: %s is a bundle; adjust its components instead", models.ErrInvalidStockAdjustment, name)
+	}
+	if err := checkPrecision(name, precision, req.Quantity); err != nil {
+		return nil, err
+	}
+	if stock+req.Quantity < 0 {
+		return nil, fmt.Errorf("%w: %s has only %s in stock", models.ErrInvalidStockAdjustment, name, stock)
+	}
+
+	movement := &models.StockMovement{
+		ProductID:   id,
+		Type:        req.Type,
+		Quantity:    req.Quantity,
+		Reason:      req.Reason,
+		PerformedBy: req.PerformedBy,
+	}
+	if err := repo.costing.moveStock(tx, movement); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return movement, nil
+}
+
+// GetMovements returns a product's stock ledger, newest movement first.
+func (repo *productRepository) GetMovements(id int) ([]models.StockMovement, error) {
+	var exists bool
+	if err := repo.db.QueryRow("SELECT EXISTS (SELECT 1 FROM product WHERE id = $1)", id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, models.ErrProductNotFound
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT id, product_id, product_name, type, quantity, stock_after, unit_cost, value, COALESCE(reason, ''),
+			COALESCE(performed_by, ''),
+			COALESCE(transaction_id, 0), COALESCE(return_id, 0), COALESCE(goods_receipt_id, 0), created_at
+		FROM stock_movements
+		WHERE product_id = $1
+		ORDER BY id DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := make([]models.StockMovement, 0)
+	for rows.Next() {
+		var m models.StockMovement
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.ProductName, &m.Type, &m.Quantity, &m.StockAfter, &m.UnitCost,
+			&m.Value, &m.Reason, &m.PerformedBy, &m.TransactionID, &m.ReturnID, &m.GoodsReceiptID,
+			&m.CreatedAt); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// FindStockDrift lists the products whose stock differs from the sum of
+// their ledger, which only happens when stock was written around the
+// ledger, such as by hand in the database.
+func (repo *productRepository) FindStockDrift() ([]models.StockDrift, error) {
+	rows, err := repo.db.Query(`
+		SELECT p.id, p.name, p.stock, COALESCE(SUM(m.quantity), 0)
+		FROM product p
+		LEFT JOIN stock_movements m ON m.product_id = p.id
+		GROUP BY p.id
+		HAVING p.stock <> COALESCE(SUM(m.quantity), 0)
+		ORDER BY p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drifts := make([]models.StockDrift, 0)
+	for rows.Next() {
+		var d models.StockDrift
+		if err := rows.Scan(&d.ProductID, &d.ProductName, &d.Stock, &d.LedgerStock); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	return drifts, rows.Err()
+}
+
+// GetLowStock lists the products at or below their reorder point.
+func (repo *productRepository) GetLowStock(opts models.ReorderOptions) ([]models.LowStockProduct, error) {
+	return findLowStock(repo.db, opts)
+}
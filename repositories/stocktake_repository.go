@@ -0,0 +1,436 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"database/sql"
+	"fmt"
+)
+
+type StocktakeRepositoryInput interface {
+	GetAll(status string) ([]models.Stocktake, error)
+	Open(req models.OpenStocktakeRequest) (*models.Stocktake, error)
+	GetByID(id int) (*models.Stocktake, error)
+	AddCount(id int, req models.StocktakeCountRequest) (*models.StocktakeLine, error)
+	Post(id int, req models.PostStocktakeRequest) (*models.Stocktake, error)
+	Cancel(id int, req models.CancelStocktakeRequest) (*models.Stocktake, error)
+}
+
+type stocktakeRepository struct {
+	db           *sql.DB
+	roundingMode money.RoundingMode
+	costing      stockCosting
+}
+
+// NewStocktakeRepository values variances with roundingMode and costs the
+// stock it posts with costingMethod.
+func NewStocktakeRepository(db *sql.DB, roundingMode money.RoundingMode, costingMethod models.CostingMethod) StocktakeRepositoryInput {
+	return &stocktakeRepository{
+		db:           db,
+		roundingMode: roundingMode,
+		costing:      stockCosting{method: costingMethod, rounding: roundingMode},
+	}
+}
+
+const stocktakeColumns = `id, COALESCE(category_id, 0), COALESCE(category_name, ''), status, COALESCE(note, ''),
+	opened_by, opened_at, COALESCE(closed_by, ''), closed_at`
+
+func scanStocktake(row rowScanner, s *models.Stocktake) error {
+	var closedAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.CategoryID, &s.CategoryName, &s.Status, &s.Note, &s.OpenedBy, &s.OpenedAt,
+		&s.ClosedBy, &closedAt); err != nil {
+		return err
+	}
+	if closedAt.Valid {
+		s.ClosedAt = &closedAt.Time
+	}
+	return nil
+}
+
+// lockStocktake takes a lock on an open stocktake: shared for adding counts,
+// exclusive for posting or cancelling, so no count slips in after either.
+func lockStocktake(tx *sql.Tx, id int, exclusive bool) error {
+	lock := "FOR SHARE"
+	if exclusive {
+		lock = "FOR UPDATE"
+	}
+	var status string
+	err := tx.QueryRow("SELECT status FROM stocktakes WHERE id = $1 "+lock, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return models.ErrStocktakeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.StocktakeStatusOpen {
+		return models.ErrStocktakeClosed
+	}
+	return nil
+}
+
+func (repo *stocktakeRepository) GetAll(status string) ([]models.Stocktake, error) {
+	query := "SELECT " + stocktakeColumns + " FROM stocktakes"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY opened_at DESC, id DESC"
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stocktakes := make([]models.Stocktake, 0)
+	for rows.Next() {
+		var s models.Stocktake
+		if err := scanStocktake(rows, &s); err != nil {
+			return nil, err
+		}
+		stocktakes = append(stocktakes, s)
+	}
+
+	return stocktakes, rows.Err()
+}
+
+// Open starts a stocktake over every standard product, or those in one
+// category, and snapshots their expected stock and cost. The products are
+// share locked in ID order, as checkout locks them, so the snapshot waits
+// for sales in flight and none lands half in it. Parents with variants hold
+// no stock of their own and bundles are counted through their components, so
+// neither is included. A product can only be in one open stocktake at a
+// time; the table lock makes concurrent opens take turns checking that.
+func (repo *stocktakeRepository) Open(req models.OpenStocktakeRequest) (*models.Stocktake, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("LOCK TABLE stocktakes IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+
+	var categoryName string
+	if req.CategoryID != 0 {
+		err := tx.QueryRow("SELECT name FROM category WHERE id = $1", req.CategoryID).Scan(&categoryName)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: category %d not found", models.ErrInvalidStocktake, req.CategoryID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO stocktakes (category_id, category_name, note, opened_by)
+		VALUES (NULLIF($1, 0), NULLIF($2, ''), NULLIF($3, ''), $4)
+		RETURNING id`,
+		req.CategoryID, categoryName, req.Note, req.OpenedBy).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO stocktake_lines (stocktake_id, product_id, product_name, unit, unit_cost, expected)
+		SELECT $1, p.id, p.name, p.unit, p.cost_price, p.stock
+		FROM product p
+		WHERE p.type = 'standard'
+			AND NOT EXISTS (SELECT 1 FROM product v WHERE v.parent_id = p.id)
+			AND ($2 = 0 OR p.category_id = $2)
+		ORDER BY p.id
+		FOR SHARE OF p`,
+		id, req.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if lines == 0 {
+		return nil, fmt.Errorf("%w: there are no products to count", models.ErrInvalidStocktake)
+	}
+
+	var otherID int
+	var productName string
+	err = tx.QueryRow(`
+		SELECT other.stocktake_id, mine.product_name
+		FROM stocktake_lines mine
+		JOIN stocktake_lines other ON other.product_id = mine.product_id AND other.stocktake_id <> mine.stocktake_id
+		JOIN stocktakes s ON s.id = other.stocktake_id
+		WHERE mine.stocktake_id = $1 AND s.status = 'open'
+		ORDER BY mine.product_id
+		LIMIT 1`, id).Scan(&otherID, &productName)
+	if err == nil {
+		return nil, fmt.Errorf("%w: %s is in open stocktake %d", models.ErrStocktakeOverlap, productName, otherID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// GetByID returns the stocktake with every line and its variance so far.
+func (repo *stocktakeRepository) GetByID(id int) (*models.Stocktake, error) {
+	var s models.Stocktake
+	err := scanStocktake(repo.db.QueryRow("SELECT "+stocktakeColumns+" FROM stocktakes WHERE id = $1", id), &s)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrStocktakeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Lines, err = repo.loadLines(repo.db, id, 0); err != nil {
+		return nil, err
+	}
+	totals := models.StocktakeTotals{Products: len(s.Lines)}
+	for _, l := range s.Lines {
+		if l.Counted != nil {
+			totals.Counted++
+			totals.VarianceValue = totals.VarianceValue.Add(l.VarianceValue)
+		}
+	}
+	s.Totals = &totals
+	return &s, nil
+}
+
+// loadLines reads the lines of a stocktake, or only productID's when it is
+// not zero, with their counts and variances.
+func (repo *stocktakeRepository) loadLines(q queryer, id, productID int) ([]models.StocktakeLine, error) {
+	rows, err := q.Query(`
+		SELECT l.product_id, l.product_name, l.unit, l.unit_cost, l.expected, c.counted,
+			COALESCE(latest.stock_at_count, l.expected)
+		FROM stocktake_lines l
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity) AS counted
+			FROM stocktake_counts
+			WHERE stocktake_id = $1
+			GROUP BY product_id
+		) c ON c.product_id = l.product_id
+		LEFT JOIN LATERAL (
+			SELECT stock_at_count FROM stocktake_counts
+			WHERE stocktake_id = l.stocktake_id AND product_id = l.product_id
+			ORDER BY counted_at DESC
+			LIMIT 1
+		) latest ON true
+		WHERE l.stocktake_id = $1 AND ($2 = 0 OR l.product_id = $2)
+		ORDER BY l.product_name, l.product_id`, id, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]models.StocktakeLine, 0)
+	index := make(map[int]int)
+	for rows.Next() {
+		var l models.StocktakeLine
+		var counted sql.NullString
+		if err := rows.Scan(&l.ProductID, &l.ProductName, &l.Unit, &l.UnitCost, &l.Expected, &counted,
+			&l.ExpectedAtCount); err != nil {
+			return nil, err
+		}
+		if counted.Valid {
+			l.Counted = new(quantity.Quantity)
+			if err := l.Counted.Scan(counted.String); err != nil {
+				return nil, err
+			}
+			l.Variance = *l.Counted - l.ExpectedAtCount
+		}
+		l.VarianceValue = l.Variance.Price(l.UnitCost, repo.roundingMode)
+		index[l.ProductID] = len(lines)
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	countRows, err := q.Query(`
+		SELECT product_id, counted_by, quantity, counted_at
+		FROM stocktake_counts
+		WHERE stocktake_id = $1 AND ($2 = 0 OR product_id = $2)
+		ORDER BY counted_at, counted_by`, id, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer countRows.Close()
+
+	for countRows.Next() {
+		var productID int
+		var c models.StocktakeCount
+		if err := countRows.Scan(&productID, &c.CountedBy, &c.Quantity, &c.CountedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[productID]; ok {
+			lines[i].Counts = append(lines[i].Counts, c)
+		}
+	}
+
+	return lines, countRows.Err()
+}
+
+// AddCount records one counter's count of a product with its stock at the
+// time, so sales made before the count are allowed for. The product row is
+// locked as checkout locks it, so no sale is in flight while its stock is
+// read, and counts of the same product take turns, so counted_at orders
+// them.
+func (repo *stocktakeRepository) AddCount(id int, req models.StocktakeCountRequest) (*models.StocktakeLine, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockStocktake(tx, id, false); err != nil {
+		return nil, err
+	}
+
+	var name string
+	var precision int
+	err = tx.QueryRow(`
+		SELECT l.product_name, p.quantity_precision
+		FROM stocktake_lines l JOIN product p ON p.id = l.product_id
+		WHERE l.stocktake_id = $1 AND l.product_id = $2`, id, req.ProductID).Scan(&name, &precision)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: product %d is not part of this stocktake", models.ErrInvalidStocktake, req.ProductID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPrecision(name, precision, req.Quantity); err != nil {
+		return nil, err
+	}
+
+	var stock quantity.Quantity
+	err = tx.QueryRow("SELECT stock FROM product WHERE id = $1 FOR UPDATE", req.ProductID).Scan(&stock)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO stocktake_counts (stocktake_id, product_id, counted_by, quantity, stock_at_count, counted_at)
+		VALUES ($1, $2, $3, $4, $5, clock_timestamp())
+		ON CONFLICT (stocktake_id, product_id, counted_by)
+		DO UPDATE SET quantity = EXCLUDED.quantity, stock_at_count = EXCLUDED.stock_at_count,
+			counted_at = EXCLUDED.counted_at`,
+		id, req.ProductID, req.CountedBy, req.Quantity, stock)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := repo.loadLines(tx, id, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &lines[0], nil
+}
+
+// Post applies every counted line's variance to stock as a stocktake
+// movement, all in one transaction. The products are locked in ID order, as
+// checkout does, so the variances are worked out against a ledger no sale
+// can move until the stocktake is posted.
+func (repo *stocktakeRepository) Post(id int, req models.PostStocktakeRequest) (*models.Stocktake, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockStocktake(tx, id, true); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id FROM product
+		WHERE id IN (SELECT product_id FROM stocktake_lines WHERE stocktake_id = $1)
+		ORDER BY id
+		FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if req.ZeroUncounted {
+		_, err = tx.Exec(`
+			INSERT INTO stocktake_counts (stocktake_id, product_id, counted_by, quantity, stock_at_count, counted_at)
+			SELECT l.stocktake_id, l.product_id, $2, 0, p.stock, clock_timestamp()
+			FROM stocktake_lines l JOIN product p ON p.id = l.product_id
+			WHERE l.stocktake_id = $1
+				AND NOT EXISTS (SELECT 1 FROM stocktake_counts c WHERE c.stocktake_id = l.stocktake_id AND c.product_id = l.product_id)`,
+			id, req.PostedBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lines, err := repo.loadLines(tx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if l.Counted == nil || l.Variance == 0 {
+			continue
+		}
+		err := repo.costing.moveStock(tx, &models.StockMovement{
+			ProductID:   l.ProductID,
+			Type:        models.StockMovementStocktake,
+			Quantity:    l.Variance,
+			Reason:      fmt.Sprintf("stocktake %d", id),
+			PerformedBy: req.PostedBy,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE stocktakes SET status = $1, closed_by = $2, closed_at = NOW() WHERE id = $3",
+		models.StocktakeStatusPosted, req.PostedBy, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// Cancel closes a stocktake without touching stock.
+func (repo *stocktakeRepository) Cancel(id int, req models.CancelStocktakeRequest) (*models.Stocktake, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockStocktake(tx, id, true); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("UPDATE stocktakes SET status = $1, closed_by = $2, closed_at = NOW() WHERE id = $3",
+		models.StocktakeStatusCancelled, req.CancelledBy, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+type SupplierRepositoryInput interface {
+	GetAll(search string) ([]models.Supplier, error)
+	Create(supplier *models.Supplier) error
+	GetByID(id int) (*models.Supplier, error)
+	Update(supplier *models.Supplier) error
+	Delete(id int) error
+}
+
+type supplierRepository struct {
+	db *sql.DB
+}
+
+func NewSupplierRepository(db *sql.DB) SupplierRepositoryInput {
+	return &supplierRepository{db: db}
+}
+
+const supplierColumns = `id, name, COALESCE(contact_name, ''), COALESCE(phone, ''), COALESCE(email, ''),
+	COALESCE(address, ''), created_at`
+
+func scanSupplier(row rowScanner, s *models.Supplier) error {
+	return row.Scan(&s.ID, &s.Name, &s.ContactName, &s.Phone, &s.Email, &s.Address, &s.CreatedAt)
+}
+
+// GetAll lists suppliers by name, narrowed by search to any part of a name.
+func (repo *supplierRepository) GetAll(search string) ([]models.Supplier, error) {
+	query := "SELECT " + supplierColumns + " FROM suppliers"
+	args := []interface{}{}
+	if search != "" {
+		query += " WHERE name ILIKE '%' || $1 || '%'"
+		args = append(args, search)
+	}
+	query += " ORDER BY name, id"
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppliers := make([]models.Supplier, 0)
+	for rows.Next() {
+		var s models.Supplier
+		if err := scanSupplier(rows, &s); err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, s)
+	}
+
+	return suppliers, rows.Err()
+}
+
+func (repo *supplierRepository) Create(s *models.Supplier) error {
+	query := `
+		INSERT INTO suppliers (name, contact_name, phone, email, address)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''))
+		RETURNING id, created_at`
+	return repo.db.QueryRow(query, s.Name, s.ContactName, s.Phone, s.Email, s.Address).Scan(&s.ID, &s.CreatedAt)
+}
+
+func (repo *supplierRepository) GetByID(id int) (*models.Supplier, error) {
+	var s models.Supplier
+	err := scanSupplier(repo.db.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE id = $1", id), &s)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrSupplierNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (repo *supplierRepository) Update(s *models.Supplier) error {
+	query := `
+		UPDATE suppliers SET name = $1, contact_name = NULLIF($2, ''), phone = NULLIF($3, ''), email = NULLIF($4, ''),
+			address = NULLIF($5, '')
+		WHERE id = $6
+		RETURNING created_at`
+	err := repo.db.QueryRow(query, s.Name, s.ContactName, s.Phone, s.Email, s.Address, s.ID).Scan(&s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return models.ErrSupplierNotFound
+	}
+	return err
+}
+
+// Delete removes a supplier no purchase order was ever raised with.
+func (repo *supplierRepository) Delete(id int) error {
+	result, err := repo.db.Exec("DELETE FROM suppliers WHERE id = $1", id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return models.ErrSupplierInUse
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return models.ErrSupplierNotFound
+	}
+
+	return nil
+}
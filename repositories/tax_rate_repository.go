@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TaxRateRepositoryInput interface {
+	GetAll() ([]models.TaxRate, error)
+	Create(req models.TaxRateRequest) (*models.TaxRate, error)
+	GetByID(id int) (*models.TaxRate, error)
+	AddPeriod(id int, req models.TaxRateRequest) (*models.TaxRatePeriod, error)
+}
+
+type taxRateRepository struct {
+	db *sql.DB
+}
+
+func NewTaxRateRepository(db *sql.DB) TaxRateRepositoryInput {
+	return &taxRateRepository{db: db}
+}
+
+// currentTaxRateQuery picks the period in effect now for each tax rate.
+const currentTaxRateQuery = `
+	SELECT tr.id, tr.code, tr.name, COALESCE((
+		SELECT trp.rate_bps FROM tax_rate_periods trp
+		WHERE trp.tax_rate_id = tr.id AND trp.effective_from <= NOW()
+		ORDER BY trp.effective_from DESC
+		LIMIT 1
+	), 0)
+	FROM tax_rates tr
+`
+
+func (repo *taxRateRepository) GetAll() ([]models.TaxRate, error) {
+	rows, err := repo.db.Query(currentTaxRateQuery + " ORDER BY tr.code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]models.TaxRate, 0)
+	for rows.Next() {
+		var r models.TaxRate
+		if err := rows.Scan(&r.ID, &r.Code, &r.Name, &r.Rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+func (repo *taxRateRepository) Create(req models.TaxRateRequest) (*models.TaxRate, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow("INSERT INTO tax_rates (code, name) VALUES ($1, $2) RETURNING id", req.Code, req.Name).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, fmt.Errorf("%w: code %s is already in use", models.ErrInvalidTaxRate, req.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO tax_rate_periods (tax_rate_id, rate_bps, effective_from)
+		VALUES ($1, $2, COALESCE($3, NOW()))`,
+		id, req.Rate, nullTime(req.EffectiveFrom))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+func (repo *taxRateRepository) GetByID(id int) (*models.TaxRate, error) {
+	var r models.TaxRate
+	err := repo.db.QueryRow(currentTaxRateQuery+" WHERE tr.id = $1", id).Scan(&r.ID, &r.Code, &r.Name, &r.Rate)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTaxRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT id, tax_rate_id, rate_bps, effective_from
+		FROM tax_rate_periods
+		WHERE tax_rate_id = $1
+		ORDER BY effective_from`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r.Periods = make([]models.TaxRatePeriod, 0)
+	for rows.Next() {
+		var p models.TaxRatePeriod
+		if err := rows.Scan(&p.ID, &p.TaxRateID, &p.Rate, &p.EffectiveFrom); err != nil {
+			return nil, err
+		}
+		r.Periods = append(r.Periods, p)
+	}
+
+	return &r, rows.Err()
+}
+
+// AddPeriod schedules a new percentage for a tax rate. Sales already recorded
+// keep the rate copied onto their lines.
+func (repo *taxRateRepository) AddPeriod(id int, req models.TaxRateRequest) (*models.TaxRatePeriod, error) {
+	p := &models.TaxRatePeriod{TaxRateID: id, Rate: req.Rate}
+	err := repo.db.QueryRow(`
+		INSERT INTO tax_rate_periods (tax_rate_id, rate_bps, effective_from)
+		SELECT id, $2, COALESCE($3, NOW()) FROM tax_rates WHERE id = $1
+		RETURNING id, effective_from`,
+		id, req.Rate, nullTime(req.EffectiveFrom)).Scan(&p.ID, &p.EffectiveFrom)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTaxRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// nullTime maps the zero time to NULL so the database can supply a default.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
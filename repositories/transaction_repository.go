@@ -2,85 +2,388 @@ package repositories
 
 import (
 	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/tax"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type TransactionRepositoryInput interface {
-	CreateTransaction(items []models.CheckoutItem) (*models.Transaction, error)
+	CreateTransaction(req models.CheckoutRequest, opts models.CheckoutOptions) (*models.Transaction, error)
+	PreviewTransaction(req models.CheckoutRequest) (*models.CheckoutPreview, error)
+	GetAll(filter models.TransactionFilter) (*models.TransactionPage, error)
+	GetByID(id int) (*models.Transaction, error)
+	VoidTransaction(id int, req models.ReversalRequest) (*models.Transaction, error)
+	RefundTransaction(id int, req models.ReversalRequest) (*models.TransactionReturn, error)
+	CreateReturn(id int, req models.ReturnRequest) (*models.TransactionReturn, error)
 }
 
 type TransactionRepository struct {
 	db *sql.DB
+	// roundingMode is used wherever an amount has to be split, such as
+	// refunding part of a line.
+	roundingMode money.RoundingMode
+	// cashRounding is applied to the part of a sale paid in cash.
+	cashRounding money.Rounding
+	costing      stockCosting
+	taxEngine    tax.Engine
+	numbering    models.ReceiptNumbering
+	periodFormat string
+	loyalty      models.LoyaltyRules
 }
 
-func NewTransactionRepository(db *sql.DB) TransactionRepositoryInput {
-	return &TransactionRepository{db: db}
-}
-
-func (repo *TransactionRepository) CreateTransaction(items []models.CheckoutItem) (*models.Transaction, error) {
-	tx, err := repo.db.Begin()
+func NewTransactionRepository(db *sql.DB, roundingMode money.RoundingMode, cashRounding money.Rounding,
+	costingMethod models.CostingMethod, taxEngine tax.Engine, numbering models.ReceiptNumbering,
+	loyalty models.LoyaltyRules) (TransactionRepositoryInput, error) {
+	periodFormat, err := numbering.PeriodFormat()
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	if err := loyalty.Validate(); err != nil {
+		return nil, err
+	}
+	return &TransactionRepository{
+		db:           db,
+		roundingMode: roundingMode,
+		cashRounding: cashRounding,
+		costing:      stockCosting{method: costingMethod, rounding: roundingMode},
+		taxEngine:    taxEngine,
+		numbering:    numbering,
+		periodFormat: periodFormat,
+		loyalty:      loyalty,
+	}, nil
+}
 
-	totalAmount := 0
-	details := make([]models.TransactionDetail, 0)
+// GetAll lists transactions newest first. Pagination is keyset based: the
+// cursor encodes the (created_at, id) of the last row on the previous page.
+func (repo *TransactionRepository) GetAll(filter models.TransactionFilter) (*models.TransactionPage, error) {
+	query := `SELECT ` + transactionColumns + ` FROM "transaction" t`
+	conditions := []string{}
+	args := []interface{}{}
 
-	for _, item := range items {
-		var productPrice float64
-		var stock int
-		var productName string
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
 
-		err := tx.QueryRow("SELECT name, price, stock FROM product WHERE id = $1", item.ProductID).Scan(&productName, &productPrice, &stock)
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product id %d not found", item.ProductID)
-		}
+	if filter.StartDate != "" {
+		addCondition("t.created_at >= ?::date", filter.StartDate)
+	}
+	if filter.EndDate != "" {
+		addCondition("t.created_at < ?::date + 1", filter.EndDate)
+	}
+	if filter.MinTotal != nil {
+		addCondition("t.total_amount >= ?", *filter.MinTotal)
+	}
+	if filter.MaxTotal != nil {
+		addCondition("t.total_amount <= ?", *filter.MaxTotal)
+	}
+	if filter.ReceiptNumber != "" {
+		addCondition("left(t.receipt_number, length(?::text)) = ?", filter.ReceiptNumber)
+	}
+	if filter.CustomerID != 0 {
+		addCondition("t.customer_id = ?", filter.CustomerID)
+	}
+	if filter.ProductID != 0 {
+		addCondition("EXISTS (SELECT 1 FROM transaction_details td WHERE td.transaction_id = t.id AND td.product_id = ?)", filter.ProductID)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeTransactionCursor(filter.Cursor)
 		if err != nil {
 			return nil, err
 		}
+		args = append(args, createdAt, id)
+		conditions = append(conditions, fmt.Sprintf("(t.created_at, t.id) < ($%d::timestamp, $%d)", len(args)-1, len(args)))
+	}
 
-		subtotal := int(productPrice * float64(item.Quantity))
-		totalAmount += subtotal
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit+1)
+	query += fmt.Sprintf(" ORDER BY t.created_at DESC, t.id DESC LIMIT $%d", len(args))
 
-		_, err = tx.Exec("UPDATE product SET stock = stock - $1 WHERE id = $2", item.Quantity, item.ProductID)
-		if err != nil {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]models.Transaction, 0)
+	for rows.Next() {
+		var t models.Transaction
+		if err := scanTransaction(rows, &t); err != nil {
 			return nil, err
 		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		details = append(details, models.TransactionDetail{
-			ProductID:   item.ProductID,
-			ProductName: productName,
-			Quantity:    item.Quantity,
-			Subtotal:    subtotal,
-		})
+	page := &models.TransactionPage{Data: transactions}
+	if len(transactions) > filter.Limit {
+		page.Data = transactions[:filter.Limit]
+		last := page.Data[len(page.Data)-1]
+		page.NextCursor = encodeTransactionCursor(last.CreatedAt, last.ID)
 	}
 
-	var transactionID int
-	err = tx.QueryRow(`INSERT INTO "transaction" (total_amount) VALUES ($1) RETURNING id`, totalAmount).Scan(&transactionID)
+	if err := repo.loadDetails(page.Data); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (repo *TransactionRepository) GetByID(id int) (*models.Transaction, error) {
+	var t models.Transaction
+	err := scanTransaction(repo.db.QueryRow(`SELECT `+transactionColumns+` FROM "transaction" t WHERE t.id = $1`, id), &t)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTransactionNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	for i := range details {
-		details[i].TransactionID = transactionID
-		_, err = tx.Exec("INSERT INTO transaction_details (transaction_id, product_id, quantity, subtotal) VALUES ($1, $2, $3, $4)",
-			transactionID, details[i].ProductID, details[i].Quantity, details[i].Subtotal)
-		if err != nil {
-			return nil, err
+	transactions := []models.Transaction{t}
+	if err := repo.loadDetails(transactions); err != nil {
+		return nil, err
+	}
+
+	return &transactions[0], nil
+}
+
+const transactionColumns = `t.id, COALESCE(t.receipt_number, ''), COALESCE(t.shift_id, 0), COALESCE(t.customer_id, 0),
+	t.total_amount, t.currency, t.tax_amount, t.tax_inclusive, t.discount_amount, t.change_amount, t.cash_rounding,
+	t.status, t.created_at, t.voided_at, COALESCE(t.void_reason, ''), COALESCE(t.voided_by, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransaction(row rowScanner, t *models.Transaction) error {
+	var voidedAt sql.NullTime
+	var totalAmount, taxAmount, discountAmount, changeAmount, cashRounding int64
+	err := row.Scan(&t.ID, &t.ReceiptNumber, &t.ShiftID, &t.CustomerID, &totalAmount, &t.Currency, &taxAmount,
+		&t.TaxInclusive, &discountAmount, &changeAmount, &cashRounding, &t.Status, &t.CreatedAt, &voidedAt, &t.VoidReason,
+		&t.VoidedBy)
+	if err != nil {
+		return err
+	}
+	t.TotalAmount = money.New(totalAmount, t.Currency)
+	t.TaxAmount = money.New(taxAmount, t.Currency)
+	t.DiscountAmount = money.New(discountAmount, t.Currency)
+	t.ChangeAmount = money.New(changeAmount, t.Currency)
+	t.CashRounding = money.New(cashRounding, t.Currency)
+	if voidedAt.Valid {
+		t.VoidedAt = &voidedAt.Time
+	}
+	return nil
+}
+
+// loadDetails fills Details, Payments and points for every transaction.
+func (repo *TransactionRepository) loadDetails(transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(transactions))
+	index := make(map[int]int, len(transactions))
+	for i := range transactions {
+		ids[i] = int64(transactions[i].ID)
+		index[transactions[i].ID] = i
+		transactions[i].Details = make([]models.TransactionDetail, 0)
+	}
+
+	query := `
+		SELECT td.id, td.transaction_id, COALESCE(td.product_id, 0), td.product_name, td.unit_price,
+			COALESCE(td.category_id, 0), COALESCE(td.category_name, ''), COALESCE(td.sku, ''), td.quantity, td.subtotal,
+			td.discount_amount, COALESCE(td.tax_rate_id, 0), COALESCE(td.tax_code, ''), td.tax_rate_bps, td.tax_amount,
+			td.total_amount,
+			COALESCE((SELECT SUM(ri.quantity) FROM transaction_return_items ri WHERE ri.detail_id = td.id), 0),
+			COALESCE(td.parent_product_id, 0), COALESCE(td.parent_product_name, ''), td.unit, td.cost_amount
+		FROM transaction_details td
+		WHERE td.transaction_id = ANY($1)
+		ORDER BY td.id
+	`
+	rows, err := repo.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.TransactionDetail
+		if err := rows.Scan(&d.ID, &d.TransactionID, &d.ProductID, &d.ProductName, &d.UnitPrice,
+			&d.CategoryID, &d.CategoryName, &d.SKU, &d.Quantity, &d.Subtotal,
+			&d.DiscountAmount, &d.TaxRateID, &d.TaxCode, &d.TaxRate, &d.TaxAmount, &d.TotalAmount, &d.ReturnedQuantity,
+			&d.ParentProductID, &d.ParentProductName, &d.Unit, &d.CostAmount); err != nil {
+			return err
 		}
+		i := index[d.TransactionID]
+		transactions[i].Details = append(transactions[i].Details, d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	if err := repo.loadDiscounts(transactions, ids); err != nil {
+		return err
+	}
+	if err := repo.loadComponents(transactions, ids); err != nil {
+		return err
+	}
+	if err := repo.loadPayments(transactions, ids); err != nil {
+		return err
+	}
+	if err := repo.loadPoints(transactions, ids); err != nil {
+		return err
 	}
 
-	return &models.Transaction{
-		ID:          transactionID,
-		TotalAmount: totalAmount,
-		CreatedAt:   time.Now().UTC(),
-		Details:     details,
-	}, nil
+	for i := range transactions {
+		transactions[i].TaxSummary = summarizeTax(transactions[i].Details)
+	}
+
+	return nil
+}
+
+// loadDiscounts attaches the promotions applied to each detail line.
+func (repo *TransactionRepository) loadDiscounts(transactions []models.Transaction, ids []int64) error {
+	lines := make(map[int]*models.TransactionDetail)
+	for i := range transactions {
+		for j := range transactions[i].Details {
+			d := &transactions[i].Details[j]
+			d.Discounts = make([]models.AppliedDiscount, 0)
+			lines[d.ID] = d
+		}
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT detail_id, COALESCE(promotion_id, 0), promotion_name, level, amount
+		FROM transaction_discounts
+		WHERE transaction_id = ANY($1)
+		ORDER BY id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detailID int
+		var discount models.AppliedDiscount
+		if err := rows.Scan(&detailID, &discount.PromotionID, &discount.PromotionName, &discount.Level, &discount.Amount); err != nil {
+			return err
+		}
+		if d, ok := lines[detailID]; ok {
+			d.Discounts = append(d.Discounts, discount)
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadComponents attaches to bundle lines what each bundle was made of.
+func (repo *TransactionRepository) loadComponents(transactions []models.Transaction, ids []int64) error {
+	lines := make(map[int]*models.TransactionDetail)
+	for i := range transactions {
+		for j := range transactions[i].Details {
+			lines[transactions[i].Details[j].ID] = &transactions[i].Details[j]
+		}
+	}
+
+	rows, err := repo.db.Query(`
+		SELECT dc.detail_id, COALESCE(dc.product_id, 0), dc.product_name, dc.quantity, dc.unit_price
+		FROM transaction_detail_components dc
+		JOIN transaction_details td ON td.id = dc.detail_id
+		WHERE td.transaction_id = ANY($1)
+		ORDER BY dc.id`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detailID int
+		var c models.DetailComponent
+		if err := rows.Scan(&detailID, &c.ProductID, &c.ProductName, &c.Quantity, &c.UnitPrice); err != nil {
+			return err
+		}
+		if d, ok := lines[detailID]; ok {
+			d.Components = append(d.Components, c)
+		}
+	}
+
+	return rows.Err()
+}
+
+// summarizeTax totals taxable amount and tax per rate over taxed lines.
+func summarizeTax(details []models.TransactionDetail) []models.TaxSummaryLine {
+	summary := make([]models.TaxSummaryLine, 0)
+	for _, d := range details {
+		if d.TaxCode == "" {
+			continue
+		}
+
+		taxable := d.TotalAmount.Sub(d.TaxAmount)
+		found := false
+		for i := range summary {
+			if summary[i].TaxCode == d.TaxCode && summary[i].Rate == d.TaxRate {
+				summary[i].TaxableAmount = summary[i].TaxableAmount.Add(taxable)
+				summary[i].TaxAmount = summary[i].TaxAmount.Add(d.TaxAmount)
+				found = true
+				break
+			}
+		}
+		if !found {
+			summary = append(summary, models.TaxSummaryLine{
+				TaxCode:       d.TaxCode,
+				Rate:          d.TaxRate,
+				TaxableAmount: taxable,
+				TaxAmount:     d.TaxAmount,
+			})
+		}
+	}
+
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].TaxCode != summary[j].TaxCode {
+			return summary[i].TaxCode < summary[j].TaxCode
+		}
+		return summary[i].Rate < summary[j].Rate
+	})
+
+	return summary
+}
+
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+func encodeTransactionCursor(createdAt time.Time, id int) string {
+	raw := createdAt.Format(cursorTimeLayout) + "|" + strconv.Itoa(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTransactionCursor(cursor string) (string, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, models.ErrInvalidCursor
+	}
+
+	createdAt, idStr, found := strings.Cut(string(raw), "|")
+	if !found {
+		return "", 0, models.ErrInvalidCursor
+	}
+	if _, err := time.Parse(cursorTimeLayout, createdAt); err != nil {
+		return "", 0, models.ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return "", 0, models.ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
 }
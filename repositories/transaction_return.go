@@ -0,0 +1,370 @@
+package repositories
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/quantity"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// VoidTransaction cancels a sale made earlier the same day and puts its items
+// back into stock. The row lock on the transaction makes a second void wait
+// and then fail the status check. A sale rung up on a shift can only be voided
+// while that shift is open, since the money goes back out of its drawer. Any
+// loyalty points the sale earned or spent are reversed, and gift card tenders
+// go back onto their cards.
+func (repo *TransactionRepository) VoidTransaction(id int, req models.ReversalRequest) (*models.Transaction, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var sameDay bool
+	var shiftID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT status, created_at::date = CURRENT_DATE, shift_id FROM "transaction" WHERE id = $1 FOR UPDATE`, id).
+		Scan(&status, &sameDay, &shiftID)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != models.TransactionStatusCompleted || !sameDay {
+		return nil, models.ErrTransactionNotVoidable
+	}
+	if shiftID.Valid {
+		if err := requireOpenShift(tx, int(shiftID.Int64)); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, err := loadReturnableLines(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	restocks := make(map[int]quantity.Quantity)
+	for _, line := range lines {
+		line.restock(restocks, line.quantity)
+	}
+	err = repo.costing.restockProducts(tx, restocks, models.StockMovement{
+		TransactionID: id,
+		Reason:        "void: " + req.Reason,
+		PerformedBy:   req.PerformedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE "transaction" SET status = $1, voided_at = NOW(), void_reason = $2, voided_by = $3 WHERE id = $4`,
+		models.TransactionStatusVoided, req.Reason, req.PerformedBy, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reversePoints(tx, id, 0); err != nil {
+		return nil, err
+	}
+	if err := restoreGiftCards(tx, id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// RefundTransaction refunds everything on a sale that has not been returned
+// yet, restocking every line.
+func (repo *TransactionRepository) RefundTransaction(id int, req models.ReversalRequest) (*models.TransactionReturn, error) {
+	return repo.createReturn(id, models.ReturnRequest{
+		Reason:       req.Reason,
+		PerformedBy:  req.PerformedBy,
+		ShiftID:      req.ShiftID,
+		GiftCardCode: req.GiftCardCode,
+	})
+}
+
+// CreateReturn records a partial return against individual transaction lines.
+func (repo *TransactionRepository) CreateReturn(id int, req models.ReturnRequest) (*models.TransactionReturn, error) {
+	return repo.createReturn(id, req)
+}
+
+type returnableLine struct {
+	detailID       int
+	productID      int
+	quantity       quantity.Quantity
+	total          money.Money
+	tax            money.Money
+	returnedQty    quantity.Quantity
+	refundedAmount money.Money
+	refundedTax    money.Money
+	components     []models.DetailComponent
+}
+
+func (l returnableLine) remaining() quantity.Quantity {
+	return l.quantity - l.returnedQty
+}
+
+// restock adds qty of the line to restocks. A bundle puts back its
+// components as they were when it was sold.
+func (l returnableLine) restock(restocks map[int]quantity.Quantity, qty quantity.Quantity) {
+	if len(l.components) == 0 {
+		if l.productID != 0 {
+			restocks[l.productID] += qty
+		}
+		return
+	}
+	for _, c := range l.components {
+		if c.ProductID != 0 {
+			componentQty, _ := c.Quantity.Mul(qty)
+			restocks[c.ProductID] += componentQty
+		}
+	}
+}
+
+// createReturn writes a return document. A nil req.Items returns every
+// remaining quantity on the transaction. A non-zero req.ShiftID books the
+// refund as cash paid out of that shift's drawer; req.GiftCardCode credits it
+// to a gift card instead. Loyalty points are reversed in proportion to the
+// amount refunded.
+func (repo *TransactionRepository) createReturn(id int, req models.ReturnRequest) (*models.TransactionReturn, error) {
+	shiftID, items := req.ShiftID, req.Items
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if shiftID != 0 {
+		if err := requireOpenShift(tx, shiftID); err != nil {
+			return nil, err
+		}
+	}
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM "transaction" WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != models.TransactionStatusCompleted && status != models.TransactionStatusPartiallyRefunded {
+		return nil, models.ErrTransactionNotRefundable
+	}
+
+	lines, err := loadReturnableLines(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	lineByDetail := make(map[int]*returnableLine, len(lines))
+	for i := range lines {
+		lineByDetail[lines[i].detailID] = &lines[i]
+	}
+
+	if items == nil {
+		restock := true
+		for _, line := range lines {
+			if line.remaining() > 0 {
+				items = append(items, models.ReturnItemRequest{DetailID: line.detailID, Quantity: line.remaining(), Restock: &restock})
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: nothing left to return", models.ErrInvalidReturn)
+	}
+
+	ret := &models.TransactionReturn{
+		TransactionID: id,
+		ShiftID:       shiftID,
+		GiftCardCode:  req.GiftCardCode,
+		Reason:        req.Reason,
+		PerformedBy:   req.PerformedBy,
+		Items:         make([]models.TransactionReturnItem, 0, len(items)),
+	}
+	restocks := make(map[int]quantity.Quantity)
+
+	for _, item := range items {
+		line, ok := lineByDetail[item.DetailID]
+		if !ok {
+			return nil, fmt.Errorf("%w: detail %d does not belong to transaction %d", models.ErrInvalidReturn, item.DetailID, id)
+		}
+		if item.Quantity <= 0 || item.Quantity > line.remaining() {
+			return nil, fmt.Errorf("%w: detail %d has %s left to return, requested %s",
+				models.ErrInvalidReturn, item.DetailID, line.remaining(), item.Quantity)
+		}
+
+		// The last unit returned takes whatever is left of the line so the
+		// refunds for a line always add up to exactly what was paid for it.
+		refund := line.total.MulRat(int64(item.Quantity), int64(line.quantity), repo.roundingMode)
+		refundTax := line.tax.MulRat(int64(item.Quantity), int64(line.quantity), repo.roundingMode)
+		if item.Quantity == line.remaining() {
+			refund = line.total.Sub(line.refundedAmount)
+			refundTax = line.tax.Sub(line.refundedTax)
+		}
+		line.returnedQty += item.Quantity
+		line.refundedAmount = line.refundedAmount.Add(refund)
+		line.refundedTax = line.refundedTax.Add(refundTax)
+
+		restocked := item.Restock == nil || *item.Restock
+		if restocked {
+			line.restock(restocks, item.Quantity)
+		}
+
+		ret.RefundAmount = ret.RefundAmount.Add(refund)
+		ret.Items = append(ret.Items, models.TransactionReturnItem{
+			DetailID:     item.DetailID,
+			ProductID:    line.productID,
+			Quantity:     item.Quantity,
+			RefundAmount: refund,
+			TaxAmount:    refundTax,
+			Restocked:    restocked,
+		})
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO transaction_returns (transaction_id, refund_amount, reason, performed_by, shift_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0)) RETURNING id, created_at`,
+		id, ret.RefundAmount, req.Reason, req.PerformedBy, shiftID).Scan(&ret.ID, &ret.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ret.Items {
+		ret.Items[i].ReturnID = ret.ID
+		err = tx.QueryRow(`
+			INSERT INTO transaction_return_items (return_id, detail_id, quantity, refund_amount, tax_amount, restocked)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			ret.ID, ret.Items[i].DetailID, ret.Items[i].Quantity, ret.Items[i].RefundAmount, ret.Items[i].TaxAmount,
+			ret.Items[i].Restocked).
+			Scan(&ret.Items[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.costing.restockProducts(tx, restocks, models.StockMovement{
+		TransactionID: id,
+		ReturnID:      ret.ID,
+		Reason:        req.Reason,
+		PerformedBy:   req.PerformedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reversePoints(tx, id, ret.ID); err != nil {
+		return nil, err
+	}
+
+	if req.GiftCardCode != "" {
+		if err := refundToGiftCard(tx, req.GiftCardCode, id, ret.ID, ret.RefundAmount); err != nil {
+			return nil, err
+		}
+	}
+
+	newStatus := models.TransactionStatusRefunded
+	for _, line := range lines {
+		if line.remaining() > 0 {
+			newStatus = models.TransactionStatusPartiallyRefunded
+			break
+		}
+	}
+	if _, err := tx.Exec(`UPDATE "transaction" SET status = $1 WHERE id = $2`, newStatus, id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// loadReturnableLines reads the lines of a transaction together with what has
+// already been returned from each of them.
+func loadReturnableLines(tx *sql.Tx, transactionID int) ([]returnableLine, error) {
+	rows, err := tx.Query(`
+		SELECT td.id, COALESCE(td.product_id, 0), td.quantity, td.total_amount, td.tax_amount,
+			COALESCE(SUM(ri.quantity), 0), COALESCE(SUM(ri.refund_amount), 0), COALESCE(SUM(ri.tax_amount), 0)
+		FROM transaction_details td
+		LEFT JOIN transaction_return_items ri ON ri.detail_id = td.id
+		WHERE td.transaction_id = $1
+		GROUP BY td.id
+		ORDER BY td.id`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]returnableLine, 0)
+	for rows.Next() {
+		var l returnableLine
+		if err := rows.Scan(&l.detailID, &l.productID, &l.quantity, &l.total, &l.tax,
+			&l.returnedQty, &l.refundedAmount, &l.refundedTax); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	componentRows, err := tx.Query(`
+		SELECT dc.detail_id, COALESCE(dc.product_id, 0), dc.quantity
+		FROM transaction_detail_components dc
+		JOIN transaction_details td ON td.id = dc.detail_id
+		WHERE td.transaction_id = $1
+		ORDER BY dc.id`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer componentRows.Close()
+
+	for componentRows.Next() {
+		var detailID int
+		var c models.DetailComponent
+		if err := componentRows.Scan(&detailID, &c.ProductID, &c.Quantity); err != nil {
+			return nil, err
+		}
+		for i := range lines {
+			if lines[i].detailID == detailID {
+				lines[i].components = append(lines[i].components, c)
+			}
+		}
+	}
+
+	return lines, componentRows.Err()
+}
+
+// restockProducts puts quantities back into stock in product ID order, the
+// same order checkout locks rows in, recording each as a return movement
+// carrying the references and reason of movement.
+func (c stockCosting) restockProducts(tx *sql.Tx, quantities map[int]quantity.Quantity, movement models.StockMovement) error {
+	productIDs := make([]int, 0, len(quantities))
+	for productID := range quantities {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Ints(productIDs)
+
+	for _, productID := range productIDs {
+		m := movement
+		m.ProductID = productID
+		m.Type = models.StockMovementReturn
+		m.Quantity = quantities[productID]
+		if err := c.moveStock(tx, &m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/quantity"
+	"cashier-api/repositories"
+)
+
+type CartServiceInput interface {
+	GetAll(status string) ([]models.Cart, error)
+	Create(req models.CreateCartRequest) (*models.Cart, error)
+	GetByID(id int) (*models.Cart, error)
+	AddItem(id int, item models.CheckoutItem) (*models.Cart, error)
+	SetItemQuantity(id, productID int, qty quantity.Quantity) (*models.Cart, error)
+	Hold(id int) (*models.Cart, error)
+	Resume(id int) (*models.Cart, error)
+}
+
+type cartService struct {
+	repo repositories.CartRepositoryInput
+}
+
+func NewCartService(repo repositories.CartRepositoryInput) CartServiceInput {
+	return &cartService{repo: repo}
+}
+
+func (s *cartService) GetAll(status string) ([]models.Cart, error) {
+	return s.repo.GetAll(status)
+}
+
+func (s *cartService) Create(req models.CreateCartRequest) (*models.Cart, error) {
+	return s.repo.Create(req)
+}
+
+func (s *cartService) GetByID(id int) (*models.Cart, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *cartService) AddItem(id int, item models.CheckoutItem) (*models.Cart, error) {
+	return s.repo.AddItem(id, item)
+}
+
+func (s *cartService) SetItemQuantity(id, productID int, qty quantity.Quantity) (*models.Cart, error) {
+	return s.repo.SetItemQuantity(id, productID, qty)
+}
+
+func (s *cartService) Hold(id int) (*models.Cart, error) {
+	return s.repo.Hold(id)
+}
+
+func (s *cartService) Resume(id int) (*models.Cart, error) {
+	return s.repo.Resume(id)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+	"fmt"
+	"strings"
+)
+
+type CustomerServiceInput interface {
+	GetAll(search string) ([]models.Customer, error)
+	Create(customer *models.Customer) error
+	GetByID(id int) (*models.Customer, error)
+	Update(customer *models.Customer) error
+	Delete(id int) error
+	GetPoints(id int) (*models.PointsStatement, error)
+}
+
+type customerService struct {
+	repo repositories.CustomerRepositoryInput
+}
+
+func NewCustomerService(repo repositories.CustomerRepositoryInput) CustomerServiceInput {
+	return &customerService{repo: repo}
+}
+
+func (s *customerService) GetAll(search string) ([]models.Customer, error) {
+	return s.repo.GetAll(strings.TrimSpace(search))
+}
+
+func (s *customerService) Create(customer *models.Customer) error {
+	if err := validateCustomer(customer); err != nil {
+		return err
+	}
+	return s.repo.Create(customer)
+}
+
+func (s *customerService) GetByID(id int) (*models.Customer, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *customerService) Update(customer *models.Customer) error {
+	if err := validateCustomer(customer); err != nil {
+		return err
+	}
+	return s.repo.Update(customer)
+}
+
+func (s *customerService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+func (s *customerService) GetPoints(id int) (*models.PointsStatement, error) {
+	return s.repo.GetPoints(id)
+}
+
+// validateCustomer trims the contact fields and checks that a name is given
+// and an email, if any, looks like one.
+func validateCustomer(c *models.Customer) error {
+	c.MemberNumber = strings.TrimSpace(c.MemberNumber)
+	c.Name = strings.TrimSpace(c.Name)
+	c.Phone = strings.TrimSpace(c.Phone)
+	c.Email = strings.TrimSpace(c.Email)
+
+	if c.Name == "" {
+		return fmt.Errorf("%w: name is required", models.ErrInvalidCustomer)
+	}
+	if len(c.MemberNumber) > 20 {
+		return fmt.Errorf("%w: member_number must be at most 20 characters", models.ErrInvalidCustomer)
+	}
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		return fmt.Errorf("%w: email is not valid", models.ErrInvalidCustomer)
+	}
+	return nil
+}
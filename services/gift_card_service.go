@@ -0,0 +1,71 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/money"
+	"cashier-api/repositories"
+	"fmt"
+	"time"
+)
+
+type GiftCardServiceInput interface {
+	GetAll(kind, status string) ([]models.GiftCard, error)
+	Issue(req models.IssueGiftCardRequest) (*models.GiftCard, error)
+	GetByCode(code string) (*models.GiftCard, error)
+	Activate(code string) (*models.GiftCard, error)
+	TopUp(code string, amount money.Money) (*models.GiftCard, error)
+	GetEntries(code string) ([]models.GiftCardEntry, error)
+}
+
+type giftCardService struct {
+	repo repositories.GiftCardRepositoryInput
+}
+
+func NewGiftCardService(repo repositories.GiftCardRepositoryInput) GiftCardServiceInput {
+	return &giftCardService{repo: repo}
+}
+
+func (s *giftCardService) GetAll(kind, status string) ([]models.GiftCard, error) {
+	return s.repo.GetAll(kind, status)
+}
+
+// Issue checks the kind and value. A voucher must carry a value; a card may
+// be issued empty and topped up after activation.
+func (s *giftCardService) Issue(req models.IssueGiftCardRequest) (*models.GiftCard, error) {
+	switch req.Kind {
+	case models.GiftCardKindCard:
+		if req.Value.IsNegative() {
+			return nil, fmt.Errorf("%w: value must not be negative", models.ErrInvalidGiftCard)
+		}
+	case models.GiftCardKindVoucher:
+		if !req.Value.IsPositive() {
+			return nil, fmt.Errorf("%w: a voucher needs a value greater than zero", models.ErrInvalidGiftCard)
+		}
+	default:
+		return nil, fmt.Errorf("%w: kind must be %q or %q", models.ErrInvalidGiftCard, models.GiftCardKindCard,
+			models.GiftCardKindVoucher)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", models.ErrInvalidGiftCard)
+	}
+	return s.repo.Issue(req)
+}
+
+func (s *giftCardService) GetByCode(code string) (*models.GiftCard, error) {
+	return s.repo.GetByCode(code)
+}
+
+func (s *giftCardService) Activate(code string) (*models.GiftCard, error) {
+	return s.repo.Activate(code)
+}
+
+func (s *giftCardService) TopUp(code string, amount money.Money) (*models.GiftCard, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be greater than zero", models.ErrInvalidGiftCard)
+	}
+	return s.repo.TopUp(code, amount)
+}
+
+func (s *giftCardService) GetEntries(code string) ([]models.GiftCardEntry, error) {
+	return s.repo.GetEntries(code)
+}
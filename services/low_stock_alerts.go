@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"cashier-api/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// lowStockQueueSize is how many alerts can wait for delivery. When the
+// queue is full further alerts are logged and dropped rather than holding
+// up checkout.
+const lowStockQueueSize = 256
+
+// LowStockAlerts delivers low-stock alerts in the background: each is logged
+// and, when a webhook URL is configured, posted to it as JSON.
+type LowStockAlerts struct {
+	webhookURL string
+	client     *http.Client
+	queue      chan models.LowStockAlert
+}
+
+// NewLowStockAlerts starts the goroutine that delivers alerts. An empty
+// webhookURL only logs them.
+func NewLowStockAlerts(webhookURL string, timeout time.Duration) *LowStockAlerts {
+	a := &LowStockAlerts{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: timeout},
+		queue:      make(chan models.LowStockAlert, lowStockQueueSize),
+	}
+	go a.run()
+	return a
+}
+
+// Notify queues alerts without waiting for them to be delivered.
+func (a *LowStockAlerts) Notify(alerts []models.LowStockAlert) {
+	for _, alert := range alerts {
+		select {
+		case a.queue <- alert:
+		default:
+			log.Printf("Low stock alert queue full, dropping alert for product %d", alert.ProductID)
+		}
+	}
+}
+
+func (a *LowStockAlerts) run() {
+	for alert := range a.queue {
+		log.Printf("Low stock: product %d (%s) down to %s, reorder point %s",
+			alert.ProductID, alert.ProductName, alert.Stock, alert.ReorderPoint)
+		if a.webhookURL == "" {
+			continue
+		}
+		if err := a.post(alert); err != nil {
+			log.Printf("Failed to send low stock alert for product %d: %v", alert.ProductID, err)
+		}
+	}
+}
+
+func (a *LowStockAlerts) post(alert models.LowStockAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(a.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
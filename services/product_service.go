@@ -1,31 +1,63 @@
 package services
 
 import (
+	"cashier-api/barcode"
 	"cashier-api/models"
+	"cashier-api/quantity"
 	"cashier-api/repositories"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ProductServiceInput interface {
-	GetAll(page, limit, name string) ([]models.Product, error)
+	GetAll(page, limit, name string, grouped bool) ([]models.Product, error)
 	Create(product *models.Product) error
 	GetByID(id int) (*models.Product, error)
 	Update(product *models.Product) error
 	Delete(id int) error
+	Lookup(code, sku string) (*models.Product, error)
+	GetVariants(parentID int) ([]models.Product, error)
+	GenerateVariants(parentID int, req models.GenerateVariantsRequest) ([]models.Product, error)
+	ReceiveStock(id int, req models.ReceiveStockRequest) (*models.Product, error)
+	AdjustStock(id int, req models.StockAdjustmentRequest) (*models.StockMovement, error)
+	GetMovements(id int) ([]models.StockMovement, error)
+	FindStockDrift() ([]models.StockDrift, error)
+	GetLowStock(opts models.ReorderOptions) ([]models.LowStockProduct, error)
 }
 
 type productService struct {
-	repo repositories.ProductRepositoryInput
+	repo  repositories.ProductRepositoryInput
+	cache *lookupCache
 }
 
-func NewProductService(repo repositories.ProductRepositoryInput) ProductServiceInput {
-	return &productService{repo: repo}
+// NewProductService caches scan lookups for lookupTTL; zero turns the cache
+// off.
+func NewProductService(repo repositories.ProductRepositoryInput, lookupTTL time.Duration) ProductServiceInput {
+	return &productService{repo: repo, cache: newLookupCache(lookupTTL)}
 }
 
-func (s *productService) GetAll(page, limit, name string) ([]models.Product, error) {
-	return s.repo.GetAll(page, limit, name)
+func (s *productService) GetAll(page, limit, name string, grouped bool) ([]models.Product, error) {
+	return s.repo.GetAll(page, limit, name, grouped)
 }
 
 func (s *productService) Create(product *models.Product) error {
+	if err := validateProductCodes(product); err != nil {
+		return err
+	}
+	if err := validateProductUnit(product); err != nil {
+		return err
+	}
+	if err := validateProductType(product); err != nil {
+		return err
+	}
+	if err := validateProductReorder(product); err != nil {
+		return err
+	}
+	if product.Type == models.ProductTypeBundle && len(product.Components) == 0 {
+		return fmt.Errorf("%w: a bundle needs at least one component", models.ErrInvalidProduct)
+	}
 	return s.repo.Create(product)
 }
 
@@ -34,9 +66,341 @@ func (s *productService) GetByID(id int) (*models.Product, error) {
 }
 
 func (s *productService) Update(product *models.Product) error {
+	if err := validateProductCodes(product); err != nil {
+		return err
+	}
+	if err := validateProductUnit(product); err != nil {
+		return err
+	}
+	if err := validateProductType(product); err != nil {
+		return err
+	}
+	if err := validateProductReorder(product); err != nil {
+		return err
+	}
+	defer s.cache.clear()
 	return s.repo.Update(product)
 }
 
 func (s *productService) Delete(id int) error {
+	defer s.cache.clear()
 	return s.repo.Delete(id)
 }
+
+// Lookup finds the product for a scanned barcode or a typed SKU. Hits are
+// served from memory, so the stock shown, and a price changed through another
+// instance, may be up to the cache TTL old; checkout always prices from the
+// database.
+func (s *productService) Lookup(code, sku string) (*models.Product, error) {
+	key := "sku:" + sku
+	if code != "" {
+		normalized, err := barcode.Normalize(code)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", models.ErrInvalidProduct, err)
+		}
+		code = normalized
+		key = "barcode:" + code
+	}
+
+	if product, ok := s.cache.get(key); ok {
+		return product, nil
+	}
+	product, err := s.repo.Lookup(code, sku)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(key, product)
+	return product, nil
+}
+
+func (s *productService) GetVariants(parentID int) ([]models.Product, error) {
+	return s.repo.GetVariants(parentID)
+}
+
+// GenerateVariants checks the option axes before creating the variants they
+// describe.
+func (s *productService) GenerateVariants(parentID int, req models.GenerateVariantsRequest) ([]models.Product, error) {
+	if err := validateProductOptions(req.Options); err != nil {
+		return nil, err
+	}
+	defer s.cache.clear()
+	return s.repo.GenerateVariants(parentID, req.Options)
+}
+
+func (s *productService) ReceiveStock(id int, req models.ReceiveStockRequest) (*models.Product, error) {
+	if req.Quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be greater than zero", models.ErrInvalidQuantity)
+	}
+	if req.UnitCost != nil && req.UnitCost.IsNegative() {
+		return nil, fmt.Errorf("%w: unit cost must not be negative", models.ErrInvalidProduct)
+	}
+	req.Pack = strings.TrimSpace(req.Pack)
+	defer s.cache.clear()
+	return s.repo.ReceiveStock(id, req)
+}
+
+// AdjustStock records a change to stock that is not a sale, return or
+// receipt. Damage only ever takes stock away; an adjustment or transfer may
+// go either way.
+func (s *productService) AdjustStock(id int, req models.StockAdjustmentRequest) (*models.StockMovement, error) {
+	if req.Type == "" {
+		req.Type = models.StockMovementAdjustment
+	}
+	switch req.Type {
+	case models.StockMovementAdjustment, models.StockMovementTransfer:
+	case models.StockMovementDamage:
+		if req.Quantity > 0 {
+			return nil, fmt.Errorf("%w: damage takes stock away, so its quantity must be negative",
+				models.ErrInvalidStockAdjustment)
+		}
+	default:
+		return nil, fmt.Errorf("%w: type must be %s, %s or %s", models.ErrInvalidStockAdjustment,
+			models.StockMovementAdjustment, models.StockMovementDamage, models.StockMovementTransfer)
+	}
+	if req.Quantity == 0 {
+		return nil, fmt.Errorf("%w: quantity must not be zero", models.ErrInvalidStockAdjustment)
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", models.ErrInvalidStockAdjustment)
+	}
+	defer s.cache.clear()
+	return s.repo.AdjustStock(id, req)
+}
+
+func (s *productService) GetMovements(id int) ([]models.StockMovement, error) {
+	return s.repo.GetMovements(id)
+}
+
+func (s *productService) FindStockDrift() ([]models.StockDrift, error) {
+	return s.repo.FindStockDrift()
+}
+
+func (s *productService) GetLowStock(opts models.ReorderOptions) ([]models.LowStockProduct, error) {
+	return s.repo.GetLowStock(opts)
+}
+
+// maxVariants bounds how many combinations one set of options may expand to.
+const maxVariants = 200
+
+// validateProductOptions trims option names and values and rejects empty or
+// repeated ones.
+func validateProductOptions(options []models.ProductOption) error {
+	if len(options) == 0 {
+		return fmt.Errorf("%w: at least one option is required", models.ErrInvalidProduct)
+	}
+
+	count := 1
+	names := make(map[string]bool, len(options))
+	for i := range options {
+		o := &options[i]
+		o.Name = strings.TrimSpace(o.Name)
+		if o.Name == "" {
+			return fmt.Errorf("%w: option name is required", models.ErrInvalidProduct)
+		}
+		key := strings.ToLower(o.Name)
+		if names[key] {
+			return fmt.Errorf("%w: option %q is listed twice", models.ErrInvalidProduct, o.Name)
+		}
+		names[key] = true
+
+		if len(o.Values) == 0 {
+			return fmt.Errorf("%w: option %q needs at least one value", models.ErrInvalidProduct, o.Name)
+		}
+		values := make(map[string]bool, len(o.Values))
+		for j, v := range o.Values {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				return fmt.Errorf("%w: option %q has an empty value", models.ErrInvalidProduct, o.Name)
+			}
+			if values[strings.ToLower(v)] {
+				return fmt.Errorf("%w: option %q lists %q twice", models.ErrInvalidProduct, o.Name, v)
+			}
+			values[strings.ToLower(v)] = true
+			o.Values[j] = v
+		}
+
+		count *= len(o.Values)
+		if count > maxVariants {
+			return fmt.Errorf("%w: options expand to more than %d variants", models.ErrInvalidProduct, maxVariants)
+		}
+	}
+	return nil
+}
+
+// validateProductType defaults the type to standard and checks a bundle's
+// components. Bundles are sold whole and keep no stock of their own, so any
+// stock sent for one, such as the computed figure read back from a GET, is
+// dropped.
+func validateProductType(p *models.Product) error {
+	if p.Type == "" {
+		p.Type = models.ProductTypeStandard
+	}
+	switch p.Type {
+	case models.ProductTypeStandard:
+		if len(p.Components) > 0 {
+			return fmt.Errorf("%w: only a bundle has components", models.ErrInvalidProduct)
+		}
+		return nil
+	case models.ProductTypeBundle:
+	default:
+		return fmt.Errorf("%w: type must be %q or %q", models.ErrInvalidProduct, models.ProductTypeStandard,
+			models.ProductTypeBundle)
+	}
+
+	if p.Precision != 0 {
+		return fmt.Errorf("%w: a bundle is sold in whole units", models.ErrInvalidProduct)
+	}
+	p.Stock = 0
+
+	seen := make(map[int]bool, len(p.Components))
+	for _, c := range p.Components {
+		if seen[c.ProductID] {
+			return fmt.Errorf("%w: component product id %d is listed twice", models.ErrInvalidProduct, c.ProductID)
+		}
+		seen[c.ProductID] = true
+		if c.Quantity <= 0 {
+			return fmt.Errorf("%w: component quantities must be greater than zero", models.ErrInvalidProduct)
+		}
+	}
+	return nil
+}
+
+// validateProductUnit defaults the unit to pieces and checks that the stock
+// and every pack size fit the product's precision. The cost price, which is
+// per unit, must not be negative.
+func validateProductUnit(p *models.Product) error {
+	p.Unit = strings.ToLower(strings.TrimSpace(p.Unit))
+	if p.Unit == "" {
+		p.Unit = models.UnitPiece
+	}
+	if !models.IsUnit(p.Unit) {
+		return fmt.Errorf("%w: unit must be one of %s, %s, %s, %s or %s", models.ErrInvalidProduct,
+			models.UnitPiece, models.UnitKilogram, models.UnitGram, models.UnitLitre, models.UnitMetre)
+	}
+	if p.Precision < 0 || p.Precision > quantity.MaxPlaces {
+		return fmt.Errorf("%w: precision must be between 0 and %d", models.ErrInvalidProduct, quantity.MaxPlaces)
+	}
+	if p.CostPrice.IsNegative() {
+		return fmt.Errorf("%w: cost price must not be negative", models.ErrInvalidProduct)
+	}
+	if p.Stock.Places() > p.Precision {
+		return fmt.Errorf("%w: stock %s has more decimal places than the precision allows", models.ErrInvalidProduct, p.Stock)
+	}
+
+	names := make(map[string]bool, len(p.Packs))
+	for i := range p.Packs {
+		pack := &p.Packs[i]
+		pack.Name = strings.TrimSpace(pack.Name)
+		if pack.Name == "" {
+			return fmt.Errorf("%w: pack name is required", models.ErrInvalidProduct)
+		}
+		if names[strings.ToLower(pack.Name)] {
+			return fmt.Errorf("%w: pack %q is listed twice", models.ErrInvalidProduct, pack.Name)
+		}
+		names[strings.ToLower(pack.Name)] = true
+		if pack.Size <= 0 || pack.Size.Places() > p.Precision {
+			return fmt.Errorf("%w: pack %q needs a size greater than zero in whole steps of the product's precision",
+				models.ErrInvalidProduct, pack.Name)
+		}
+	}
+	return nil
+}
+
+// validateProductReorder checks the reorder settings: a product with a
+// reorder point needs a quantity to reorder, in steps of its precision, and
+// a bundle is reordered through its components.
+func validateProductReorder(p *models.Product) error {
+	if p.ReorderPoint < 0 || p.ReorderQuantity < 0 {
+		return fmt.Errorf("%w: reorder point and quantity must not be negative", models.ErrInvalidProduct)
+	}
+	if p.ReorderPoint == 0 {
+		return nil
+	}
+	if p.Type == models.ProductTypeBundle {
+		return fmt.Errorf("%w: a bundle is reordered through its components", models.ErrInvalidProduct)
+	}
+	if p.ReorderQuantity == 0 {
+		return fmt.Errorf("%w: a product with a reorder point needs a reorder quantity", models.ErrInvalidProduct)
+	}
+	if p.ReorderPoint.Places() > p.Precision || p.ReorderQuantity.Places() > p.Precision {
+		return fmt.Errorf("%w: reorder point and quantity have more decimal places than the precision allows",
+			models.ErrInvalidProduct)
+	}
+	return nil
+}
+
+// validateProductCodes trims the SKU and normalizes every barcode, rejecting
+// repeats within the product.
+func validateProductCodes(p *models.Product) error {
+	p.SKU = strings.TrimSpace(p.SKU)
+	if len(p.SKU) > 64 {
+		return fmt.Errorf("%w: sku must be at most 64 characters", models.ErrInvalidProduct)
+	}
+
+	seen := make(map[string]bool, len(p.Barcodes))
+	for i, code := range p.Barcodes {
+		normalized, err := barcode.Normalize(strings.TrimSpace(code))
+		if err != nil {
+			return fmt.Errorf("%w: %v", models.ErrInvalidProduct, err)
+		}
+		if seen[normalized] {
+			return fmt.Errorf("%w: barcode %s is listed twice", models.ErrInvalidProduct, normalized)
+		}
+		seen[normalized] = true
+		p.Barcodes[i] = normalized
+	}
+	return nil
+}
+
+// lookupCacheLimit bounds the cache; when it fills up it starts over.
+const lookupCacheLimit = 10000
+
+type cachedProduct struct {
+	product   models.Product
+	expiresAt time.Time
+}
+
+// lookupCache keeps scan lookups in memory. Any product write through this
+// process clears it.
+type lookupCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]cachedProduct
+}
+
+func newLookupCache(ttl time.Duration) *lookupCache {
+	return &lookupCache{ttl: ttl, entries: make(map[string]cachedProduct)}
+}
+
+func (c *lookupCache) get(key string) (*models.Product, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	product := entry.product
+	return &product, true
+}
+
+func (c *lookupCache) put(key string, product *models.Product) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= lookupCacheLimit {
+		c.entries = make(map[string]cachedProduct)
+	}
+	c.entries[key] = cachedProduct{product: *product, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *lookupCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]cachedProduct)
+	c.mu.Unlock()
+}
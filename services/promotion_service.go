@@ -0,0 +1,103 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+	"fmt"
+)
+
+type PromotionServiceInput interface {
+	GetAll() ([]models.Promotion, error)
+	Create(promotion *models.Promotion) error
+	GetByID(id int) (*models.Promotion, error)
+	Update(promotion *models.Promotion) error
+	Delete(id int) error
+}
+
+type promotionService struct {
+	repo repositories.PromotionRepositoryInput
+}
+
+func NewPromotionService(repo repositories.PromotionRepositoryInput) PromotionServiceInput {
+	return &promotionService{repo: repo}
+}
+
+func (s *promotionService) GetAll() ([]models.Promotion, error) {
+	return s.repo.GetAll()
+}
+
+func (s *promotionService) Create(promotion *models.Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	return s.repo.Create(promotion)
+}
+
+func (s *promotionService) GetByID(id int) (*models.Promotion, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *promotionService) Update(promotion *models.Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	return s.repo.Update(promotion)
+}
+
+func (s *promotionService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+// validatePromotion checks that the fields the promotion's type relies on are
+// set, and fills in defaults for the optional ones.
+func validatePromotion(p *models.Promotion) error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", models.ErrInvalidPromotion)
+	}
+	if p.Level == "" {
+		p.Level = models.PromotionLevelLine
+	}
+	if p.Level != models.PromotionLevelLine && p.Level != models.PromotionLevelOrder {
+		return fmt.Errorf("%w: level must be line or order", models.ErrInvalidPromotion)
+	}
+	if p.ProductIDs == nil {
+		p.ProductIDs = []int{}
+	}
+	if p.CategoryIDs == nil {
+		p.CategoryIDs = []int{}
+	}
+	if p.MinSpend.IsNegative() {
+		return fmt.Errorf("%w: min_spend must not be negative", models.ErrInvalidPromotion)
+	}
+	if p.EndsAt != nil && !p.StartsAt.IsZero() && !p.EndsAt.After(p.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", models.ErrInvalidPromotion)
+	}
+
+	switch p.Type {
+	case models.PromotionTypePercentage:
+		if p.Percent <= 0 {
+			return fmt.Errorf("%w: percent must be greater than zero", models.ErrInvalidPromotion)
+		}
+	case models.PromotionTypeFixedAmount:
+		if !p.Amount.IsPositive() {
+			return fmt.Errorf("%w: amount must be greater than zero", models.ErrInvalidPromotion)
+		}
+	case models.PromotionTypeBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return fmt.Errorf("%w: buy_quantity and get_quantity must be greater than zero", models.ErrInvalidPromotion)
+		}
+		p.Level = models.PromotionLevelLine
+	case models.PromotionTypeBundle:
+		if len(p.ProductIDs) < 2 {
+			return fmt.Errorf("%w: a bundle needs at least two product_ids", models.ErrInvalidPromotion)
+		}
+		if p.BundlePrice.IsNegative() {
+			return fmt.Errorf("%w: bundle_price must not be negative", models.ErrInvalidPromotion)
+		}
+		p.Level = models.PromotionLevelLine
+	default:
+		return fmt.Errorf("%w: unknown type %q", models.ErrInvalidPromotion, p.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+	"fmt"
+	"strings"
+)
+
+type PurchaseOrderServiceInput interface {
+	GetAll(status string, supplierID int) ([]models.PurchaseOrder, error)
+	Create(req models.PurchaseOrderRequest) (*models.PurchaseOrder, error)
+	GetByID(id int) (*models.PurchaseOrder, error)
+	Update(id int, req models.PurchaseOrderRequest) (*models.PurchaseOrder, error)
+	Send(id int) (*models.PurchaseOrder, error)
+	Cancel(id int) (*models.PurchaseOrder, error)
+	Receive(id int, req models.GoodsReceiptRequest) (*models.GoodsReceipt, error)
+	GetOutstanding(supplierID int) ([]models.OutstandingOrders, error)
+	GetSuggestions(opts models.ReorderOptions) ([]models.SuggestedPurchaseOrder, error)
+	CreateSuggested(req models.CreateSuggestedOrdersRequest) ([]models.PurchaseOrder, error)
+}
+
+type purchaseOrderService struct {
+	repo repositories.PurchaseOrderRepositoryInput
+}
+
+func NewPurchaseOrderService(repo repositories.PurchaseOrderRepositoryInput) PurchaseOrderServiceInput {
+	return &purchaseOrderService{repo: repo}
+}
+
+func (s *purchaseOrderService) GetAll(status string, supplierID int) ([]models.PurchaseOrder, error) {
+	return s.repo.GetAll(status, supplierID)
+}
+
+func (s *purchaseOrderService) Create(req models.PurchaseOrderRequest) (*models.PurchaseOrder, error) {
+	if err := validatePurchaseOrder(&req); err != nil {
+		return nil, err
+	}
+	return s.repo.Create(req)
+}
+
+func (s *purchaseOrderService) GetByID(id int) (*models.PurchaseOrder, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *purchaseOrderService) Update(id int, req models.PurchaseOrderRequest) (*models.PurchaseOrder, error) {
+	if err := validatePurchaseOrder(&req); err != nil {
+		return nil, err
+	}
+	return s.repo.Update(id, req)
+}
+
+func (s *purchaseOrderService) Send(id int) (*models.PurchaseOrder, error) {
+	return s.repo.Send(id)
+}
+
+func (s *purchaseOrderService) Cancel(id int) (*models.PurchaseOrder, error) {
+	return s.repo.Cancel(id)
+}
+
+func (s *purchaseOrderService) Receive(id int, req models.GoodsReceiptRequest) (*models.GoodsReceipt, error) {
+	req.ReceivedBy = strings.TrimSpace(req.ReceivedBy)
+	if req.ReceivedBy == "" {
+		return nil, fmt.Errorf("%w: received_by is required", models.ErrInvalidPurchaseOrder)
+	}
+	if len(req.Lines) == 0 {
+		return nil, fmt.Errorf("%w: a delivery needs at least one line", models.ErrInvalidPurchaseOrder)
+	}
+	seen := make(map[int]bool, len(req.Lines))
+	for _, l := range req.Lines {
+		if seen[l.ProductID] {
+			return nil, fmt.Errorf("%w: product %d is listed twice", models.ErrInvalidPurchaseOrder, l.ProductID)
+		}
+		seen[l.ProductID] = true
+		if l.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantities must be greater than zero", models.ErrInvalidQuantity)
+		}
+		if l.UnitCost != nil && l.UnitCost.IsNegative() {
+			return nil, fmt.Errorf("%w: unit cost must not be negative", models.ErrInvalidPurchaseOrder)
+		}
+	}
+	return s.repo.Receive(id, req)
+}
+
+func (s *purchaseOrderService) GetOutstanding(supplierID int) ([]models.OutstandingOrders, error) {
+	return s.repo.GetOutstanding(supplierID)
+}
+
+func (s *purchaseOrderService) GetSuggestions(opts models.ReorderOptions) ([]models.SuggestedPurchaseOrder, error) {
+	return s.repo.GetSuggestions(opts)
+}
+
+// CreateSuggested raises a draft purchase order per supplier from the
+// reorder suggestions, to be checked and sent by hand. Products without a
+// preferred supplier are skipped.
+func (s *purchaseOrderService) CreateSuggested(req models.CreateSuggestedOrdersRequest) ([]models.PurchaseOrder, error) {
+	req.CreatedBy = strings.TrimSpace(req.CreatedBy)
+	if req.CreatedBy == "" {
+		return nil, fmt.Errorf("%w: created_by is required", models.ErrInvalidPurchaseOrder)
+	}
+	if req.SalesWindowDays < 0 || req.CoverDays < 0 {
+		return nil, fmt.Errorf("%w: days and cover_days must not be negative", models.ErrInvalidPurchaseOrder)
+	}
+
+	suggestions, err := s.repo.GetSuggestions(models.ReorderOptions{
+		SalesWindowDays: req.SalesWindowDays,
+		CoverDays:       req.CoverDays,
+		SupplierID:      req.SupplierID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]models.PurchaseOrder, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		if suggestion.SupplierID == 0 {
+			continue
+		}
+		order := models.PurchaseOrderRequest{
+			SupplierID: suggestion.SupplierID,
+			Note:       "suggested reorder",
+			CreatedBy:  req.CreatedBy,
+		}
+		for _, l := range suggestion.Lines {
+			order.Lines = append(order.Lines, models.PurchaseOrderLineRequest{
+				ProductID: l.ProductID,
+				Quantity:  l.SuggestedQuantity,
+				UnitCost:  l.UnitCost,
+			})
+		}
+		created, err := s.repo.Create(order)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, *created)
+	}
+	return orders, nil
+}
+
+// validatePurchaseOrder checks that an order has a supplier, an author and
+// at least one line, with each product ordered once at a positive quantity.
+func validatePurchaseOrder(req *models.PurchaseOrderRequest) error {
+	req.CreatedBy = strings.TrimSpace(req.CreatedBy)
+	req.Note = strings.TrimSpace(req.Note)
+	if req.SupplierID == 0 || req.CreatedBy == "" {
+		return fmt.Errorf("%w: supplier_id and created_by are required", models.ErrInvalidPurchaseOrder)
+	}
+	if len(req.Lines) == 0 {
+		return fmt.Errorf("%w: an order needs at least one line", models.ErrInvalidPurchaseOrder)
+	}
+
+	seen := make(map[int]bool, len(req.Lines))
+	for _, l := range req.Lines {
+		if seen[l.ProductID] {
+			return fmt.Errorf("%w: product %d is listed twice", models.ErrInvalidPurchaseOrder, l.ProductID)
+		}
+		seen[l.ProductID] = true
+		if l.Quantity <= 0 {
+			return fmt.Errorf("%w: quantities must be greater than zero", models.ErrInvalidQuantity)
+		}
+		if l.UnitCost.IsNegative() {
+			return fmt.Errorf("%w: unit cost must not be negative", models.ErrInvalidPurchaseOrder)
+		}
+	}
+	return nil
+}
@@ -20,3 +20,34 @@ func (s *ReportService) GetSalesSummaryToday() (*models.SalesSummary, error) {
 func (s *ReportService) GetSalesSummaryRange(startDate, endDate string) (*models.SalesSummary, error) {
 	return s.repo.GetSalesSummaryRange(startDate, endDate)
 }
+
+func (s *ReportService) GetMarginReport(startDate, endDate string) (*models.MarginReport, error) {
+	return s.repo.GetMarginReport(startDate, endDate)
+}
+
+func (s *ReportService) GetInventoryValuation(asOf string) (*models.InventoryValuation, error) {
+	return s.repo.GetInventoryValuation(asOf)
+}
+
+// GetXReport is a read-only snapshot of a shift, available at any time.
+func (s *ReportService) GetXReport(shiftID int) (*models.ShiftReport, error) {
+	report, err := s.repo.GetShiftReport(shiftID)
+	if err != nil {
+		return nil, err
+	}
+	report.Type = models.ShiftReportX
+	return report, nil
+}
+
+// GetZReport is the end-of-shift report, available once the shift is closed.
+func (s *ReportService) GetZReport(shiftID int) (*models.ShiftReport, error) {
+	report, err := s.repo.GetShiftReport(shiftID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Shift.Status != models.ShiftStatusClosed {
+		return nil, models.ErrShiftStillOpen
+	}
+	report.Type = models.ShiftReportZ
+	return report, nil
+}
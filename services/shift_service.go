@@ -0,0 +1,42 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+)
+
+type ShiftServiceInput interface {
+	GetAll(status string) ([]models.Shift, error)
+	Open(req models.OpenShiftRequest) (*models.Shift, error)
+	GetByID(id int) (*models.Shift, error)
+	Close(id int, req models.CloseShiftRequest) (*models.Shift, error)
+	AddCashMovement(movement *models.CashMovement) error
+}
+
+type shiftService struct {
+	repo repositories.ShiftRepositoryInput
+}
+
+func NewShiftService(repo repositories.ShiftRepositoryInput) ShiftServiceInput {
+	return &shiftService{repo: repo}
+}
+
+func (s *shiftService) GetAll(status string) ([]models.Shift, error) {
+	return s.repo.GetAll(status)
+}
+
+func (s *shiftService) Open(req models.OpenShiftRequest) (*models.Shift, error) {
+	return s.repo.Open(req)
+}
+
+func (s *shiftService) GetByID(id int) (*models.Shift, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *shiftService) Close(id int, req models.CloseShiftRequest) (*models.Shift, error) {
+	return s.repo.Close(id, req)
+}
+
+func (s *shiftService) AddCashMovement(movement *models.CashMovement) error {
+	return s.repo.AddCashMovement(movement)
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+)
+
+type StocktakeServiceInput interface {
+	GetAll(status string) ([]models.Stocktake, error)
+	Open(req models.OpenStocktakeRequest) (*models.Stocktake, error)
+	GetByID(id int) (*models.Stocktake, error)
+	AddCount(id int, req models.StocktakeCountRequest) (*models.StocktakeLine, error)
+	Post(id int, req models.PostStocktakeRequest) (*models.Stocktake, error)
+	Cancel(id int, req models.CancelStocktakeRequest) (*models.Stocktake, error)
+}
+
+type stocktakeService struct {
+	repo repositories.StocktakeRepositoryInput
+}
+
+func NewStocktakeService(repo repositories.StocktakeRepositoryInput) StocktakeServiceInput {
+	return &stocktakeService{repo: repo}
+}
+
+func (s *stocktakeService) GetAll(status string) ([]models.Stocktake, error) {
+	return s.repo.GetAll(status)
+}
+
+func (s *stocktakeService) Open(req models.OpenStocktakeRequest) (*models.Stocktake, error) {
+	return s.repo.Open(req)
+}
+
+func (s *stocktakeService) GetByID(id int) (*models.Stocktake, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *stocktakeService) AddCount(id int, req models.StocktakeCountRequest) (*models.StocktakeLine, error) {
+	return s.repo.AddCount(id, req)
+}
+
+func (s *stocktakeService) Post(id int, req models.PostStocktakeRequest) (*models.Stocktake, error) {
+	return s.repo.Post(id, req)
+}
+
+func (s *stocktakeService) Cancel(id int, req models.CancelStocktakeRequest) (*models.Stocktake, error) {
+	return s.repo.Cancel(id, req)
+}
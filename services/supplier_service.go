@@ -0,0 +1,68 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+	"fmt"
+	"strings"
+)
+
+type SupplierServiceInput interface {
+	GetAll(search string) ([]models.Supplier, error)
+	Create(supplier *models.Supplier) error
+	GetByID(id int) (*models.Supplier, error)
+	Update(supplier *models.Supplier) error
+	Delete(id int) error
+}
+
+type supplierService struct {
+	repo repositories.SupplierRepositoryInput
+}
+
+func NewSupplierService(repo repositories.SupplierRepositoryInput) SupplierServiceInput {
+	return &supplierService{repo: repo}
+}
+
+func (s *supplierService) GetAll(search string) ([]models.Supplier, error) {
+	return s.repo.GetAll(strings.TrimSpace(search))
+}
+
+func (s *supplierService) Create(supplier *models.Supplier) error {
+	if err := validateSupplier(supplier); err != nil {
+		return err
+	}
+	return s.repo.Create(supplier)
+}
+
+func (s *supplierService) GetByID(id int) (*models.Supplier, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *supplierService) Update(supplier *models.Supplier) error {
+	if err := validateSupplier(supplier); err != nil {
+		return err
+	}
+	return s.repo.Update(supplier)
+}
+
+func (s *supplierService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+// validateSupplier trims the contact fields and checks that a name is given
+// and an email, if any, looks like one.
+func validateSupplier(s *models.Supplier) error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.ContactName = strings.TrimSpace(s.ContactName)
+	s.Phone = strings.TrimSpace(s.Phone)
+	s.Email = strings.TrimSpace(s.Email)
+	s.Address = strings.TrimSpace(s.Address)
+
+	if s.Name == "" {
+		return fmt.Errorf("%w: name is required", models.ErrInvalidSupplier)
+	}
+	if s.Email != "" && !strings.Contains(s.Email, "@") {
+		return fmt.Errorf("%w: email is not valid", models.ErrInvalidSupplier)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"cashier-api/models"
+	"cashier-api/repositories"
+	"fmt"
+	"strings"
+)
+
+type TaxRateServiceInput interface {
+	GetAll() ([]models.TaxRate, error)
+	Create(req models.TaxRateRequest) (*models.TaxRate, error)
+	GetByID(id int) (*models.TaxRate, error)
+	AddPeriod(id int, req models.TaxRateRequest) (*models.TaxRatePeriod, error)
+}
+
+type taxRateService struct {
+	repo repositories.TaxRateRepositoryInput
+}
+
+func NewTaxRateService(repo repositories.TaxRateRepositoryInput) TaxRateServiceInput {
+	return &taxRateService{repo: repo}
+}
+
+func (s *taxRateService) GetAll() ([]models.TaxRate, error) {
+	return s.repo.GetAll()
+}
+
+func (s *taxRateService) Create(req models.TaxRateRequest) (*models.TaxRate, error) {
+	req.Code = strings.TrimSpace(req.Code)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Code == "" || req.Name == "" {
+		return nil, fmt.Errorf("%w: code and name are required", models.ErrInvalidTaxRate)
+	}
+	if len(req.Code) > 20 || len(req.Name) > 100 {
+		return nil, fmt.Errorf("%w: code must be at most 20 characters and name at most 100", models.ErrInvalidTaxRate)
+	}
+	return s.repo.Create(req)
+}
+
+func (s *taxRateService) GetByID(id int) (*models.TaxRate, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *taxRateService) AddPeriod(id int, req models.TaxRateRequest) (*models.TaxRatePeriod, error) {
+	return s.repo.AddPeriod(id, req)
+}
@@ -3,16 +3,86 @@ package services
 import (
 	"cashier-api/models"
 	"cashier-api/repositories"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
 )
 
 type TransactionService struct {
-	repo repositories.TransactionRepositoryInput
+	repo           repositories.TransactionRepositoryInput
+	idempotencyTTL time.Duration
+	lowStock       *LowStockAlerts
 }
 
-func NewTransactionService(repo repositories.TransactionRepositoryInput) *TransactionService {
-	return &TransactionService{repo: repo}
+// NewTransactionService hands products a checkout takes down to their
+// reorder point to lowStock.
+func NewTransactionService(repo repositories.TransactionRepositoryInput, idempotencyTTL time.Duration,
+	lowStock *LowStockAlerts) *TransactionService {
+	return &TransactionService{repo: repo, idempotencyTTL: idempotencyTTL, lowStock: lowStock}
 }
 
-func (s *TransactionService) Checkout(items []models.CheckoutItem, useLock bool) (*models.Transaction, error) {
-	return s.repo.CreateTransaction(items)
+func (s *TransactionService) Checkout(req models.CheckoutRequest, useLock bool, idempotencyKey string) (*models.Transaction, error) {
+	opts := models.CheckoutOptions{
+		UseLock:        useLock,
+		IdempotencyKey: idempotencyKey,
+		IdempotencyTTL: s.idempotencyTTL,
+	}
+
+	if idempotencyKey != "" {
+		hash, err := hashCheckoutRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		opts.RequestHash = hash
+	}
+
+	transaction, err := s.repo.CreateTransaction(req, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.lowStock.Notify(transaction.LowStock)
+	return transaction, nil
+}
+
+// Preview prices a cart, promotions and tax included, without recording it.
+func (s *TransactionService) Preview(req models.CheckoutRequest) (*models.CheckoutPreview, error) {
+	return s.repo.PreviewTransaction(req)
+}
+
+// hashCheckoutRequest hashes the decoded request rather than the raw body so
+// that retries differing only in whitespace or key order still match.
+func hashCheckoutRequest(req models.CheckoutRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *TransactionService) GetAll(filter models.TransactionFilter) (*models.TransactionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 20
+	}
+	if filter.Limit > 100 {
+		filter.Limit = 100
+	}
+	return s.repo.GetAll(filter)
+}
+
+func (s *TransactionService) GetByID(id int) (*models.Transaction, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *TransactionService) Void(id int, req models.ReversalRequest) (*models.Transaction, error) {
+	return s.repo.VoidTransaction(id, req)
+}
+
+func (s *TransactionService) Refund(id int, req models.ReversalRequest) (*models.TransactionReturn, error) {
+	return s.repo.RefundTransaction(id, req)
+}
+
+func (s *TransactionService) CreateReturn(id int, req models.ReturnRequest) (*models.TransactionReturn, error) {
+	return s.repo.CreateReturn(id, req)
 }
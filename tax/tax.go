@@ -0,0 +1,52 @@
+package tax
+
+import "cashier-api/money"
+
+// Rate is a tax percentage in basis points, so 11% PPN is 1100.
+type Rate = money.Percent
+
+// LineTax is the tax breakdown of one line.
+type LineTax struct {
+	// Net is the amount before tax.
+	Net money.Money
+	Tax money.Money
+	// Gross is what the customer pays for the line.
+	Gross money.Money
+}
+
+// Engine computes tax for a priced line. Checkout asks the engine for every
+// line so the pricing rules can be swapped without touching checkout.
+type Engine interface {
+	LineTax(amount money.Money, rate Rate) LineTax
+	// PricesIncludeTax reports whether shelf prices already contain tax.
+	PricesIncludeTax() bool
+}
+
+// StandardEngine applies a single percentage per line, rounding each line's
+// tax to the minor unit.
+type StandardEngine struct {
+	Inclusive bool
+	Rounding  money.RoundingMode
+}
+
+func NewStandardEngine(inclusive bool, rounding money.RoundingMode) *StandardEngine {
+	return &StandardEngine{Inclusive: inclusive, Rounding: rounding}
+}
+
+func (e *StandardEngine) LineTax(amount money.Money, rate Rate) LineTax {
+	if rate == 0 {
+		return LineTax{Net: amount, Tax: money.New(0, amount.Currency()), Gross: amount}
+	}
+
+	if e.Inclusive {
+		tax := amount.MulRat(int64(rate), 10000+int64(rate), e.Rounding)
+		return LineTax{Net: amount.Sub(tax), Tax: tax, Gross: amount}
+	}
+
+	tax := amount.MulRat(int64(rate), 10000, e.Rounding)
+	return LineTax{Net: amount, Tax: tax, Gross: amount.Add(tax)}
+}
+
+func (e *StandardEngine) PricesIncludeTax() bool {
+	return e.Inclusive
+}
@@ -0,0 +1,20 @@
+package tax
+
+import (
+	"cashier-api/money"
+	"testing"
+	"testing/quick"
+)
+
+func TestLineTaxAddsUp(t *testing.T) {
+	for _, inclusive := range []bool{false, true} {
+		engine := NewStandardEngine(inclusive, money.HalfUp)
+		addsUp := func(amount uint32, rate uint16) bool {
+			line := engine.LineTax(money.FromMinor(int64(amount)), Rate(rate%10001))
+			return line.Net.Add(line.Tax).Cmp(line.Gross) == 0 && !line.Tax.IsNegative()
+		}
+		if err := quick.Check(addsUp, nil); err != nil {
+			t.Errorf("inclusive %v: %v", inclusive, err)
+		}
+	}
+}
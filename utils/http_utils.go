@@ -23,3 +23,12 @@ func GetIDFromPath(r *http.Request, prefix string) (int, error) {
 	idStr := strings.TrimPrefix(r.URL.Path, prefix)
 	return strconv.Atoi(idStr)
 }
+
+// GetIDAndActionFromPath parses paths of the form prefix + "{id}" or
+// prefix + "{id}/{action}" and returns the ID and the (possibly empty) action.
+func GetIDAndActionFromPath(r *http.Request, prefix string) (int, string, error) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idStr)
+	return id, action, err
+}